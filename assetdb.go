@@ -5,6 +5,8 @@
 package assetdb
 
 import (
+	"context"
+	"strconv"
 	"time"
 
 	"github.com/owasp-amass/asset-db/repository"
@@ -13,22 +15,47 @@ import (
 )
 
 // AssetDB represents the asset database service.
+// An AssetDB is safe for concurrent use by multiple goroutines. Concurrent calls storing the same asset or relation
+// store a single row, since the inserts rely on the unique indexes of the database rather than on a prior lookup.
 type AssetDB struct {
 	repository repository.Repository
+	feed       feed
+	ops        operations
 }
 
 // New creates a new assetDB instance.
 // It initializes the asset database with the specified database type and DSN.
-func New(dbType repository.DBType, dsn string) *AssetDB {
-	database := repository.New(dbType, dsn)
-	return &AssetDB{
-		repository: database,
-	}
+// The provided options configure the optional behavior of the underlying repository,
+// such as the freshness window set by repository.WithDefaultSince for the methods called with a zero since.
+func New(dbType repository.DBType, dsn string, opts ...repository.Option) *AssetDB {
+	as := &AssetDB{}
+	opts = append(opts, repository.WithAssetCreated(as.feed.publish))
+	as.repository = repository.New(dbType, dsn, opts...)
+	return as
 }
 
 // Close will close the assetdb and return any errors.
+// It waits for the operations in progress to finish before closing the database.
 func (as *AssetDB) Close() error {
-	return as.repository.Close()
+	return as.CloseContext(context.Background())
+}
+
+// CloseContext will close the assetdb once the operations in progress finish or the context is done.
+// Operations started after CloseContext is called fail with ErrDatabaseClosed, and the context error
+// is returned if the wait was cut short.
+func (as *AssetDB) CloseContext(ctx context.Context) error {
+	var err error
+
+	select {
+	case <-as.ops.close():
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if cerr := as.repository.Close(); err == nil {
+		err = opError("Close", "", cerr)
+	}
+	return err
 }
 
 // GetDBType returns the type of the underlying database.
@@ -41,60 +68,716 @@ func (as *AssetDB) GetDBType() string {
 // If source and relation are provided, the asset is created and linked to the source asset using the specified relation.
 // It returns the newly created asset and an error, if any.
 func (as *AssetDB) Create(source *types.Asset, relation string, discovered oam.Asset) (*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("Create", assetType(discovered), err)
+	}
+	defer as.ops.leave()
+
+	a, err := as.repository.CreateAsset(discovered)
+	if err != nil || source == nil || relation == "" {
+		return a, opError("Create", assetType(discovered), err)
+	}
+
+	_, err = as.repository.Link(source, relation, a)
+	if err != nil {
+		return nil, opError("Create", assetType(discovered), err)
+	}
+	return a, nil
+}
+
+// CreateWithObservation creates a new asset in the database and links it to the source that observed it.
+// The confidence of the observation is stored on the relation, so sources can be ranked when they disagree.
+// It returns the newly created asset and an error, if any.
+func (as *AssetDB) CreateWithObservation(discovered oam.Asset, src *types.Asset, confidence int) (*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("CreateWithObservation", assetType(discovered), err)
+	}
+	defer as.ops.leave()
+
 	a, err := as.repository.CreateAsset(discovered)
+	if err != nil {
+		return nil, opError("CreateWithObservation", assetType(discovered), err)
+	}
+
+	_, err = as.repository.LinkObservation(a, src, confidence)
+	if err != nil {
+		return nil, opError("CreateWithObservation", assetType(discovered), err)
+	}
+	return a, nil
+}
+
+// Observations returns the relations linking the asset to the sources that observed it and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// The relations are ordered by the confidence of the observation, highest first.
+// It returns the relations and an error, if any.
+func (as *AssetDB) Observations(asset *types.Asset, since time.Time) ([]*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("Observations", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	rels, err := as.repository.Observations(asset, since)
+	return rels, opError("Observations", storedType(asset), err)
+}
+
+// CreateWithRaw creates a new asset in the database, as Create does, and stores the raw data that produced it.
+// The raw data, such as a DNS response or HTTP header dump, is only read by FindRawById.
+// It returns the newly created asset and an error, if any.
+func (as *AssetDB) CreateWithRaw(source *types.Asset, relation string, discovered oam.Asset, raw []byte) (*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("CreateWithRaw", assetType(discovered), err)
+	}
+	defer as.ops.leave()
+
+	a, err := as.repository.CreateAssetWithRaw(discovered, raw)
+	if err != nil || source == nil || relation == "" {
+		return a, opError("CreateWithRaw", assetType(discovered), err)
+	}
+
+	_, err = as.repository.Link(source, relation, a)
+	if err != nil {
+		return nil, opError("CreateWithRaw", assetType(discovered), err)
+	}
+	return a, nil
+}
+
+// FindRawById finds the raw data stored for the asset with the provided ID.
+// It returns the raw data and an error, if any.
+func (as *AssetDB) FindRawById(id string) ([]byte, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindRawById", "", err)
+	}
+	defer as.ops.leave()
+
+	raw, err := as.repository.FindAssetRawById(id)
+	return raw, opError("FindRawById", "", err)
+}
+
+// FindHistoryById returns the previous contents of the asset with the provided ID, ordered from the most recently replaced.
+// The history is only kept by a repository created with repository.WithContentHistory.
+// It returns the versions and an error, if any.
+func (as *AssetDB) FindHistoryById(id string) ([]*types.AssetVersion, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindHistoryById", "", err)
+	}
+	defer as.ops.leave()
+
+	versions, err := as.repository.FindAssetHistory(id)
+	return versions, opError("FindHistoryById", "", err)
+}
+
+// CreateWithExternalID creates a new asset in the database, as Create does, and assigns it the stable identifier
+// given to the asset by an external system, such as an upstream UUID. External IDs are unique per asset type
+// and are preserved by CopyTo, so the asset can be reconciled across databases by FindByExternalID.
+// It returns the newly created asset and an error, if any, including when the asset already holds a different external ID.
+func (as *AssetDB) CreateWithExternalID(source *types.Asset, relation string, discovered oam.Asset, externalID string) (*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("CreateWithExternalID", assetType(discovered), err)
+	}
+	defer as.ops.leave()
+
+	a, err := as.repository.CreateAssetWithExternalID(discovered, externalID)
 	if err != nil || source == nil || relation == "" {
-		return a, err
+		return a, opError("CreateWithExternalID", assetType(discovered), err)
 	}
 
 	_, err = as.repository.Link(source, relation, a)
 	if err != nil {
-		return nil, err
+		return nil, opError("CreateWithExternalID", assetType(discovered), err)
 	}
 	return a, nil
 }
 
+// CreateOrUpdate creates the asset in the database, or updates its last seen field to the current time
+// if the asset already exists.
+// It returns the stored asset, true when a new row was created or false when an existing row was updated,
+// and an error, if any.
+func (as *AssetDB) CreateOrUpdate(asset oam.Asset) (*types.Asset, bool, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, false, opError("CreateOrUpdate", assetType(asset), err)
+	}
+	defer as.ops.leave()
+
+	a, created, err := as.repository.CreateOrUpdateAsset(asset)
+	return a, created, opError("CreateOrUpdate", assetType(asset), err)
+}
+
+// CreateIfNotSeenSince creates the asset in the database unless the same asset was already seen at or after the since parameter,
+// such as by a concurrent worker that refreshed it, and updates the last seen field of an asset seen before then.
+// The check and the write are performed atomically in a single transaction.
+// If since.IsZero(), any stored asset satisfies the check.
+// It returns the stored asset, true when the asset was created or refreshed or false when the existing asset was returned
+// unchanged, and an error, if any.
+func (as *AssetDB) CreateIfNotSeenSince(asset oam.Asset, since time.Time) (*types.Asset, bool, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, false, opError("CreateIfNotSeenSince", assetType(asset), err)
+	}
+	defer as.ops.leave()
+
+	a, written, err := as.repository.CreateAssetIfNotSeenSince(asset, since)
+	return a, written, opError("CreateIfNotSeenSince", assetType(asset), err)
+}
+
 // UpdateAssetLastSeen updates the asset last seen field to the current time by its ID.
 func (as *AssetDB) UpdateAssetLastSeen(id string) error {
-	return as.repository.UpdateAssetLastSeen(id)
+	if err := as.ops.enter(); err != nil {
+		return opError("UpdateAssetLastSeen", "", err)
+	}
+	defer as.ops.leave()
+
+	return opError("UpdateAssetLastSeen", "", as.repository.UpdateAssetLastSeen(id))
+}
+
+// RetypeAsset changes the type of the asset with the provided ID in place, keeping its ID, content and relations,
+// to correct an asset stored with the wrong type.
+// It returns an error if the content of the asset is not compatible with the new type.
+func (as *AssetDB) RetypeAsset(id string, newType oam.AssetType) error {
+	if err := as.ops.enter(); err != nil {
+		return opError("RetypeAsset", newType, err)
+	}
+	defer as.ops.leave()
+
+	return opError("RetypeAsset", newType, as.repository.RetypeAsset(id, newType))
 }
 
 // DeleteAsset removes an asset in the database by its ID.
 func (as *AssetDB) DeleteAsset(id string) error {
-	return as.repository.DeleteAsset(id)
+	if err := as.ops.enter(); err != nil {
+		return opError("DeleteAsset", "", err)
+	}
+	defer as.ops.leave()
+
+	return opError("DeleteAsset", "", as.repository.DeleteAsset(id))
 }
 
 // DeleteRelation removes a relation in the database by its ID.
 func (as *AssetDB) DeleteRelation(id string) error {
-	return as.repository.DeleteRelation(id)
+	if err := as.ops.enter(); err != nil {
+		return opError("DeleteRelation", "", err)
+	}
+	defer as.ops.leave()
+
+	return opError("DeleteRelation", "", as.repository.DeleteRelation(id))
 }
 
-// FindByContent finds assets in the database based on their content and last seen after the since parameter.
+// DeleteRelations removes the relations in the database with the provided IDs.
+// The relations are removed in chunks, and the chunks removed before a chunk fails remain removed.
+// It returns the number of relations removed and an error, if any.
+func (as *AssetDB) DeleteRelations(ids []string) (int64, error) {
+	if err := as.ops.enter(); err != nil {
+		return 0, opError("DeleteRelations", "", err)
+	}
+	defer as.ops.leave()
+
+	count, err := as.repository.DeleteRelations(ids)
+	return count, opError("DeleteRelations", "", err)
+}
+
+// BackfillAssetHashes assigns the content hash to assets stored before the hash was introduced.
+// It should be run once after migrating an existing SQLite database, which cannot compute the hash during the migration.
+// It returns the number of assets updated and an error, if any.
+func (as *AssetDB) BackfillAssetHashes() (int64, error) {
+	if err := as.ops.enter(); err != nil {
+		return 0, opError("BackfillAssetHashes", "", err)
+	}
+	defer as.ops.leave()
+
+	count, err := as.repository.BackfillAssetHashes()
+	return count, opError("BackfillAssetHashes", "", err)
+}
+
+// FindByContent finds assets in the database based on their content and last seen at or after the since parameter.
 // If since.IsZero(), the parameter will be ignored.
 // It returns a list of matching assets and an error, if any.
 func (as *AssetDB) FindByContent(asset oam.Asset, since time.Time) ([]*types.Asset, error) {
-	return as.repository.FindAssetByContent(asset, since)
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByContent", assetType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByContent(asset, since)
+	return found, opError("FindByContent", assetType(asset), err)
 }
 
-// FindById finds an asset in the database by its ID and last seen after the since parameter.
+// FindByContents finds assets in the database matching any of the provided assets and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// The results are keyed by repository.ContentsKey of each provided asset, and a single query is issued per asset type.
+// It returns the matching assets and an error, if any.
+func (as *AssetDB) FindByContents(assets []oam.Asset, since time.Time) (map[string][]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByContents", "", err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByContents(assets, since)
+	return found, opError("FindByContents", "", err)
+}
+
+// FindExisting finds the stored asset matching each of the provided assets and last seen at or after the since parameter,
+// as FindByContents does with a single query per asset type, to reconcile a batch of discovered assets with the database.
+// The results are aligned with the provided assets and hold nil for each asset that is not stored.
+// When several rows match an asset, the row with the lowest ID is returned.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the stored assets and an error, if any.
+func (as *AssetDB) FindExisting(assets []oam.Asset, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindExisting", "", err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByContents(assets, since)
+	if err != nil {
+		return nil, opError("FindExisting", "", err)
+	}
+	return alignExisting(assets, found), nil
+}
+
+// PartitionExisting splits a batch of discovered assets into those already stored and those missing from the database,
+// to separate the inserts from the last seen updates before the batch is written, such as by an Ingestor.
+// The stored assets are looked up as FindExisting does, with a single query per asset type, regardless of when they
+// were last seen, and the default since window of the repository is not applied.
+// It returns the stored row of each existing asset and the missing assets, both in the order of the provided assets,
+// and an error, if any.
+func (as *AssetDB) PartitionExisting(assets []oam.Asset) ([]*types.Asset, []oam.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, nil, opError("PartitionExisting", "", err)
+	}
+	defer as.ops.leave()
+
+	found, err := as.repository.FindAssetByContents(assets, time.Time{})
+	if err != nil {
+		return nil, nil, opError("PartitionExisting", "", err)
+	}
+
+	existing := []*types.Asset{}
+	missing := []oam.Asset{}
+	for i, row := range alignExisting(assets, found) {
+		if row == nil {
+			missing = append(missing, assets[i])
+		} else {
+			existing = append(existing, row)
+		}
+	}
+	return existing, missing, nil
+}
+
+// alignExisting returns the stored row matching each of the provided assets, or nil for an asset that is not stored,
+// picking the row with the lowest ID when several rows match an asset.
+func alignExisting(assets []oam.Asset, found map[string][]*types.Asset) []*types.Asset {
+	existing := make([]*types.Asset, len(assets))
+	for i, a := range assets {
+		for _, row := range found[repository.ContentsKey(a)] {
+			if existing[i] == nil || lowerID(row.ID, existing[i].ID) {
+				existing[i] = row
+			}
+		}
+	}
+	return existing
+}
+
+// lowerID reports whether the ID a is numerically lower than the ID b.
+func lowerID(a, b string) bool {
+	x, _ := strconv.ParseUint(a, 10, 64)
+	y, _ := strconv.ParseUint(b, 10, 64)
+	return x < y
+}
+
+// FindById finds an asset in the database by its ID and last seen at or after the since parameter.
 // If since.IsZero(), the parameter will be ignored.
 // It returns the matching asset and an error, if any.
 func (as *AssetDB) FindById(id string, since time.Time) (*types.Asset, error) {
-	return as.repository.FindAssetById(id, since)
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindById", "", err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetById(id, since)
+	return found, opError("FindById", "", err)
+}
+
+// FindByExternalID finds the asset of the provided type holding the external ID and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching asset and an error, if any.
+func (as *AssetDB) FindByExternalID(atype oam.AssetType, externalID string, since time.Time) (*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByExternalID", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByExternalID(atype, externalID, since)
+	return found, opError("FindByExternalID", atype, err)
+}
+
+// FindLocationsByCountry finds the Location assets in the provided country and last seen at or after the since parameter.
+// The country is matched against the country stored in the content of the locations, ignoring case.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching locations and an error, if any.
+func (as *AssetDB) FindLocationsByCountry(cc string, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindLocationsByCountry", oam.Location, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindLocationsByCountry(cc, since)
+	return found, opError("FindLocationsByCountry", oam.Location, err)
+}
+
+// FindRegistrationRecords finds the registration records of the provided type, which is a DomainRecord, AutnumRecord or IPNetRecord,
+// holding every value of the fields, keyed by their JSON names such as whois_server, and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching records and an error, if any.
+func (as *AssetDB) FindRegistrationRecords(atype oam.AssetType, fields map[string]interface{}, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindRegistrationRecords", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindRegistrationRecords(atype, fields, since)
+	return found, opError("FindRegistrationRecords", atype, err)
+}
+
+// FindRegistrationRecordsCreated finds the registration records of the provided type created within [start, end)
+// and last seen at or after the since parameter. The created dates must be stored in RFC 3339 format in UTC.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching records and an error, if any.
+func (as *AssetDB) FindRegistrationRecordsCreated(atype oam.AssetType, start, end time.Time, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindRegistrationRecordsCreated", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindRegistrationRecordsCreated(atype, start, end, since)
+	return found, opError("FindRegistrationRecordsCreated", atype, err)
+}
+
+// FindRegistrationRecordsByOrganization finds the registration records of the provided type linked by the contact relation,
+// such as registrant, to a contact record of the Organization with the provided name, and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching records and an error, if any.
+func (as *AssetDB) FindRegistrationRecordsByOrganization(atype oam.AssetType, relation, name string, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindRegistrationRecordsByOrganization", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindRegistrationRecordsByOrganization(atype, relation, name, since)
+	return found, opError("FindRegistrationRecordsByOrganization", atype, err)
+}
+
+// FindDomainRecordsByRegistrar finds the DomainRecord assets whose registrar contact is the Organization with the provided name,
+// and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching records and an error, if any.
+func (as *AssetDB) FindDomainRecordsByRegistrar(registrar string, since time.Time) ([]*types.Asset, error) {
+	return as.FindRegistrationRecordsByOrganization(oam.DomainRecord, "registrar_contact", registrar, since)
 }
 
 // FindByScope finds assets in the database by applying all the scope constraints provided
-// and last seen after the since parameter.
+// and last seen at or after the since parameter.
+// The constraints are combined with OR semantics: assets related to any of the constraints are returned.
+// The assets are ordered by their ID in ascending order; use FindByScopeOrdered for another order.
 // If since.IsZero(), the parameter will be ignored.
 // It returns the matching assets and an error, if any.
 func (as *AssetDB) FindByScope(constraints []oam.Asset, since time.Time) ([]*types.Asset, error) {
-	return as.repository.FindAssetByScope(constraints, since)
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByScope", "", err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByScope(constraints, since)
+	return found, opError("FindByScope", "", err)
+}
+
+// FindByScopeOrdered finds assets in the database by applying all the scope constraints provided, as FindByScope does,
+// ordered as described by the order parameter.
+// It returns the matching assets and an error, if any.
+func (as *AssetDB) FindByScopeOrdered(constraints []oam.Asset, since time.Time, order repository.Order) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByScopeOrdered", "", err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByScopeOrdered(constraints, since, order)
+	return found, opError("FindByScopeOrdered", "", err)
+}
+
+// InScope reports whether the asset is in scope of the constraints, as FindByScope would return it, stopping at the first
+// constraint matching the asset, which makes it a cheaper gate than FindByScope when only a yes or no answer is needed.
+// An EmailAddress is in scope of an FQDN constraint when its address ends with the name of the FQDN,
+// and any stored asset is in scope of a constraint linked to it by a relation in either direction.
+// Netblock constraints are matched on their CIDR rather than evaluated, so an IP address is only in scope of a netblock related to it.
+// Only the assets and relations within the window set by repository.WithDefaultSince are considered.
+// It returns false for an asset that is not stored, and an error, if any.
+func (as *AssetDB) InScope(asset oam.Asset, constraints []oam.Asset) (bool, error) {
+	if err := as.ops.enter(); err != nil {
+		return false, opError("InScope", assetType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since := as.repository.ResolveSince(time.Time{})
+	in, err := as.repository.AssetInScope(asset, constraints, since)
+	return in, opError("InScope", assetType(asset), err)
 }
 
-// FindByType finds all assets in the database of the provided asset type and last seen after the since parameter.
+// FindByContentAny finds the assets in the database matching the content of any of the assets provided
+// and last seen at or after the since parameter.
+// Unlike FindByScope, which returns the assets related to the constraints, the matching assets are returned themselves.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the union of the matching assets, deduplicated by ID, and an error, if any.
+func (as *AssetDB) FindByContentAny(constraints []oam.Asset, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByContentAny", "", err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByContentAny(constraints, since)
+	return found, opError("FindByContentAny", "", err)
+}
+
+// FindByType finds all assets in the database of the provided asset type and last seen at or after the since parameter.
 // If since.IsZero(), the parameter will be ignored.
 // It returns the matching assets and an error, if any.
 func (as *AssetDB) FindByType(atype oam.AssetType, since time.Time) ([]*types.Asset, error) {
-	return as.repository.FindAssetByType(atype, since)
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByType", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByType(atype, since)
+	return found, opError("FindByType", atype, err)
+}
+
+// FindByTypeOrdered finds all assets in the database of the provided asset type and last seen at or after the since parameter,
+// ordered as described by the order parameter, such as by the key field of the assets.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching assets and an error, if any.
+func (as *AssetDB) FindByTypeOrdered(atype oam.AssetType, since time.Time, order repository.Order) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByTypeOrdered", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByTypeOrdered(atype, since, order)
+	return found, opError("FindByTypeOrdered", atype, err)
+}
+
+// SelectField returns the value of the field of the content of each asset of the provided type last seen at or after
+// the since parameter, such as the name of every FQDN, extracted by the database without reading the assets in full.
+// The field is named by its JSON key, and the values are returned as text, ordered by the ID of the assets.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the values and an error, if any.
+func (as *AssetDB) SelectField(atype oam.AssetType, field string, since time.Time) ([]string, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("SelectField", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	values, err := as.repository.SelectAssetField(atype, field, since)
+	return values, opError("SelectField", atype, err)
+}
+
+// FindByTypeFiltered finds the assets of the provided asset type last seen at or after the since parameter whose content
+// matches the filter, such as the FQDNs with a name ending in ".example.com", with a single query.
+// Only the matching assets are read from the database, ordered by their ID.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching assets and an error, if any.
+func (as *AssetDB) FindByTypeFiltered(atype oam.AssetType, filter repository.ContentFilter, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByTypeFiltered", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByTypeFiltered(atype, filter, since)
+	return found, opError("FindByTypeFiltered", atype, err)
+}
+
+// FindByTypes finds all assets in the database of any of the provided asset types and last seen at or after the since parameter.
+// The assets are retrieved with a single query and ordered by their ID.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching assets and an error, if any.
+func (as *AssetDB) FindByTypes(atypes []oam.AssetType, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByTypes", "", err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByTypes(atypes, since)
+	return found, opError("FindByTypes", "", err)
+}
+
+// FindIDsByContent finds the IDs of the assets matching the content of the provided asset and last seen at or after
+// the since parameter, without transferring or parsing the content of the assets, such as to feed a batch update or delete.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the IDs in ascending order and an error, if any.
+func (as *AssetDB) FindIDsByContent(asset oam.Asset, since time.Time) ([]string, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindIDsByContent", assetType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	ids, err := as.repository.FindAssetIDsByContent(asset, since)
+	return ids, opError("FindIDsByContent", assetType(asset), err)
+}
+
+// FindIDsByType finds the IDs of the assets of the provided asset type and last seen at or after the since parameter,
+// without transferring or parsing the content of the assets.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the IDs in ascending order and an error, if any.
+func (as *AssetDB) FindIDsByType(atype oam.AssetType, since time.Time) ([]string, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindIDsByType", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	ids, err := as.repository.FindAssetIDsByType(atype, since)
+	return ids, opError("FindIDsByType", atype, err)
+}
+
+// RecentlyChanged returns up to limit of the most recently seen assets of any type, ordered by LastSeen with the most recent first.
+// Assets created and assets seen again are both included, since creating an asset also sets its LastSeen.
+// It returns the assets and an error, if any.
+func (as *AssetDB) RecentlyChanged(limit int) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("RecentlyChanged", "", err)
+	}
+	defer as.ops.leave()
+
+	found, err := as.repository.RecentlyChangedAssets(limit)
+	return found, opError("RecentlyChanged", "", err)
+}
+
+// StalestByType returns up to n assets of the asset type that have gone the longest without being seen, ordered by LastSeen
+// with the least recent first, such as to schedule the assets to observe again. Assets seen at the same time are ordered by their ID.
+// It returns the assets and an error, if any.
+func (as *AssetDB) StalestByType(atype oam.AssetType, n int) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("StalestByType", atype, err)
+	}
+	defer as.ops.leave()
+
+	found, err := as.repository.StalestAssetsByType(atype, n)
+	return found, opError("StalestByType", atype, err)
+}
+
+// FindDuplicates finds the groups of assets of the asset type that share their key field, such as the rows stored more than once
+// before the assets were deduplicated on insert, as a starting point for cleaning up the database.
+// It returns the groups holding more than one asset, each ordered by ID, and an error, if any.
+func (as *AssetDB) FindDuplicates(atype oam.AssetType) ([][]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindDuplicates", atype, err)
+	}
+	defer as.ops.leave()
+
+	groups, err := as.repository.FindDuplicateAssets(atype)
+	return groups, opError("FindDuplicates", atype, err)
+}
+
+// FindByJSONPath finds all assets in the database of the provided asset type holding the value at the dotted path
+// of their JSON content, such as "headers.server", and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// It returns a slice of matching assets and an error, if any.
+func (as *AssetDB) FindByJSONPath(atype oam.AssetType, path string, value interface{}, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByJSONPath", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByJSONPath(atype, path, value, since)
+	return found, opError("FindByJSONPath", atype, err)
+}
+
+// FindSimilarOrganizations finds the organizations with a name similar to `name`, ordered from the most similar.
+// Punctuation and case are ignored, and the similarity is the share of trigrams the names have in common,
+// so organizations with a similarity between 0 and 1 at or above the threshold are returned.
+// On SQLite, every organization is read to compute the similarity, so the cost of the search grows with the number of organizations.
+// It returns the matching organizations and an error, if any.
+func (as *AssetDB) FindSimilarOrganizations(name string, threshold float64) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindSimilarOrganizations", oam.Organization, err)
+	}
+	defer as.ops.leave()
+
+	found, err := as.repository.FindSimilarOrganizations(name, threshold)
+	return found, opError("FindSimilarOrganizations", oam.Organization, err)
+}
+
+// FindSimilarPeople finds the people with a full name similar to `fullName`, ordered from the most similar.
+// The names are compared as FindSimilarOrganizations compares the names of organizations.
+// It returns the matching people and an error, if any.
+func (as *AssetDB) FindSimilarPeople(fullName string, threshold float64) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindSimilarPeople", oam.Person, err)
+	}
+	defer as.ops.leave()
+
+	found, err := as.repository.FindSimilarPeople(fullName, threshold)
+	return found, opError("FindSimilarPeople", oam.Person, err)
+}
+
+// FindByTypeFromSource finds the assets of the provided asset type linked to the Source with the provided name,
+// and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching assets and an error, if any.
+func (as *AssetDB) FindByTypeFromSource(atype oam.AssetType, sourceName string, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByTypeFromSource", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetByTypeFromSource(atype, sourceName, since)
+	return found, opError("FindByTypeFromSource", atype, err)
+}
+
+// FindWithOutgoingRelation finds the assets of the provided asset type that have at least one outgoing relation of the relation type,
+// and were last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching assets and an error, if any.
+func (as *AssetDB) FindWithOutgoingRelation(atype oam.AssetType, relationType string, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindWithOutgoingRelation", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetsWithOutgoingRelation(atype, relationType, since)
+	return found, opError("FindWithOutgoingRelation", atype, err)
+}
+
+// FindWithIncomingRelation finds the assets of the provided asset type that have at least one incoming relation of the relation type,
+// and were last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching assets and an error, if any.
+func (as *AssetDB) FindWithIncomingRelation(atype oam.AssetType, relationType string, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindWithIncomingRelation", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	found, err := as.repository.FindAssetsWithIncomingRelation(atype, relationType, since)
+	return found, opError("FindWithIncomingRelation", atype, err)
 }
 
 // Link creates a relation between two assets in the database.
@@ -102,37 +785,554 @@ func (as *AssetDB) FindByType(atype oam.AssetType, since time.Time) ([]*types.As
 // The relation is established by creating a new Relation in the database, linking the two assets.
 // Returns the created relation as a types.Relation or an error if the link creation fails.
 func (as *AssetDB) Link(source *types.Asset, relation string, destination *types.Asset) (*types.Relation, error) {
-	return as.repository.Link(source, relation, destination)
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("Link", storedType(source), err)
+	}
+	defer as.ops.leave()
+
+	rel, err := as.repository.Link(source, relation, destination)
+	return rel, opError("Link", storedType(source), err)
+}
+
+// LinkAt creates a relation between two assets in the database, as Link does, created and last seen at `observedAt`,
+// which keeps the real observation time of relations imported from historical data.
+// A relation already stored keeps its earliest creation and latest last seen timestamps.
+// Returns the relation as a types.Relation or an error if the link creation fails.
+func (as *AssetDB) LinkAt(source *types.Asset, relation string, destination *types.Asset, observedAt time.Time) (*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("LinkAt", storedType(source), err)
+	}
+	defer as.ops.leave()
+
+	rel, err := as.repository.LinkAt(source, relation, destination, observedAt)
+	return rel, opError("LinkAt", storedType(source), err)
+}
+
+// LinkWeighted creates a relation between two assets in the database, as Link does, holding the provided `weight`,
+// such as the strength of the edge in a confidence-weighted graph. Linking the assets again replaces the weight.
+// The relations of an asset are ordered by their weight with the repository.OrderByWeight order.
+// Returns the relation as a types.Relation or an error if the link creation fails.
+func (as *AssetDB) LinkWeighted(source *types.Asset, relation string, destination *types.Asset, weight float64) (*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("LinkWeighted", storedType(source), err)
+	}
+	defer as.ops.leave()
+
+	rel, err := as.repository.LinkWeighted(source, relation, destination, weight)
+	return rel, opError("LinkWeighted", storedType(source), err)
+}
+
+// LinkWithSource creates a relation between two assets in the database, as Link does, and records that the source asserted it.
+// Linking the assets again with another source keeps the attribution of both sources, which are returned by RelationSources.
+// Returns the relation as a types.Relation or an error if the link or the attribution fails.
+func (as *AssetDB) LinkWithSource(source *types.Asset, relation string, destination *types.Asset, src *types.Asset) (*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("LinkWithSource", storedType(source), err)
+	}
+	defer as.ops.leave()
+
+	rel, err := as.repository.Link(source, relation, destination)
+	if err != nil {
+		return nil, opError("LinkWithSource", storedType(source), err)
+	}
+
+	if err := as.repository.LinkRelationSource(rel, src); err != nil {
+		return nil, opError("LinkWithSource", storedType(source), err)
+	}
+	return rel, nil
+}
+
+// RelationSources returns the sources that asserted the relation with the provided ID, most recently asserting first.
+// It returns the source assets and an error, if any.
+func (as *AssetDB) RelationSources(relationID string) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("RelationSources", "", err)
+	}
+	defer as.ops.leave()
+
+	found, err := as.repository.RelationSources(relationID)
+	return found, opError("RelationSources", "", err)
+}
+
+// AddTag attaches the tag with the provided key and value to the asset with the provided ID, replacing the value
+// of a tag with the same key. Tags are kept apart from the content of the asset, so they survive the asset being seen again.
+// It returns an error, if any.
+func (as *AssetDB) AddTag(assetID, key, value string) error {
+	if err := as.ops.enter(); err != nil {
+		return opError("AddTag", "", err)
+	}
+	defer as.ops.leave()
+
+	if err := as.repository.AddAssetTag(assetID, key, value); err != nil {
+		return opError("AddTag", "", err)
+	}
+	return nil
+}
+
+// RemoveTag removes the tag with the provided key from the asset with the provided ID, leaving the asset in place.
+// It returns an error, if any.
+func (as *AssetDB) RemoveTag(assetID, key string) error {
+	if err := as.ops.enter(); err != nil {
+		return opError("RemoveTag", "", err)
+	}
+	defer as.ops.leave()
+
+	if err := as.repository.RemoveAssetTag(assetID, key); err != nil {
+		return opError("RemoveTag", "", err)
+	}
+	return nil
+}
+
+// Tags returns the tags attached to the asset with the provided ID, mapping each key to its value.
+// It returns the tags and an error, if any.
+func (as *AssetDB) Tags(assetID string) (map[string]string, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("Tags", "", err)
+	}
+	defer as.ops.leave()
+
+	tags, err := as.repository.AssetTags(assetID)
+	if err != nil {
+		return nil, opError("Tags", "", err)
+	}
+	return tags, nil
+}
+
+// FindByTag finds the assets holding the tag with the provided key and value, last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching assets ordered by ID and an error, if any.
+func (as *AssetDB) FindByTag(key, value string, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("FindByTag", "", err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	assets, err := as.repository.FindAssetsByTag(key, value, since)
+	if err != nil {
+		return nil, opError("FindByTag", "", err)
+	}
+	return assets, nil
+}
+
+// ReplaceOutgoingRelations atomically replaces the outgoing relations of the relation type from `source“ with relations to the destinations,
+// so that only the relations in the current set remain, such as the A records currently resolved for an FQDN.
+// Relations that remain in the set keep their creation timestamp and have their last seen timestamp updated.
+// An empty set of destinations removes all the outgoing relations of the relation type.
+func (as *AssetDB) ReplaceOutgoingRelations(source *types.Asset, relationType string, destinations []*types.Asset) error {
+	if err := as.ops.enter(); err != nil {
+		return opError("ReplaceOutgoingRelations", storedType(source), err)
+	}
+	defer as.ops.leave()
+
+	return opError("ReplaceOutgoingRelations", storedType(source), as.repository.ReplaceOutgoingRelations(source, relationType, destinations))
 }
 
 // IncomingRelations finds all relations pointing to `asset“ for the specified `relationTypes`, if any.
 // If since.IsZero(), the parameter will be ignored.
 // If no `relationTypes` are specified, all incoming relations are returned.
 func (as *AssetDB) IncomingRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, error) {
-	return as.repository.IncomingRelations(asset, since, relationTypes...)
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("IncomingRelations", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	rels, err := as.repository.IncomingRelations(asset, since, relationTypes...)
+	return rels, opError("IncomingRelations", storedType(asset), err)
+}
+
+// IncomingRelationsFrom finds all relations pointing to `asset` for the specified `relationTypes`, if any,
+// that originate from assets of the type `fromType`.
+// If since.IsZero(), the parameter will be ignored.
+// If `fromType` is empty, relations originating from assets of any type are returned.
+// If no `relationTypes` are specified, all incoming relations are returned.
+func (as *AssetDB) IncomingRelationsFrom(asset *types.Asset, since time.Time, fromType oam.AssetType, relationTypes ...string) ([]*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("IncomingRelationsFrom", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	rels, err := as.repository.IncomingRelationsFrom(asset, since, fromType, relationTypes...)
+	return rels, opError("IncomingRelationsFrom", storedType(asset), err)
+}
+
+// NeighborsByType returns the assets of the type `neighborType` linked from `asset` by its outgoing relations
+// of the specified `relationTypes`, if any, such as the IP addresses an FQDN resolves to.
+// The neighbors are loaded by a single query, and each is returned once, ordered by ID.
+// If since.IsZero(), the parameter will be ignored.
+// If `neighborType` is empty, neighbors of any type are returned.
+// If no `relationTypes` are specified, all outgoing relations are followed.
+// It returns the neighbors and an error, if any, wrapping repository.ErrTraversalTruncated along with the neighbors
+// with the lowest IDs when more are found than the maximum set by repository.WithMaxTraversalNodes.
+func (as *AssetDB) NeighborsByType(asset *types.Asset, neighborType oam.AssetType, since time.Time, relationTypes ...string) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("NeighborsByType", neighborType, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	neighbors, err := as.repository.FindNeighborsByType(asset, neighborType, since, relationTypes...)
+	return neighbors, opError("NeighborsByType", neighborType, err)
+}
+
+// AssetsInAS finds the IP addresses attributed to the autonomous system with the provided number and last seen at or after
+// the since parameter, following the announces relations to its netblocks and the contains relations to their IP addresses.
+// The hops are joined by a single query, and each IP address is returned once, ordered by ID.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the IP addresses and an error, if any.
+func (as *AssetDB) AssetsInAS(asn int, since time.Time) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("AssetsInAS", oam.AutonomousSystem, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	ips, err := as.repository.FindAssetsInAS(asn, since)
+	if err != nil {
+		return nil, opError("AssetsInAS", oam.AutonomousSystem, err)
+	}
+	return ips, nil
 }
 
 // OutgoingRelations finds all relations from `asset“ to another asset for the specified `relationTypes`, if any.
 // If since.IsZero(), the parameter will be ignored.
 // If no `relationTypes` are specified, all outgoing relations are returned.
 func (as *AssetDB) OutgoingRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, error) {
-	return as.repository.OutgoingRelations(asset, since, relationTypes...)
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("OutgoingRelations", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	rels, err := as.repository.OutgoingRelations(asset, since, relationTypes...)
+	return rels, opError("OutgoingRelations", storedType(asset), err)
+}
+
+// AllRelations finds all relations from or pointing to `asset` for the specified `relationTypes`, if any, with a single query.
+// The direction of each relation relative to `asset` is returned at the same index as the relation.
+// If since.IsZero(), the parameter will be ignored.
+// If no `relationTypes` are specified, all relations are returned.
+func (as *AssetDB) AllRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, []types.Direction, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, nil, opError("AllRelations", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	rels, dirs, err := as.repository.AllRelations(asset, since, relationTypes...)
+	return rels, dirs, opError("AllRelations", storedType(asset), err)
+}
+
+// Expand follows the relations of the relation types in the direction provided, starting from the asset, for up to depth hops,
+// such as the outgoing relations of an FQDN followed by the outgoing relations of the addresses it resolves to.
+// Each hop is read with a single query, instead of a query per asset, and the depth is capped by repository.MaxExpandDepth.
+// If since.IsZero(), the parameter will be ignored. If no relationTypes are specified, relations of every type are followed.
+// It returns the relations found at each hop and an error, if any, wrapping repository.ErrTraversalTruncated along with
+// the hops found so far when more assets are reached than the maximum set by repository.WithMaxTraversalNodes.
+func (as *AssetDB) Expand(asset *types.Asset, dir types.Direction, depth int, since time.Time, relationTypes ...string) ([][]*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("Expand", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	hops, err := as.repository.ExpandRelations(asset, dir, depth, since, relationTypes...)
+	return hops, opError("Expand", storedType(asset), err)
+}
+
+// TransitiveClosure finds the assets reached from the start asset by repeatedly following the outgoing relations
+// of the relation type, for up to maxDepth hops, such as every subdomain eventually found under an apex domain.
+// The assets are found by a single recursive query, each asset is returned once and the start asset is left out.
+// The depth is capped by repository.MaxClosureDepth.
+// It returns the reachable assets, ordered by ID, and an error, if any, wrapping repository.ErrTraversalTruncated along with
+// the nearest assets when more assets are reached than the maximum set by repository.WithMaxTraversalNodes.
+func (as *AssetDB) TransitiveClosure(start *types.Asset, relationType string, maxDepth int) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("TransitiveClosure", storedType(start), err)
+	}
+	defer as.ops.leave()
+
+	since := as.repository.ResolveSince(time.Time{})
+	found, err := as.repository.FindTransitiveClosure(start, relationType, maxDepth, since)
+	return found, opError("TransitiveClosure", storedType(start), err)
+}
+
+// RelationsBetween finds the relations linking the assets with the IDs `idA` and `idB` in either direction,
+// with the assets at both ends loaded.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the relations and an error, if any.
+func (as *AssetDB) RelationsBetween(idA, idB string, since time.Time) ([]*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("RelationsBetween", "", err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	rels, err := as.repository.RelationsBetween(idA, idB, since)
+	return rels, opError("RelationsBetween", "", err)
+}
+
+// LatestRelation finds the relation of the type `relationType` from the asset with the ID `fromID` to the asset with the ID `toID`
+// that was last seen most recently, with the assets at both ends loaded, such as to read the current state of the link.
+// It returns the relation and an error, if any, wrapping repository.ErrRelationNotFound when the assets are not linked by the type.
+func (as *AssetDB) LatestRelation(fromID, toID, relationType string) (*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("LatestRelation", "", err)
+	}
+	defer as.ops.leave()
+
+	rel, err := as.repository.FindLatestRelation(fromID, toID, relationType)
+	if err != nil {
+		return nil, opError("LatestRelation", "", err)
+	}
+	return rel, nil
+}
+
+// RelationsAmong finds the relations with either end among the assets with the provided `ids`, with the assets at both ends loaded,
+// which extracts the subgraph around a set of assets without querying the relations of each asset.
+// Each relation is returned once, ordered by ID.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the relations and an error, if any.
+func (as *AssetDB) RelationsAmong(ids []string, since time.Time) ([]*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("RelationsAmong", "", err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	rels, err := as.repository.RelationsAmong(ids, since)
+	return rels, opError("RelationsAmong", "", err)
+}
+
+// IncomingRelationsOrdered finds all relations pointing to `asset“ for the specified `relationTypes`, if any,
+// ordered as described by the order parameter. Relations cannot be ordered by their key field.
+// If since.IsZero(), the parameter will be ignored.
+// If no `relationTypes` are specified, all incoming relations are returned.
+func (as *AssetDB) IncomingRelationsOrdered(asset *types.Asset, since time.Time, order repository.Order, relationTypes ...string) ([]*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("IncomingRelationsOrdered", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	rels, err := as.repository.IncomingRelationsOrdered(asset, since, order, relationTypes...)
+	return rels, opError("IncomingRelationsOrdered", storedType(asset), err)
+}
+
+// OutgoingRelationsOrdered finds all relations from `asset“ to another asset for the specified `relationTypes`, if any,
+// ordered as described by the order parameter. Relations cannot be ordered by their key field.
+// If since.IsZero(), the parameter will be ignored.
+// If no `relationTypes` are specified, all outgoing relations are returned.
+func (as *AssetDB) OutgoingRelationsOrdered(asset *types.Asset, since time.Time, order repository.Order, relationTypes ...string) ([]*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("OutgoingRelationsOrdered", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	rels, err := as.repository.OutgoingRelationsOrdered(asset, since, order, relationTypes...)
+	return rels, opError("OutgoingRelationsOrdered", storedType(asset), err)
+}
+
+// IncomingRelationsCreated finds all relations pointing to `asset` for the specified `relationTypes`, if any,
+// that were created within the window starting at `start` and ending before `end`.
+// Unlike IncomingRelations, the window is applied to the CreatedAt of the relations rather than LastSeen.
+// If start.IsZero() or end.IsZero(), the respective bound will be ignored.
+func (as *AssetDB) IncomingRelationsCreated(asset *types.Asset, start, end time.Time, relationTypes ...string) ([]*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("IncomingRelationsCreated", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	rels, err := as.repository.IncomingRelationsCreated(asset, start, end, relationTypes...)
+	return rels, opError("IncomingRelationsCreated", storedType(asset), err)
+}
+
+// OutgoingRelationsCreated finds all relations from `asset` to another asset for the specified `relationTypes`, if any,
+// that were created within the window starting at `start` and ending before `end`.
+// Unlike OutgoingRelations, the window is applied to the CreatedAt of the relations rather than LastSeen.
+// If start.IsZero() or end.IsZero(), the respective bound will be ignored.
+func (as *AssetDB) OutgoingRelationsCreated(asset *types.Asset, start, end time.Time, relationTypes ...string) ([]*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("OutgoingRelationsCreated", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	rels, err := as.repository.OutgoingRelationsCreated(asset, start, end, relationTypes...)
+	return rels, opError("OutgoingRelationsCreated", storedType(asset), err)
+}
+
+// ForEachRelation calls fn with each relation of the specified `relationType` last seen at or after the since parameter,
+// with the assets at both ends loaded. The relations are read in batches, so the whole graph is never held in memory.
+// If `relationType` is empty, relations of every type are visited. If since.IsZero(), the parameter will be ignored.
+// The iteration stops at the first error returned by fn, and that error is returned wrapped in an Error.
+func (as *AssetDB) ForEachRelation(relationType string, since time.Time, fn func(*types.Relation) error) error {
+	if err := as.ops.enter(); err != nil {
+		return opError("ForEachRelation", "", err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	return opError("ForEachRelation", "", as.repository.ForEachRelation(relationType, since, fn))
 }
 
 // RawQuery executes a query defined by the provided sqlstr on the asset-db.
 // The results of the executed query are scanned into the provided slice.
 func (as *AssetDB) RawQuery(sqlstr string, results interface{}) error {
-	return as.repository.RawQuery(sqlstr, results)
+	if err := as.ops.enter(); err != nil {
+		return opError("RawQuery", "", err)
+	}
+	defer as.ops.leave()
+
+	return opError("RawQuery", "", as.repository.RawQuery(sqlstr, results))
+}
+
+// Explain returns the query plan of the provided sqlstr, such as to check that a JSON query is using an index.
+// On Postgres, the statement is run with EXPLAIN ANALYZE and its changes are rolled back.
+// On SQLite, the plan is returned by EXPLAIN QUERY PLAN.
+func (as *AssetDB) Explain(sqlstr string, args ...interface{}) (string, error) {
+	if err := as.ops.enter(); err != nil {
+		return "", opError("Explain", "", err)
+	}
+	defer as.ops.leave()
+
+	plan, err := as.repository.Explain(sqlstr, args...)
+	return plan, opError("Explain", "", err)
+}
+
+// RawAssetQuery executes a query defined by the provided sqlstr on the asset-db, passing args as bind parameters.
+// The query must select the id, created_at, last_seen, type, and content columns of the assets table,
+// and the selected rows are returned as parsed assets.
+func (as *AssetDB) RawAssetQuery(sqlstr string, args ...interface{}) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("RawAssetQuery", "", err)
+	}
+	defer as.ops.leave()
+
+	found, err := as.repository.RawAssetQuery(sqlstr, args...)
+	return found, opError("RawAssetQuery", "", err)
 }
 
 // AssetQuery executes a query against the asset table of the db.
 // For SQL databases, the query will start with "SELECT * FROM assets " and then add the necessary constraints.
-func (as *AssetDB) AssetQuery(constraints string) ([]*types.Asset, error) {
-	return as.repository.AssetQuery(constraints)
+// The args are passed as bind parameters for the placeholders in the constraints.
+// Interpolating untrusted input into the constraints is unsafe and exposes the db to SQL injection.
+func (as *AssetDB) AssetQuery(constraints string, args ...interface{}) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("AssetQuery", "", err)
+	}
+	defer as.ops.leave()
+
+	found, err := as.repository.AssetQuery(constraints, args...)
+	return found, opError("AssetQuery", "", err)
 }
 
 // RelationQuery executes a query against the relation table of the db.
 // For SQL databases, the query will start with "SELECT * FROM relations " and then add the necessary constraints.
-func (as *AssetDB) RelationQuery(constraints string) ([]*types.Relation, error) {
-	return as.repository.RelationQuery(constraints)
+// The args are passed as bind parameters for the placeholders in the constraints.
+// Interpolating untrusted input into the constraints is unsafe and exposes the db to SQL injection.
+// The assets at both ends of each relation are returned already parsed into their Open Asset Model types,
+// and relations referencing an asset with malformed content are left out.
+func (as *AssetDB) RelationQuery(constraints string, args ...interface{}) ([]*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("RelationQuery", "", err)
+	}
+	defer as.ops.leave()
+
+	rels, err := as.repository.RelationQuery(constraints, args...)
+	return rels, opError("RelationQuery", "", err)
+}
+
+// RelationQueryWithLimit executes the query built by RelationQuery and returns at most `limit` relations,
+// which protects the db from constraints missing a join condition, since the query stops once the limit is reached.
+// Constraints that order or group the rows still require the db to build every combination before the limit applies.
+func (as *AssetDB) RelationQueryWithLimit(constraints string, limit int, args ...interface{}) ([]*types.Relation, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("RelationQueryWithLimit", "", err)
+	}
+	defer as.ops.leave()
+
+	rels, err := as.repository.RelationQueryWithLimit(constraints, limit, args...)
+	return rels, opError("RelationQueryWithLimit", "", err)
+}
+
+// Stats returns the number of assets and relations in the database, in total and per type, along with the on-disk size.
+// The size is zero when the underlying database does not support reporting it.
+// It returns the statistics and an error, if any.
+func (as *AssetDB) Stats() (*types.DBStats, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("Stats", "", err)
+	}
+	defer as.ops.leave()
+
+	stats, err := as.repository.Stats()
+	return stats, opError("Stats", "", err)
+}
+
+// AssetWithRelationCounts finds the asset with the provided ID along with the number of its incoming
+// and outgoing relations, grouped by relation type.
+// It returns the asset, the incoming and outgoing counts keyed by relation type, and an error, if any.
+func (as *AssetDB) AssetWithRelationCounts(id string) (*types.Asset, map[string]int64, map[string]int64, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, nil, nil, opError("AssetWithRelationCounts", "", err)
+	}
+	defer as.ops.leave()
+
+	a, err := as.repository.FindAssetById(id, time.Time{})
+	if err != nil {
+		return nil, nil, nil, opError("AssetWithRelationCounts", "", err)
+	}
+
+	incoming, outgoing, err := as.repository.RelationCounts(id)
+	if err != nil {
+		return nil, nil, nil, opError("AssetWithRelationCounts", storedType(a), err)
+	}
+	return a, incoming, outgoing, nil
+}
+
+// OutgoingRelationTypeCounts returns the number of relations originating from the asset and last seen at or after
+// the since parameter, grouped by relation type, without reading the relations themselves.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the counts keyed by relation type and an error, if any.
+func (as *AssetDB) OutgoingRelationTypeCounts(asset *types.Asset, since time.Time) (map[string]int64, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("OutgoingRelationTypeCounts", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	counts, err := as.repository.OutgoingRelationTypeCounts(asset, since)
+	return counts, opError("OutgoingRelationTypeCounts", storedType(asset), err)
+}
+
+// IncomingRelationTypeCounts returns the number of relations pointing to the asset and last seen at or after
+// the since parameter, grouped by relation type, without reading the relations themselves.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the counts keyed by relation type and an error, if any.
+func (as *AssetDB) IncomingRelationTypeCounts(asset *types.Asset, since time.Time) (map[string]int64, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("IncomingRelationTypeCounts", storedType(asset), err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	counts, err := as.repository.IncomingRelationTypeCounts(asset, since)
+	return counts, opError("IncomingRelationTypeCounts", storedType(asset), err)
+}
+
+// TopByDegree returns up to n assets of the asset type with the most relations from or pointing to them, such as the IP addresses
+// the most FQDNs resolve to, along with their number of relations last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the assets paired with their degree, most linked first, and an error, if any.
+func (as *AssetDB) TopByDegree(atype oam.AssetType, n int, since time.Time) ([]types.AssetDegree, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("TopByDegree", atype, err)
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	top, err := as.repository.TopAssetsByDegree(atype, n, since)
+	return top, opError("TopByDegree", atype, err)
 }
@@ -5,13 +5,18 @@
 package assetdb
 
 import (
+	"bytes"
+	"context"
 	"embed"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"math/rand"
 	"net/netip"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -28,6 +33,7 @@ import (
 	"github.com/owasp-amass/open-asset-model/org"
 	"github.com/owasp-amass/open-asset-model/people"
 	oamreg "github.com/owasp-amass/open-asset-model/registration"
+	"github.com/owasp-amass/open-asset-model/source"
 	"github.com/owasp-amass/open-asset-model/url"
 	migrate "github.com/rubenv/sql-migrate"
 	"github.com/stretchr/testify/assert"
@@ -121,7 +127,8 @@ func TestAssetDB(t *testing.T) {
 				result, err := adb.FindById(tc.id, start)
 
 				assert.Equal(t, tc.expected, result)
-				assert.Equal(t, tc.expectedError, err)
+				// the error of the repository is wrapped along with the operation and the asset type
+				assert.ErrorIs(t, err, tc.expectedError)
 
 				mockAssetDB.AssertExpectations(t)
 			})
@@ -154,7 +161,8 @@ func TestAssetDB(t *testing.T) {
 				result, err := adb.FindByContent(tc.asset, tc.since)
 
 				assert.Equal(t, tc.expected, result)
-				assert.Equal(t, tc.expectedError, err)
+				// the error of the repository is wrapped along with the operation and the asset type
+				assert.ErrorIs(t, err, tc.expectedError)
 
 				mockAssetDB.AssertExpectations(t)
 			})
@@ -184,7 +192,8 @@ func TestAssetDB(t *testing.T) {
 				result, err := adb.FindByScope(tc.assets, start)
 
 				assert.Equal(t, tc.expected, result)
-				assert.Equal(t, tc.expectedError, err)
+				// the error of the repository is wrapped along with the operation and the asset type
+				assert.ErrorIs(t, err, tc.expectedError)
 
 				mockAssetDB.AssertExpectations(t)
 			})
@@ -214,7 +223,8 @@ func TestAssetDB(t *testing.T) {
 				result, err := adb.FindByType(tc.atype, start)
 
 				assert.Equal(t, tc.expected, result)
-				assert.Equal(t, tc.expectedError, err)
+				// the error of the repository is wrapped along with the operation and the asset type
+				assert.ErrorIs(t, err, tc.expectedError)
 
 				mockAssetDB.AssertExpectations(t)
 			})
@@ -281,7 +291,8 @@ func TestAssetDB(t *testing.T) {
 				result, err := adb.IncomingRelations(tc.asset, tc.since, tc.relationTypes...)
 
 				assert.Equal(t, tc.expected, result)
-				assert.Equal(t, tc.expectedError, err)
+				// the error of the repository is wrapped along with the operation and the asset type
+				assert.ErrorIs(t, err, tc.expectedError)
 
 				mockAssetDB.AssertExpectations(t)
 			})
@@ -348,7 +359,8 @@ func TestAssetDB(t *testing.T) {
 				result, err := adb.OutgoingRelations(tc.asset, tc.since, tc.relationTypes...)
 
 				assert.Equal(t, tc.expected, result)
-				assert.Equal(t, tc.expectedError, err)
+				// the error of the repository is wrapped along with the operation and the asset type
+				assert.ErrorIs(t, err, tc.expectedError)
 
 				mockAssetDB.AssertExpectations(t)
 			})
@@ -376,7 +388,8 @@ func TestAssetDB(t *testing.T) {
 
 				err := adb.DeleteRelation(tc.id)
 
-				assert.Equal(t, tc.expectedError, err)
+				// the error of the repository is wrapped along with the operation and the asset type
+				assert.ErrorIs(t, err, tc.expectedError)
 
 				mockAssetDB.AssertExpectations(t)
 			})
@@ -404,7 +417,8 @@ func TestAssetDB(t *testing.T) {
 
 				err := adb.DeleteAsset(tc.id)
 
-				assert.Equal(t, tc.expectedError, err)
+				// the error of the repository is wrapped along with the operation and the asset type
+				assert.ErrorIs(t, err, tc.expectedError)
 
 				mockAssetDB.AssertExpectations(t)
 			})
@@ -444,6 +458,30 @@ func TestRayQuery(t *testing.T) {
 	assert.Equal(t, created, queried)
 }
 
+func TestRawAssetQuery(t *testing.T) {
+	// Set up the SQLite database for testing
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+
+	queried, err := db.RawAssetQuery("SELECT * FROM assets WHERE type = ? ORDER BY id", oam.FQDN)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	assert.Equal(t, createdAssets[:3], queried)
+
+	// bind parameters are not interpolated into the statement
+	queried, err = db.RawAssetQuery("SELECT * FROM assets WHERE type = ?", "FQDN' OR '1'='1")
+	assert.NoError(t, err)
+	assert.Empty(t, queried)
+}
+
 func TestAssetQuery(t *testing.T) {
 	// Set up the SQLite database for testing
 	db, err := newGraph("local", "test.db")
@@ -462,6 +500,10 @@ func TestAssetQuery(t *testing.T) {
 	}
 	// compare the assets
 	assert.Equal(t, createdAssets, queriedAssets)
+
+	queriedAssets, err = db.AssetQuery("assets WHERE assets.type = ? AND assets.content->>'name' = ?", oam.FQDN, "www.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Asset{createdAssets[1]}, queriedAssets)
 }
 
 func TestRelationQuery(t *testing.T) {
@@ -490,222 +532,2707 @@ func TestRelationQuery(t *testing.T) {
 		assert.Contains(t, createdAssets, relation.FromAsset)
 		assert.Contains(t, createdAssets, relation.ToAsset)
 	}
-}
 
-func createRelations(assets []*types.Asset, db *AssetDB) []*types.Relation {
-	var relations []*types.Relation
+	queriedRelations, err = db.RelationQuery("relations WHERE relations.type = ?", "a_record")
+	assert.NoError(t, err)
+	assert.Len(t, queriedRelations, 1)
+	assert.Equal(t, createdRelations[1].ID, queriedRelations[0].ID)
 
-	// Create test relations
-	relation, err := db.repository.Link(assets[0], "node", assets[1])
-	if err != nil {
-		panic(err)
+	// a cartesian join of the relations with the assets is cut off at the limit
+	queriedRelations, err = db.RelationQueryWithLimit("relations, assets ORDER BY relations.id", 3)
+	assert.NoError(t, err)
+	if assert.Len(t, queriedRelations, 3) {
+		assert.Equal(t, createdRelations[0].ID, queriedRelations[0].ID)
 	}
-	relations = append(relations, relation)
-	relation, err = db.repository.Link(assets[0], "a_record", assets[5])
+
+	queriedRelations, err = db.RelationQueryWithLimit("relations WHERE relations.type = ? LIMIT 5", 10, "a_record")
+	assert.NoError(t, err)
+	assert.Len(t, queriedRelations, 1)
+
+	queriedRelations, err = db.RelationQueryWithLimit("", 2)
+	assert.NoError(t, err)
+	assert.Len(t, queriedRelations, 2)
+
+	_, err = db.RelationQueryWithLimit("", 0)
+	assert.Error(t, err)
+}
+
+func TestIngestor(t *testing.T) {
+	db, err := newGraph("local", "test.db")
 	if err != nil {
-		panic(err)
+		t.Errorf("%v", err)
+		return
 	}
-	relations = append(relations, relation)
-	relation, err = db.repository.Link(assets[0], "aaaa_record", assets[6])
-	if err != nil {
-		panic(err)
+	defer teardownSqlite("test.db")
+
+	sub, cancel := db.Subscribe()
+	defer cancel()
+
+	in := db.NewIngestor(3, 0)
+	for i := 0; i < 10; i++ {
+		err := in.Push(context.Background(), IngestItem{
+			Asset:    &domain.FQDN{Name: fmt.Sprintf("host%d.ingest.owasp.org", i)},
+			Source:   &domain.FQDN{Name: "ingest.owasp.org"},
+			Relation: "node",
+		})
+		assert.NoError(t, err)
 	}
-	relations = append(relations, relation)
-	relation, err = db.repository.Link(assets[3], "contains", assets[6])
+	assert.NoError(t, in.Flush())
+
+	assets, err := db.FindByType(oam.FQDN, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, assets, 11)
+	root, err := db.FindByContent(&domain.FQDN{Name: "ingest.owasp.org"}, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, root, 1) {
+		rels, err := db.OutgoingRelations(root[0], time.Time{}, "node")
+		assert.NoError(t, err)
+		assert.Len(t, rels, 10)
+	}
+
+	// the assets created are published once the batches are committed
+	assert.Len(t, sub, 11)
+
+	// an invalid relation fails its item without discarding the rest of the batch
+	assert.NoError(t, in.Push(context.Background(), IngestItem{Asset: &domain.FQDN{Name: "valid.ingest.owasp.org"}}))
+	assert.NoError(t, in.Push(context.Background(), IngestItem{
+		Asset:    &domain.FQDN{Name: "invalid.ingest.owasp.org"},
+		Source:   &domain.FQDN{Name: "ingest.owasp.org"},
+		Relation: "contains",
+	}))
+	err = in.Flush()
+	var e *Error
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, "Ingest", e.Op)
+	}
+	found, err := db.FindByContent(&domain.FQDN{Name: "valid.ingest.owasp.org"}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.NoError(t, in.Flush())
+
+	// close commits the items remaining in the buffer
+	assert.NoError(t, in.Push(context.Background(), IngestItem{Asset: &domain.FQDN{Name: "last.ingest.owasp.org"}}))
+	assert.NoError(t, in.Close())
+	found, err = db.FindByContent(&domain.FQDN{Name: "last.ingest.owasp.org"}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+
+	assert.ErrorIs(t, in.Push(context.Background(), IngestItem{Asset: &domain.FQDN{Name: "late.ingest.owasp.org"}}), ErrIngestorClosed)
+	assert.ErrorIs(t, in.Flush(), ErrIngestorClosed)
+	assert.ErrorIs(t, in.Close(), ErrIngestorClosed)
+
+	// the flush interval commits a partial batch
+	in = db.NewIngestor(100, 10*time.Millisecond)
+	defer in.Close()
+	assert.NoError(t, in.Push(context.Background(), IngestItem{Asset: &domain.FQDN{Name: "timed.ingest.owasp.org"}}))
+	assert.Eventually(t, func() bool {
+		found, err := db.FindByContent(&domain.FQDN{Name: "timed.ingest.owasp.org"}, time.Time{})
+		return err == nil && len(found) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestEvictor(t *testing.T) {
+	db, err := newGraph("local", "test.db")
 	if err != nil {
-		panic(err)
+		t.Errorf("%v", err)
+		return
 	}
-	relations = append(relations, relation)
-	relation, err = db.repository.Link(assets[5], "port", assets[8])
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	_ = createRelations(createdAssets, db)
+
+	// The timestamps are stored with a precision of one second, so the ttl leaves a full second of slack.
+	time.Sleep(2500 * time.Millisecond)
+	fresh, err := db.Create(nil, "", &domain.FQDN{Name: "fresh.example.com"})
+	assert.NoError(t, err)
+
+	// the preview reports the stale assets without removing them
+	preview, err := db.PreviewEviction(2 * time.Second)
+	assert.NoError(t, err)
+	var staleIDs []string
+	for _, a := range createdAssets {
+		staleIDs = append(staleIDs, a.ID)
+	}
+	assert.ElementsMatch(t, staleIDs, preview)
+
+	all, err := db.AssetQuery("")
+	assert.NoError(t, err)
+	assert.Len(t, all, len(createdAssets)+1)
+
+	e := db.StartEvictor(2*time.Second, 50*time.Millisecond)
+	time.Sleep(500 * time.Millisecond)
+	e.Stop()
+
+	remaining, err := db.AssetQuery("")
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Asset{fresh}, remaining)
+
+	relations, err := db.RelationQuery("")
+	assert.NoError(t, err)
+	assert.Empty(t, relations)
+}
+
+// movableClock is a repository.Clock whose time is set by the test.
+type movableClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func (c *movableClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *movableClock) set(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = now
+}
+
+func TestEvictorClock(t *testing.T) {
+	graph, err := newGraph("local", "test.db")
 	if err != nil {
-		panic(err)
+		t.Errorf("%v", err)
+		return
 	}
-	relations = append(relations, relation)
+	defer teardownSqlite("test.db")
+	graph.Close()
 
-	return relations
+	clock := &movableClock{now: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)}
+	db := New(repository.SQLite, "test.db", repository.WithClock(clock))
+	defer db.Close()
+
+	a, err := db.Create(nil, "", &domain.FQDN{Name: "clock.example.com"})
+	assert.NoError(t, err)
+
+	// the asset is fresh by the clock of the repository, however long ago it was by the system time
+	preview, err := db.PreviewEviction(time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, preview)
+
+	clock.set(clock.Now().Add(2 * time.Hour))
+	preview, err = db.PreviewEviction(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{a.ID}, preview)
+
+	e := db.StartEvictor(time.Hour, 50*time.Millisecond)
+	time.Sleep(500 * time.Millisecond)
+	e.Stop()
+
+	remaining, err := db.AssetQuery("")
+	assert.NoError(t, err)
+	assert.Empty(t, remaining)
 }
 
-func createAssets(db *AssetDB) []*types.Asset {
-	// Create test assets
-	assets := []oam.Asset{
+func TestFindByContentAny(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+
+	constraints := []oam.Asset{
 		&domain.FQDN{Name: "example.com"},
 		&domain.FQDN{Name: "www.example.com"},
-		&domain.FQDN{Name: "www.example.org"},
-		&network.Netblock{CIDR: netip.MustParsePrefix("198.51.100.0/24"), Type: "IPv4"},
-		&network.Netblock{CIDR: netip.MustParsePrefix("2001:db8::/32"), Type: "IPv6"},
+		&domain.FQDN{Name: "example.com"},
 		&network.IPAddress{Address: netip.MustParseAddr("192.168.1.2"), Type: "IPv4"},
-		&network.IPAddress{Address: netip.MustParseAddr("2001:db8::1"), Type: "IPv6"},
-		&network.SocketAddress{Address: netip.MustParseAddrPort("192.168.1.1:80"), IPAddress: netip.MustParseAddr("192.168.1.1"), Port: 80, Protocol: "tcp"},
-		&network.SocketAddress{Address: netip.MustParseAddrPort("192.168.1.1:443"), IPAddress: netip.MustParseAddr("192.168.1.1"), Port: 443, Protocol: "tcp"},
-		&network.AutonomousSystem{Number: 12345},
-		&url.URL{Scheme: "https", Host: "example.com"},
-		&org.Organization{Name: "Example Inc."},
-		&people.Person{FullName: "John Doe"},
-		&oamreg.DomainRecord{Domain: "example.com"},
-		&contact.EmailAddress{Address: "test@example.com"},
-		&contact.Phone{Raw: "+1-555-555-5555"},
-		&contact.Location{Address: "123 Example St., Example, EX 12345"},
-		&oamtls.TLSCertificate{SerialNumber: "1234567890"},
-		&fingerprint.Fingerprint{Value: "fingerprint"},
-		&contact.ContactRecord{DiscoveredAt: "https://owasp.org"},
+		&domain.FQDN{Name: "missing.example.com"},
 	}
 
-	var createdAssets []*types.Asset
-	for _, asset := range assets {
-		createdAsset, err := db.Create(nil, "", asset)
-		if err != nil {
-			panic(err)
-		}
-		createdAssets = append(createdAssets, createdAsset)
+	results, err := db.FindByContentAny(constraints, time.Time{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []*types.Asset{createdAssets[0], createdAssets[1], createdAssets[5]}, results)
+
+	_, err = db.FindByContentAny([]oam.Asset{&domain.FQDN{Name: "missing.example.com"}}, time.Time{})
+	assert.Error(t, err)
+}
+
+func TestStats(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
 	}
-	return createdAssets
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createRelations(createdAssets, db)
+
+	stats, err := db.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), stats.Assets)
+	assert.Equal(t, int64(3), stats.AssetsByType[string(oam.FQDN)])
+	assert.Equal(t, int64(2), stats.AssetsByType[string(oam.IPAddress)])
+	assert.Equal(t, int64(5), stats.Relations)
+	assert.Equal(t, int64(1), stats.RelationsByType["a_record"])
+	assert.Greater(t, stats.Size, int64(0))
 }
 
-func teardownSqlite(dsn string) {
-	err := os.Remove(dsn)
+func TestAssetWithRelationCounts(t *testing.T) {
+	db, err := newGraph("local", "test.db")
 	if err != nil {
-		panic(err)
+		t.Errorf("%v", err)
+		return
 	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createRelations(createdAssets, db)
+
+	a, incoming, outgoing, err := db.AssetWithRelationCounts(createdAssets[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, createdAssets[0], a)
+	assert.Empty(t, incoming)
+	assert.Equal(t, map[string]int64{"node": 1, "a_record": 1, "aaaa_record": 1}, outgoing)
+
+	_, incoming, outgoing, err = db.AssetWithRelationCounts(createdAssets[6].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"aaaa_record": 1, "contains": 1}, incoming)
+	assert.Empty(t, outgoing)
+
+	_, _, _, err = db.AssetWithRelationCounts("999999")
+	assert.Error(t, err)
 }
 
-func newGraph(system, path string) (*AssetDB, error) {
-	var dsn string
-	var dbtype repository.DBType
+func TestError(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
 
-	switch system {
-	case "memory":
-		dbtype = repository.SQLite
-		dsn = fmt.Sprintf("file:sqlite%d?mode=memory&cache=shared", rand.Int31n(100))
-	case "local":
-		dbtype = repository.SQLite
-		dsn = path
-	case "postgres":
-		dbtype = repository.Postgres
-		dsn = path
-	default:
-		return nil, errors.New("newGraph: no valid database type provided")
+	fqdn, err := db.Create(nil, "", &domain.FQDN{Name: "errors.owasp.org"})
+	assert.NoError(t, err)
+
+	// an FQDN cannot hold the port relation to an IP address in the taxonomy
+	_, err = db.Create(fqdn, "port", &network.IPAddress{Address: netip.MustParseAddr("192.0.2.1"), Type: "IPv4"})
+	var opErr *Error
+	if assert.ErrorAs(t, err, &opErr) {
+		assert.Equal(t, "Create", opErr.Op)
+		assert.Equal(t, oam.IPAddress, opErr.AssetType)
+		assert.Contains(t, err.Error(), "assetdb: Create IPAddress: ")
 	}
 
-	store := New(dbtype, dsn)
-	if store == nil {
-		return nil, errors.New("newGraph: failed to create the new database")
+	_, err = db.FindByExternalID(oam.FQDN, "missing", time.Time{})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	if assert.ErrorAs(t, err, &opErr) {
+		assert.Equal(t, "FindByExternalID", opErr.Op)
+		assert.Equal(t, oam.FQDN, opErr.AssetType)
 	}
 
-	var name string
-	var fs embed.FS
-	var database gorm.Dialector
-	switch dbtype {
-	case repository.SQLite:
-		name = "sqlite3"
-		fs = sqlitemigrations.Migrations()
-		database = sqlite.Open(dsn)
-	case repository.Postgres:
-		name = "postgres"
-		fs = pgmigrations.Migrations()
-		database = postgres.Open(dsn)
+	_, err = db.FindByTypes(nil, time.Time{})
+	if assert.ErrorAs(t, err, &opErr) {
+		assert.Equal(t, "FindByTypes", opErr.Op)
+		assert.Contains(t, err.Error(), "assetdb: FindByTypes: ")
 	}
 
-	sql, err := gorm.Open(database, &gorm.Config{})
-	if err != nil {
-		return nil, err
+	_, err = db.FindByJSONPath(oam.FQDN, "", "value", time.Time{})
+	if assert.ErrorAs(t, err, &opErr) {
+		assert.Equal(t, "FindByJSONPath", opErr.Op)
+		assert.Equal(t, oam.FQDN, opErr.AssetType)
 	}
 
-	migrationsSource := migrate.EmbedFileSystemMigrationSource{
-		FileSystem: fs,
-		Root:       "/",
+	_, err = db.Link(fqdn, "port", fqdn)
+	if assert.ErrorAs(t, err, &opErr) {
+		assert.Equal(t, "Link", opErr.Op)
+		assert.Equal(t, oam.FQDN, opErr.AssetType)
 	}
 
-	sqlDb, err := sql.DB()
-	if err != nil {
-		return nil, err
+	_, err = db.FindById("missing", time.Time{})
+	if assert.ErrorAs(t, err, &opErr) {
+		assert.Equal(t, "FindById", opErr.Op)
+		assert.Empty(t, opErr.AssetType)
 	}
 
-	_, err = migrate.Exec(sqlDb, name, migrationsSource, migrate.Up)
-	if err != nil {
-		return nil, err
+	err = db.ReplaceOutgoingRelations(fqdn, "port", []*types.Asset{fqdn})
+	if assert.ErrorAs(t, err, &opErr) {
+		assert.Equal(t, "ReplaceOutgoingRelations", opErr.Op)
+		assert.Equal(t, oam.FQDN, opErr.AssetType)
 	}
-	return store, nil
-}
 
-type mockAssetDB struct {
-	mock.Mock
+	err = opError("Stats", "", errors.New("cause"))
+	assert.Equal(t, "assetdb: Stats: cause", err.Error())
+	assert.NoError(t, opError("Stats", "", nil))
 }
 
-func (m *mockAssetDB) Close() error {
-	return nil
-}
+func TestRelationTypeCounts(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
 
-func (m *mockAssetDB) GetDBType() string {
-	args := m.Called()
-	return args.String(0)
-}
+	createdAssets := createAssets(db)
+	createRelations(createdAssets, db)
 
-func (m *mockAssetDB) CreateAsset(asset oam.Asset) (*types.Asset, error) {
-	args := m.Called(asset)
-	return args.Get(0).(*types.Asset), args.Error(1)
-}
+	outgoing, err := db.OutgoingRelationTypeCounts(createdAssets[0], time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"node": 1, "a_record": 1, "aaaa_record": 1}, outgoing)
 
-func (m *mockAssetDB) UpdateAssetLastSeen(id string) error {
-	args := m.Called(id)
-	return args.Error(0)
-}
+	incoming, err := db.IncomingRelationTypeCounts(createdAssets[0], time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, incoming)
 
-func (m *mockAssetDB) DeleteAsset(id string) error {
-	args := m.Called(id)
-	return args.Error(0)
-}
+	incoming, err = db.IncomingRelationTypeCounts(createdAssets[6], time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"aaaa_record": 1, "contains": 1}, incoming)
 
-func (m *mockAssetDB) DeleteRelation(id string) error {
-	args := m.Called(id)
-	return args.Error(0)
-}
+	outgoing, err = db.OutgoingRelationTypeCounts(createdAssets[0], time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, outgoing)
 
-func (m *mockAssetDB) FindAssetById(id string, since time.Time) (*types.Asset, error) {
-	args := m.Called(id, since)
-	return args.Get(0).(*types.Asset), args.Error(1)
+	_, err = db.OutgoingRelationTypeCounts(&types.Asset{ID: "not-an-id"}, time.Time{})
+	assert.Error(t, err)
 }
 
-func (m *mockAssetDB) FindAssetByContent(asset oam.Asset, since time.Time) ([]*types.Asset, error) {
-	args := m.Called(asset, since)
-	return args.Get(0).([]*types.Asset), args.Error(1)
-}
+func TestDefaultSince(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
 
-func (m *mockAssetDB) FindAssetByScope(constraints []oam.Asset, since time.Time) ([]*types.Asset, error) {
-	args := m.Called(constraints, since)
-	return args.Get(0).([]*types.Asset), args.Error(1)
-}
+	stale := &domain.FQDN{Name: "stale.owasp.org"}
+	_, err = db.repository.ImportAsset(&types.Asset{
+		CreatedAt: time.Now().Add(-72 * time.Hour),
+		LastSeen:  time.Now().Add(-48 * time.Hour),
+		Asset:     stale,
+	})
+	assert.NoError(t, err)
+	fresh, err := db.Create(nil, "", &domain.FQDN{Name: "fresh.owasp.org"})
+	assert.NoError(t, err)
 
-func (m *mockAssetDB) FindAssetByType(atype oam.AssetType, since time.Time) ([]*types.Asset, error) {
-	args := m.Called(atype, since)
-	return args.Get(0).([]*types.Asset), args.Error(1)
-}
+	windowed := New(repository.SQLite, "test.db", repository.WithDefaultSince(24*time.Hour))
+	defer windowed.Close()
 
-func (m *mockAssetDB) Link(source *types.Asset, relation string, destination *types.Asset) (*types.Relation, error) {
+	found, err := windowed.FindByType(oam.FQDN, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, fresh.ID, found[0].ID)
+	}
+
+	found, err = windowed.FindByContent(stale, time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+
+	// an explicit since takes precedence over the window
+	found, err = windowed.FindByContent(stale, time.Now().Add(-96*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+
+	// without a window, a zero since returns the full history
+	found, err = db.FindByType(oam.FQDN, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+}
+
+func TestFindByJSONPath(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+
+	// fields that are not part of the asset are kept in the stored content, and can be nested
+	err = db.RawQuery(`INSERT INTO assets (type, content) VALUES
+		('FQDN', '{"name":"nested.example.com","meta":{"owner":{"team":"red"},"port":443}}'),
+		('FQDN', '{"name":"other.example.com","meta":{"owner":{"team":"blue"},"port":80}}')`, nil)
+	assert.NoError(t, err)
+
+	found, err := db.FindByJSONPath(oam.FQDN, "meta.owner.team", "red", time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "nested.example.com", found[0].Asset.Key())
+	}
+
+	found, err = db.FindByJSONPath(oam.FQDN, "meta.port", 80, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "other.example.com", found[0].Asset.Key())
+	}
+
+	found, err = db.FindByJSONPath(oam.FQDN, "name", "www.example.com", time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Asset{createdAssets[1]}, found)
+
+	_, err = db.FindByJSONPath(oam.FQDN, "meta.owner.team", "green", time.Time{})
+	assert.Error(t, err)
+
+	_, err = db.FindByJSONPath(oam.FQDN, "meta..team", "red", time.Time{})
+	assert.Error(t, err)
+}
+
+func TestDeleteRelations(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createdRelations := createRelations(createdAssets, db)
+
+	ids := []string{createdRelations[0].ID, createdRelations[2].ID, "999999"}
+	count, err := db.DeleteRelations(ids)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	relations, err := db.RelationQuery("")
+	assert.NoError(t, err)
+	assert.Len(t, relations, len(createdRelations)-2)
+
+	_, err = db.DeleteRelations([]string{"not-an-id"})
+	assert.Error(t, err)
+}
+
+func TestForEachRelation(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createdRelations := createRelations(createdAssets, db)
+
+	var visited []*types.Relation
+	err = db.ForEachRelation("", time.Time{}, func(rel *types.Relation) error {
+		visited = append(visited, rel)
+		return nil
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, visited, len(createdRelations)) {
+		for i, rel := range visited {
+			assert.Equal(t, createdRelations[i].ID, rel.ID)
+			assert.Equal(t, createdRelations[i].FromAsset.ID, rel.FromAsset.ID)
+			assert.Equal(t, createdRelations[i].ToAsset.ID, rel.ToAsset.ID)
+		}
+	}
+
+	visited = nil
+	err = db.ForEachRelation("port", time.Time{}, func(rel *types.Relation) error {
+		visited = append(visited, rel)
+		return nil
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, visited, 1) {
+		assert.Equal(t, createdRelations[4].ID, visited[0].ID)
+		assert.Equal(t, createdAssets[5].Asset, visited[0].FromAsset.Asset)
+		assert.Equal(t, createdAssets[8].Asset, visited[0].ToAsset.Asset)
+	}
+
+	stop := errors.New("stop")
+	var calls int
+	err = db.ForEachRelation("", time.Time{}, func(rel *types.Relation) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func TestObservations(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	low, err := db.Create(nil, "", &source.Source{Name: "LowConfidence", Confidence: 20})
+	assert.NoError(t, err)
+	high, err := db.Create(nil, "", &source.Source{Name: "HighConfidence", Confidence: 90})
+	assert.NoError(t, err)
+
+	fqdn, err := db.CreateWithObservation(&domain.FQDN{Name: "www.example.com"}, low, 20)
+	assert.NoError(t, err)
+	_, err = db.CreateWithObservation(&domain.FQDN{Name: "www.example.com"}, high, 90)
+	assert.NoError(t, err)
+
+	observations, err := db.Observations(fqdn, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, observations, 2) {
+		assert.Equal(t, high.ID, observations[0].ToAsset.ID)
+		assert.Equal(t, 90, observations[0].Confidence)
+		assert.Equal(t, low.ID, observations[1].ToAsset.ID)
+		assert.Equal(t, 20, observations[1].Confidence)
+	}
+
+	// a later observation updates the confidence of the existing relation
+	_, err = db.CreateWithObservation(&domain.FQDN{Name: "www.example.com"}, low, 95)
+	assert.NoError(t, err)
+
+	observations, err = db.Observations(fqdn, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, observations, 2) {
+		assert.Equal(t, low.ID, observations[0].ToAsset.ID)
+		assert.Equal(t, 95, observations[0].Confidence)
+	}
+}
+
+func TestFindWithRelation(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	_ = createRelations(createdAssets, db)
+
+	// only example.com has outgoing a_record relations
+	outs, err := db.FindWithOutgoingRelation(oam.FQDN, "a_record", time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Asset{createdAssets[0]}, outs)
+
+	outs, err = db.FindWithOutgoingRelation(oam.FQDN, "port", time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, outs)
+
+	// 2001:db8::1 is the target of the aaaa_record and contains relations
+	ins, err := db.FindWithIncomingRelation(oam.IPAddress, "contains", time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Asset{createdAssets[6]}, ins)
+
+	ins, err = db.FindWithIncomingRelation(oam.IPAddress, "a_record", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, ins)
+}
+
+func TestFindByTypeFromSource(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	dns, err := db.Create(nil, "", &source.Source{Name: "DNS", Confidence: 100})
+	assert.NoError(t, err)
+	crawler, err := db.Create(nil, "", &source.Source{Name: "Crawler", Confidence: 50})
+	assert.NoError(t, err)
+
+	www, err := db.CreateWithObservation(&domain.FQDN{Name: "www.example.com"}, dns, 100)
+	assert.NoError(t, err)
+	_, err = db.CreateWithObservation(&domain.FQDN{Name: "mail.example.com"}, crawler, 50)
+	assert.NoError(t, err)
+	_, err = db.CreateWithObservation(&network.IPAddress{Address: netip.MustParseAddr("192.168.1.2"), Type: "IPv4"}, dns, 100)
+	assert.NoError(t, err)
+
+	found, err := db.FindByTypeFromSource(oam.FQDN, "DNS", time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Asset{www}, found)
+
+	found, err = db.FindByTypeFromSource(oam.FQDN, "Unknown", time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestSubscribe(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	assets, unsubscribe := db.Subscribe()
+
+	first, err := db.Create(nil, "", &domain.FQDN{Name: "www.example.com"})
+	assert.NoError(t, err)
+	// storing the same asset again does not create a new row
+	_, err = db.Create(nil, "", &domain.FQDN{Name: "www.example.com"})
+	assert.NoError(t, err)
+	second, err := db.Create(nil, "", &domain.FQDN{Name: "mail.example.com"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, first, <-assets)
+	assert.Equal(t, second, <-assets)
+	assert.Empty(t, assets)
+
+	// assets are dropped once the buffer of a slow subscriber is full
+	for i := 0; i < SubscriptionBuffer+10; i++ {
+		_, err := db.Create(nil, "", &domain.FQDN{Name: fmt.Sprintf("www%d.example.com", i)})
+		assert.NoError(t, err)
+	}
+	assert.Len(t, assets, SubscriptionBuffer)
+
+	unsubscribe()
+	unsubscribe()
+
+	var received int
+	for range assets {
+		received++
+	}
+	assert.Equal(t, SubscriptionBuffer, received)
+}
+
+func TestSubscribeChanges(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := db.SubscribeChanges(ctx)
+	assert.NoError(t, err)
+
+	// SQLite falls back to the in-process feed, which only delivers the created assets
+	parent, err := db.Create(nil, "", &domain.FQDN{Name: "example.com"})
+	assert.NoError(t, err)
+	child, err := db.Create(parent, "node", &domain.FQDN{Name: "www.example.com"})
+	assert.NoError(t, err)
+
+	for _, a := range []*types.Asset{parent, child} {
+		select {
+		case c := <-changes:
+			assert.Equal(t, &types.Change{Table: "assets", ID: a.ID, Type: string(oam.FQDN)}, c)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the change was not delivered")
+		}
+	}
+
+	cancel()
+	for range changes {
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createdRelations := createRelations(createdAssets, db)
+
+	ro := New(repository.SQLite, "test.db", repository.WithReadOnly())
+	defer ro.Close()
+
+	found, err := ro.FindByContent(createdAssets[0].Asset, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.Asset{createdAssets[0]}, found)
+	rels, err := ro.OutgoingRelations(createdAssets[0], time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, rels, 3)
+	_, err = ro.Stats()
+	assert.NoError(t, err)
+
+	_, err = ro.Create(nil, "", &domain.FQDN{Name: "readonly.example.com"})
+	assert.ErrorIs(t, err, repository.ErrReadOnly)
+	_, _, err = ro.CreateOrUpdate(createdAssets[0].Asset)
+	assert.ErrorIs(t, err, repository.ErrReadOnly)
+	_, err = ro.Link(createdAssets[1], "node", createdAssets[0])
+	assert.ErrorIs(t, err, repository.ErrReadOnly)
+	assert.ErrorIs(t, ro.UpdateAssetLastSeen(createdAssets[0].ID), repository.ErrReadOnly)
+	assert.ErrorIs(t, ro.DeleteRelation(createdRelations[0].ID), repository.ErrReadOnly)
+	assert.ErrorIs(t, ro.DeleteAsset(createdAssets[0].ID), repository.ErrReadOnly)
+	// the writes issued through RawQuery are rejected by the database itself
+	assert.Error(t, ro.RawQuery("DELETE FROM assets", nil))
+
+	// nothing was written through the read-only database
+	found, err = db.FindByContent(&domain.FQDN{Name: "readonly.example.com"}, time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+	stats, err := db.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(createdAssets)), stats.Assets)
+	assert.Equal(t, int64(len(createdRelations)), stats.Relations)
+}
+
+func TestCreateWithRaw(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	parent, err := db.Create(nil, "", &domain.FQDN{Name: "owasp.org"})
+	assert.NoError(t, err)
+
+	header := []byte("HTTP/1.1 200 OK\r\nServer: nginx\r\n")
+	a, err := db.CreateWithRaw(parent, "node", &domain.FQDN{Name: "www.owasp.org"}, header)
+	assert.NoError(t, err)
+
+	raw, err := db.FindRawById(a.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, header, raw)
+
+	rels, err := db.OutgoingRelations(parent, time.Time{}, "node")
+	assert.NoError(t, err)
+	assert.Len(t, rels, 1)
+
+	// assets created without raw data have none to fetch
+	_, err = db.FindRawById(parent.ID)
+	assert.Error(t, err)
+}
+
+func TestOrdered(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	for _, name := range []string{"www.owasp.org", "api.owasp.org", "owasp.org"} {
+		_, err := db.Create(nil, "", &domain.FQDN{Name: name})
+		assert.NoError(t, err)
+	}
+
+	var names []string
+	found, err := db.FindByTypeOrdered(oam.FQDN, time.Time{}, repository.Order{Field: repository.OrderByKey})
+	assert.NoError(t, err)
+	for _, a := range found {
+		names = append(names, a.Asset.Key())
+	}
+	assert.Equal(t, []string{"api.owasp.org", "owasp.org", "www.owasp.org"}, names)
+
+	found, err = db.FindByTypeOrdered(oam.FQDN, time.Time{}, repository.Order{Field: repository.OrderByID, Desc: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "2", "1"}, []string{found[0].ID, found[1].ID, found[2].ID})
+
+	parent, err := db.FindByContent(&domain.FQDN{Name: "owasp.org"}, time.Time{})
+	assert.NoError(t, err)
+	for _, name := range []string{"www.owasp.org", "api.owasp.org"} {
+		_, err := db.Create(parent[0], "node", &domain.FQDN{Name: name})
+		assert.NoError(t, err)
+	}
+
+	rels, err := db.OutgoingRelationsOrdered(parent[0], time.Time{}, repository.Order{Field: repository.OrderByCreatedAt, Desc: true}, "node")
+	assert.NoError(t, err)
+	assert.Len(t, rels, 2)
+	assert.Equal(t, "2", rels[0].ToAsset.ID)
+
+	_, err = db.OutgoingRelationsOrdered(parent[0], time.Time{}, repository.Order{Field: repository.OrderByKey})
+	assert.Error(t, err)
+
+	found, err = db.FindByScopeOrdered([]oam.Asset{&domain.FQDN{Name: "owasp.org"}}, time.Time{}, repository.Order{Field: repository.OrderByKey, Desc: true})
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.Equal(t, "www.owasp.org", found[0].Asset.Key())
+}
+
+func TestReplaceOutgoingRelations(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	fqdn, err := db.Create(nil, "", &domain.FQDN{Name: "www.owasp.org"})
+	assert.NoError(t, err)
+
+	var ips []*types.Asset
+	for _, addr := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		ip, err := db.Create(nil, "", &network.IPAddress{Address: netip.MustParseAddr(addr), Type: "IPv4"})
+		assert.NoError(t, err)
+		ips = append(ips, ip)
+	}
+
+	toAssets := func() []string {
+		rels, err := db.OutgoingRelations(fqdn, time.Time{}, "a_record")
+		assert.NoError(t, err)
+
+		var ids []string
+		for _, rel := range rels {
+			ids = append(ids, rel.ToAsset.ID)
+		}
+		return ids
+	}
+
+	assert.NoError(t, db.ReplaceOutgoingRelations(fqdn, "a_record", ips[:2]))
+	assert.ElementsMatch(t, []string{ips[0].ID, ips[1].ID}, toAssets())
+
+	assert.NoError(t, db.ReplaceOutgoingRelations(fqdn, "a_record", ips[1:]))
+	assert.ElementsMatch(t, []string{ips[1].ID, ips[2].ID}, toAssets())
+
+	// relations that are not valid in the taxonomy leave the existing relations in place
+	assert.Error(t, db.ReplaceOutgoingRelations(fqdn, "a_record", []*types.Asset{fqdn}))
+	assert.ElementsMatch(t, []string{ips[1].ID, ips[2].ID}, toAssets())
+
+	assert.NoError(t, db.ReplaceOutgoingRelations(fqdn, "a_record", nil))
+	assert.Empty(t, toAssets())
+}
+
+func TestFindByTypes(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+
+	found, err := db.FindByTypes([]oam.AssetType{oam.IPAddress, oam.FQDN}, time.Time{})
+	assert.NoError(t, err)
+	// the assets are ordered by ID regardless of the order of the types
+	assert.Equal(t, []*types.Asset{
+		createdAssets[0], createdAssets[1], createdAssets[2], createdAssets[5], createdAssets[6],
+	}, found)
+
+	_, err = db.FindByTypes([]oam.AssetType{oam.Service}, time.Time{})
+	assert.Error(t, err)
+
+	_, err = db.FindByTypes(nil, time.Time{})
+	assert.Error(t, err)
+}
+
+func TestRecentlyChanged(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	found, err := db.RecentlyChanged(5)
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+
+	createdAssets := createAssets(db)
+	seen := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	latest, err := db.repository.ImportAsset(&types.Asset{
+		CreatedAt: seen,
+		LastSeen:  seen,
+		Asset:     &domain.FQDN{Name: "latest.example.com"},
+	})
+	assert.NoError(t, err)
+
+	found, err = db.RecentlyChanged(3)
+	assert.NoError(t, err)
+	if assert.Len(t, found, 3) {
+		assert.Equal(t, latest.ID, found[0].ID)
+		// the assets created within the same second are ordered by their ID, newest first
+		n := len(createdAssets)
+		assert.Equal(t, createdAssets[n-1].ID, found[1].ID)
+		assert.Equal(t, createdAssets[n-2].ID, found[2].ID)
+	}
+
+	_, err = db.RecentlyChanged(0)
+	assert.Error(t, err)
+}
+
+func TestStalestByType(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	found, err := db.StalestByType(oam.FQDN, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+
+	createdAssets := createAssets(db)
+	seen := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	stalest, err := db.repository.ImportAsset(&types.Asset{
+		CreatedAt: seen,
+		LastSeen:  seen,
+		Asset:     &domain.FQDN{Name: "stalest.example.com"},
+	})
+	assert.NoError(t, err)
+
+	found, err = db.StalestByType(oam.FQDN, 3)
+	assert.NoError(t, err)
+	if assert.Len(t, found, 3) {
+		assert.Equal(t, stalest.ID, found[0].ID)
+		// the assets created within the same second are ordered by their ID, oldest first
+		assert.Equal(t, createdAssets[0].ID, found[1].ID)
+		assert.Equal(t, createdAssets[1].ID, found[2].ID)
+	}
+
+	found, err = db.StalestByType(oam.FQDN, 10)
+	assert.NoError(t, err)
+	assert.Len(t, found, 4)
+
+	_, err = db.StalestByType(oam.FQDN, 0)
+	assert.Error(t, err)
+}
+
+func TestFindDuplicates(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+
+	groups, err := db.FindDuplicates(oam.FQDN)
+	assert.NoError(t, err)
+	assert.Empty(t, groups)
+
+	// rows stored without a hash are not covered by the unique index
+	err = db.RawQuery(`INSERT INTO assets (type, content) VALUES
+		('FQDN', '{"name":"www.example.com"}'), ('FQDN', '{"name":"dup.example.com"}'),
+		('FQDN', '{"name":"dup.example.com"}'), ('AutonomousSystem', '{"number":12345}')`, nil)
+	assert.NoError(t, err)
+
+	groups, err = db.FindDuplicates(oam.FQDN)
+	assert.NoError(t, err)
+	if assert.Len(t, groups, 2) {
+		if assert.Len(t, groups[0], 2) {
+			assert.Equal(t, createdAssets[1].ID, groups[0][0].ID)
+			assert.Equal(t, createdAssets[1].Asset, groups[0][1].Asset)
+		}
+		if assert.Len(t, groups[1], 2) {
+			assert.Equal(t, &domain.FQDN{Name: "dup.example.com"}, groups[1][0].Asset)
+			assert.Equal(t, &domain.FQDN{Name: "dup.example.com"}, groups[1][1].Asset)
+		}
+	}
+
+	// numeric key fields are grouped as well
+	groups, err = db.FindDuplicates(oam.AutonomousSystem)
+	assert.NoError(t, err)
+	if assert.Len(t, groups, 1) && assert.Len(t, groups[0], 2) {
+		assert.Equal(t, createdAssets[9].ID, groups[0][0].ID)
+	}
+
+	_, err = db.FindDuplicates("Unknown")
+	assert.Error(t, err)
+}
+
+func TestAllRelations(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createdRelations := createRelations(createdAssets, db)
+
+	// the IPv6 address is pointed to by the FQDN and the netblock
+	relations, directions, err := db.AllRelations(createdAssets[6], time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, relations, 2) && assert.Len(t, directions, 2) {
+		assert.Equal(t, createdRelations[2].ID, relations[0].ID)
+		assert.Equal(t, createdRelations[3].ID, relations[1].ID)
+		assert.Equal(t, []types.Direction{types.Incoming, types.Incoming}, directions)
+	}
+
+	// the IPv4 address is pointed to by the FQDN and points to the port
+	relations, directions, err = db.AllRelations(createdAssets[5], time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, relations, 2) {
+		assert.Equal(t, createdRelations[1].ID, relations[0].ID)
+		assert.Equal(t, createdRelations[4].ID, relations[1].ID)
+		assert.Equal(t, []types.Direction{types.Incoming, types.Outgoing}, directions)
+	}
+
+	relations, directions, err = db.AllRelations(createdAssets[5], time.Time{}, "port")
+	assert.NoError(t, err)
+	if assert.Len(t, relations, 1) {
+		assert.Equal(t, createdRelations[4].ID, relations[0].ID)
+		assert.Equal(t, []types.Direction{types.Outgoing}, directions)
+	}
+}
+
+func TestCertificateChain(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	root, err := db.Create(nil, "", &oamtls.TLSCertificate{
+		SerialNumber:      "03",
+		SubjectCommonName: "Root CA",
+		IssuerCommonName:  "Root CA",
+		IsCA:              true,
+	})
+	assert.NoError(t, err)
+	intermediate, err := db.Create(nil, "", &oamtls.TLSCertificate{
+		SerialNumber:      "02",
+		SubjectCommonName: "Intermediate CA",
+		IssuerCommonName:  "Root CA",
+		IsCA:              true,
+	})
+	assert.NoError(t, err)
+	leaf, err := db.Create(nil, "", &oamtls.TLSCertificate{
+		SerialNumber:      "01",
+		SubjectCommonName: "www.example.com",
+		IssuerCommonName:  "Intermediate CA",
+	})
+	assert.NoError(t, err)
+
+	_, err = db.Create(leaf, "issuing_certificate", intermediate.Asset)
+	assert.NoError(t, err)
+	_, err = db.Create(intermediate, "issuing_certificate", root.Asset)
+	assert.NoError(t, err)
+	// the root names itself as its issuer, which must not be followed
+	_, err = db.Create(root, "issuing_certificate", root.Asset)
+	assert.NoError(t, err)
+
+	chain, err := db.CertificateChain(leaf, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, chain, 3) {
+		assert.Equal(t, leaf.ID, chain[0].ID)
+		assert.Equal(t, intermediate.ID, chain[1].ID)
+		assert.Equal(t, root.ID, chain[2].ID)
+	}
+
+	chain, err = db.CertificateChain(leaf, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, chain, 2) {
+		assert.Equal(t, intermediate.ID, chain[1].ID)
+	}
+
+	chain, err = db.CertificateChain(intermediate, 0)
+	assert.NoError(t, err)
+	assert.Len(t, chain, 1)
+
+	capped := New(repository.SQLite, "test.db", repository.WithMaxTraversalNodes(1))
+	defer capped.Close()
+
+	chain, err = capped.CertificateChain(leaf, 10)
+	assert.ErrorIs(t, err, repository.ErrTraversalTruncated)
+	if assert.Len(t, chain, 2) {
+		assert.Equal(t, intermediate.ID, chain[1].ID)
+	}
+	chain, err = capped.CertificateChain(intermediate, 10)
+	assert.NoError(t, err)
+	assert.Len(t, chain, 2)
+
+	fqdn, err := db.Create(nil, "", &domain.FQDN{Name: "www.example.com"})
+	assert.NoError(t, err)
+	_, err = db.CertificateChain(fqdn, 10)
+	assert.Error(t, err)
+	_, err = db.CertificateChain(leaf, -1)
+	assert.Error(t, err)
+}
+
+func TestExpand(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createdRelations := createRelations(createdAssets, db)
+
+	// the domain resolves to the addresses, and the IPv4 address holds the port
+	levels, err := db.Expand(createdAssets[0], types.Outgoing, 2, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, levels, 2) {
+		if assert.Len(t, levels[0], 3) {
+			for i, rel := range levels[0] {
+				assert.Equal(t, createdRelations[i].ID, rel.ID)
+			}
+			assert.Equal(t, createdAssets[1].Asset, levels[0][0].ToAsset.Asset)
+		}
+		if assert.Len(t, levels[1], 1) {
+			assert.Equal(t, createdRelations[4].ID, levels[1][0].ID)
+			assert.Equal(t, createdAssets[8].Asset, levels[1][0].ToAsset.Asset)
+		}
+	}
+
+	levels, err = db.Expand(createdAssets[0], types.Outgoing, 1, time.Time{}, "a_record")
+	assert.NoError(t, err)
+	if assert.Len(t, levels, 1) && assert.Len(t, levels[0], 1) {
+		assert.Equal(t, createdRelations[1].ID, levels[0][0].ID)
+	}
+
+	// the expansion ends at the first hop without relations
+	levels, err = db.Expand(createdAssets[8], types.Incoming, 3, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, levels, 2) {
+		assert.Equal(t, createdAssets[5].ID, levels[0][0].FromAsset.ID)
+		assert.Equal(t, createdAssets[0].ID, levels[1][0].FromAsset.ID)
+	}
+
+	// assets already reached are not followed again
+	_, err = db.Link(createdAssets[1], "cname_record", createdAssets[0])
+	assert.NoError(t, err)
+	levels, err = db.Expand(createdAssets[0], types.Outgoing, repository.MaxExpandDepth, time.Time{}, "node", "cname_record")
+	assert.NoError(t, err)
+	assert.Len(t, levels, 2)
+
+	levels, err = db.Expand(createdAssets[0], types.Outgoing, 2, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, levels)
+
+	_, err = db.Expand(createdAssets[0], types.Outgoing, 0, time.Time{})
+	assert.Error(t, err)
+	_, err = db.Expand(createdAssets[0], types.Outgoing, repository.MaxExpandDepth+1, time.Time{})
+	assert.Error(t, err)
+	_, err = db.Expand(createdAssets[0], "sideways", 1, time.Time{})
+	assert.Error(t, err)
+}
+
+func TestFindExisting(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+
+	discovered := []oam.Asset{
+		&domain.FQDN{Name: "example.com"},
+		&domain.FQDN{Name: "new.example.com"},
+		&network.IPAddress{Address: netip.MustParseAddr("192.168.1.2"), Type: "IPv4"},
+		&domain.FQDN{Name: "WWW.EXAMPLE.COM"},
+		&domain.FQDN{Name: "example.com"},
+	}
+	existing, err := db.FindExisting(discovered, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, existing, len(discovered)) {
+		assert.Equal(t, createdAssets[0].ID, existing[0].ID)
+		assert.Nil(t, existing[1])
+		assert.Equal(t, createdAssets[5].ID, existing[2].ID)
+		assert.Equal(t, createdAssets[1].ID, existing[3].ID)
+		assert.Equal(t, createdAssets[0].ID, existing[4].ID)
+	}
+
+	existing, err = db.FindExisting(discovered, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, make([]*types.Asset, len(discovered)), existing)
+}
+
+func TestPartitionExisting(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+
+	discovered := []oam.Asset{
+		&domain.FQDN{Name: "new.example.com"},
+		&domain.FQDN{Name: "example.com"},
+		&network.IPAddress{Address: netip.MustParseAddr("192.168.1.2"), Type: "IPv4"},
+		&network.IPAddress{Address: netip.MustParseAddr("192.168.1.250"), Type: "IPv4"},
+	}
+	existing, missing, err := db.PartitionExisting(discovered)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{createdAssets[0].ID, createdAssets[5].ID}, assetIDs(existing))
+	assert.Equal(t, []oam.Asset{discovered[0], discovered[3]}, missing)
+
+	existing, missing, err = db.PartitionExisting(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, existing)
+	assert.Empty(t, missing)
+}
+
+func TestNeighborsByType(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createRelations(createdAssets, db)
+
+	apex := createdAssets[0]
+	ipv4 := createdAssets[5]
+	ipv6 := createdAssets[6]
+	// a second relation to the same address returns the address once
+	_, err = db.Link(apex, "aaaa_record", ipv4)
+	assert.NoError(t, err)
+
+	neighbors, err := db.NeighborsByType(apex, oam.IPAddress, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ipv4.ID, ipv6.ID}, assetIDs(neighbors))
+	assert.Equal(t, ipv4.Asset, neighbors[0].Asset)
+
+	neighbors, err = db.NeighborsByType(apex, oam.IPAddress, time.Time{}, "aaaa_record")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ipv4.ID, ipv6.ID}, assetIDs(neighbors))
+
+	neighbors, err = db.NeighborsByType(apex, oam.IPAddress, time.Time{}, "a_record")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ipv4.ID}, assetIDs(neighbors))
+
+	neighbors, err = db.NeighborsByType(apex, oam.FQDN, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{createdAssets[1].ID}, assetIDs(neighbors))
+
+	// an empty type returns the neighbors of any type
+	neighbors, err = db.NeighborsByType(apex, "", time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{createdAssets[1].ID, ipv4.ID, ipv6.ID}, assetIDs(neighbors))
+
+	// incoming relations are not followed
+	neighbors, err = db.NeighborsByType(ipv6, oam.FQDN, time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, neighbors)
+
+	neighbors, err = db.NeighborsByType(apex, oam.IPAddress, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, neighbors)
+}
+
+func TestAssetsInAS(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	_ = createRelations(createdAssets, db)
+
+	for _, link := range []struct {
+		from, to int
+		relation string
+	}{
+		{9, 3, "announces"},
+		{9, 4, "announces"},
+		{4, 5, "contains"},
+		{4, 6, "contains"},
+	} {
+		_, err := db.Link(createdAssets[link.from], link.relation, createdAssets[link.to])
+		assert.NoError(t, err)
+	}
+
+	ips, err := db.AssetsInAS(12345, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{createdAssets[5].ID, createdAssets[6].ID}, assetIDs(ips))
+
+	ips, err = db.AssetsInAS(64512, time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, ips)
+
+	ips, err = db.AssetsInAS(12345, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, ips)
+}
+
+func TestTransitiveClosure(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createRelations(createdAssets, db)
+
+	apex := createdAssets[0]
+	www := createdAssets[1]
+	a, err := db.Create(www, "node", &domain.FQDN{Name: "a.www.example.com"})
+	assert.NoError(t, err)
+	b, err := db.Create(a, "node", &domain.FQDN{Name: "b.a.www.example.com"})
+	assert.NoError(t, err)
+	// a second path and a cycle back to the apex
+	_, err = db.Link(apex, "node", a)
+	assert.NoError(t, err)
+	_, err = db.Link(b, "node", apex)
+	assert.NoError(t, err)
+
+	reached, err := db.TransitiveClosure(apex, "node", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{www.ID, a.ID}, assetIDs(reached))
+
+	reached, err = db.TransitiveClosure(apex, "node", repository.MaxClosureDepth)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{www.ID, a.ID, b.ID}, assetIDs(reached))
+	assert.Equal(t, &domain.FQDN{Name: "b.a.www.example.com"}, reached[2].Asset)
+
+	reached, err = db.TransitiveClosure(www, "node", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{a.ID, b.ID}, assetIDs(reached))
+
+	// only the relation type provided is followed
+	reached, err = db.TransitiveClosure(apex, "a_record", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{createdAssets[5].ID}, assetIDs(reached))
+
+	reached, err = db.TransitiveClosure(createdAssets[8], "node", 3)
+	assert.NoError(t, err)
+	assert.Empty(t, reached)
+
+	_, err = db.TransitiveClosure(apex, "node", 0)
+	assert.Error(t, err)
+	_, err = db.TransitiveClosure(apex, "node", repository.MaxClosureDepth+1)
+	assert.Error(t, err)
+}
+
+func TestRelationsBetween(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createdRelations := createRelations(createdAssets, db)
+
+	// link the subdomain back to the domain, so the assets are linked in both directions
+	back, err := db.repository.Link(createdAssets[1], "cname_record", createdAssets[0])
+	assert.NoError(t, err)
+
+	for _, ids := range [][2]string{{createdAssets[0].ID, createdAssets[1].ID}, {createdAssets[1].ID, createdAssets[0].ID}} {
+		relations, err := db.RelationsBetween(ids[0], ids[1], time.Time{})
+		assert.NoError(t, err)
+		if assert.Len(t, relations, 2) {
+			assert.Equal(t, createdRelations[0].ID, relations[0].ID)
+			assert.Equal(t, createdAssets[0].Asset, relations[0].FromAsset.Asset)
+			assert.Equal(t, createdAssets[1].Asset, relations[0].ToAsset.Asset)
+			assert.Equal(t, back.ID, relations[1].ID)
+			assert.Equal(t, "cname_record", relations[1].Type)
+		}
+	}
+
+	relations, err := db.RelationsBetween(createdAssets[0].ID, createdAssets[8].ID, time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, relations)
+
+	_, err = db.RelationsBetween("not-an-id", createdAssets[0].ID, time.Time{})
+	assert.Error(t, err)
+}
+
+func TestLatestRelation(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createdRelations := createRelations(createdAssets, db)
+
+	rel, err := db.LatestRelation(createdAssets[0].ID, createdAssets[5].ID, "a_record")
+	assert.NoError(t, err)
+	assert.Equal(t, createdRelations[1].ID, rel.ID)
+	assert.Equal(t, createdAssets[0].ID, rel.FromAsset.ID)
+	assert.Equal(t, createdAssets[5].ID, rel.ToAsset.ID)
+
+	// the relation is directed and matched on its type
+	_, err = db.LatestRelation(createdAssets[5].ID, createdAssets[0].ID, "a_record")
+	assert.ErrorIs(t, err, repository.ErrRelationNotFound)
+	_, err = db.LatestRelation(createdAssets[0].ID, createdAssets[5].ID, "node")
+	assert.ErrorIs(t, err, repository.ErrRelationNotFound)
+
+	_, err = db.LatestRelation("invalid", createdAssets[5].ID, "a_record")
+	assert.Error(t, err)
+}
+
+func TestRelationsAmong(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createdRelations := createRelations(createdAssets, db)
+
+	// a batch size of two binds a single ID per batch
+	batched := New(repository.SQLite, "test.db", repository.WithBatchSize(2))
+	defer func() { _ = batched.Close() }()
+
+	for _, adb := range []*AssetDB{db, batched} {
+		// the A record links two of the assets, so it is found by both batches and returned once
+		relations, err := adb.RelationsAmong([]string{createdAssets[0].ID, createdAssets[5].ID}, time.Time{})
+		assert.NoError(t, err)
+		if assert.Len(t, relations, 4) {
+			assert.Equal(t, createdRelations[0].ID, relations[0].ID)
+			assert.Equal(t, createdRelations[1].ID, relations[1].ID)
+			assert.Equal(t, createdRelations[2].ID, relations[2].ID)
+			assert.Equal(t, createdRelations[4].ID, relations[3].ID)
+			assert.Equal(t, createdAssets[0].Asset, relations[1].FromAsset.Asset)
+			assert.Equal(t, createdAssets[5].Asset, relations[1].ToAsset.Asset)
+			assert.Equal(t, createdAssets[8].Asset, relations[3].ToAsset.Asset)
+		}
+
+		relations, err = adb.RelationsAmong([]string{createdAssets[1].ID}, time.Time{})
+		assert.NoError(t, err)
+		if assert.Len(t, relations, 1) {
+			assert.Equal(t, createdRelations[0].ID, relations[0].ID)
+		}
+
+		relations, err = adb.RelationsAmong([]string{createdAssets[5].ID}, time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Empty(t, relations)
+
+		relations, err = adb.RelationsAmong(nil, time.Time{})
+		assert.NoError(t, err)
+		assert.Empty(t, relations)
+
+		_, err = adb.RelationsAmong([]string{"not-an-id"}, time.Time{})
+		assert.Error(t, err)
+	}
+}
+
+func TestTopByDegree(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	_ = createRelations(createdAssets, db)
+
+	// the IPv4 address is pointed to by the FQDN and points to the port,
+	// while the IPv6 address is pointed to by the FQDN and the netblock
+	top, err := db.TopByDegree(oam.IPAddress, 5, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, top, 2) {
+		assert.Equal(t, createdAssets[5], top[0].Asset)
+		assert.Equal(t, int64(2), top[0].Degree)
+		assert.Equal(t, createdAssets[6], top[1].Asset)
+		assert.Equal(t, int64(2), top[1].Degree)
+	}
+
+	top, err = db.TopByDegree(oam.FQDN, 1, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, top, 1) {
+		assert.Equal(t, createdAssets[0], top[0].Asset)
+		assert.Equal(t, int64(3), top[0].Degree)
+	}
+
+	top, err = db.TopByDegree(oam.FQDN, 5, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, top)
+
+	_, err = db.TopByDegree(oam.FQDN, 0, time.Time{})
+	assert.Error(t, err)
+}
+
+func TestSearch(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+
+	for _, tc := range []struct {
+		term     string
+		expected []*types.Asset
+	}{
+		// the FQDN and the domain record share the name
+		{"example.com", []*types.Asset{createdAssets[0], createdAssets[13]}},
+		{"2001:db8::1", []*types.Asset{createdAssets[6]}},
+		{"198.51.100.0/24", []*types.Asset{createdAssets[3]}},
+		{"AS12345", []*types.Asset{createdAssets[9]}},
+		{"test@example.com", []*types.Asset{createdAssets[14]}},
+		{" John Doe ", []*types.Asset{createdAssets[12]}},
+		{"fingerprint", []*types.Asset{createdAssets[18]}},
+	} {
+		found, err := db.Search(tc.term, time.Time{})
+		assert.NoError(t, err, tc.term)
+		assert.ElementsMatch(t, tc.expected, found, tc.term)
+	}
+
+	_, err = db.Search("example.com", time.Now().Add(time.Hour))
+	assert.Error(t, err)
+
+	_, err = db.Search("unknown.example.net", time.Time{})
+	assert.Error(t, err)
+
+	_, err = db.Search(" ", time.Time{})
+	assert.Error(t, err)
+}
+
+func TestInScope(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createRelations(createdAssets, db)
+
+	for _, tc := range []struct {
+		description string
+		asset       oam.Asset
+		constraints []oam.Asset
+		expected    bool
+	}{
+		{"related to the constraint", createdAssets[1].Asset, []oam.Asset{&domain.FQDN{Name: "example.com"}}, true},
+		{"relation pointing to the constraint", createdAssets[0].Asset, []oam.Asset{createdAssets[5].Asset}, true},
+		{"matched by a later constraint", createdAssets[6].Asset, []oam.Asset{&domain.FQDN{Name: "owasp.org"}, createdAssets[3].Asset}, true},
+		{"email within the domain", createdAssets[14].Asset, []oam.Asset{&domain.FQDN{Name: "example.com"}}, true},
+		{"unrelated to the constraint", createdAssets[5].Asset, []oam.Asset{createdAssets[3].Asset}, false},
+		{"asset not stored", &domain.FQDN{Name: "api.example.com"}, []oam.Asset{&domain.FQDN{Name: "example.com"}}, false},
+		{"no constraints", createdAssets[1].Asset, nil, false},
+	} {
+		in, err := db.InScope(tc.asset, tc.constraints)
+		assert.NoError(t, err, tc.description)
+		assert.Equal(t, tc.expected, in, tc.description)
+
+		// the answer agrees with the assets returned by FindByScope
+		var found bool
+		scope, _ := db.FindByScope(tc.constraints, time.Time{})
+		for _, a := range scope {
+			if a.Asset.AssetType() == tc.asset.AssetType() && a.Asset.Key() == tc.asset.Key() {
+				found = true
+			}
+		}
+		assert.Equal(t, found, in, tc.description)
+	}
+}
+
+func TestFindByScopeOrder(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createRelations(createdAssets, db)
+
+	constraints := []oam.Asset{createdAssets[3].Asset, &domain.FQDN{Name: "example.com"}}
+	first, err := db.FindByScope(constraints, time.Time{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, first)
+	for i := 1; i < len(first); i++ {
+		x, _ := strconv.ParseUint(first[i-1].ID, 10, 64)
+		y, _ := strconv.ParseUint(first[i].ID, 10, 64)
+		assert.LessOrEqual(t, x, y)
+	}
+
+	// the assets related to a constraint are collected in no particular order, so repeat the query
+	for i := 0; i < 10; i++ {
+		scope, err := db.FindByScope(constraints, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, first, scope)
+	}
+}
+
+func TestExportGraph(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+	createdRelations := createRelations(createdAssets, db)
+
+	var graphml bytes.Buffer
+	assert.NoError(t, db.ExportGraphML(&graphml, time.Time{}))
+
+	var doc struct {
+		Graph struct {
+			Nodes []struct {
+				ID   string `xml:"id,attr"`
+				Data []struct {
+					Key   string `xml:"key,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"data"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+				Label  string `xml:"data"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+	assert.NoError(t, xml.Unmarshal(graphml.Bytes(), &doc))
+	if assert.Len(t, doc.Graph.Nodes, len(createdAssets)) {
+		assert.Equal(t, "n"+createdAssets[0].ID, doc.Graph.Nodes[0].ID)
+		assert.Equal(t, "example.com", doc.Graph.Nodes[0].Data[0].Value)
+		assert.Equal(t, string(oam.FQDN), doc.Graph.Nodes[0].Data[1].Value)
+	}
+	if assert.Len(t, doc.Graph.Edges, len(createdRelations)) {
+		assert.Equal(t, "n"+createdAssets[0].ID, doc.Graph.Edges[0].Source)
+		assert.Equal(t, "n"+createdAssets[1].ID, doc.Graph.Edges[0].Target)
+		assert.Equal(t, "node", doc.Graph.Edges[0].Label)
+	}
+
+	var dot bytes.Buffer
+	assert.NoError(t, db.ExportDOT(&dot, time.Time{}))
+	out := dot.String()
+	assert.True(t, strings.HasPrefix(out, "digraph assetdb {\n"))
+	assert.Contains(t, out, fmt.Sprintf("  n%s [label=\"example.com\", type=\"FQDN\"];\n", createdAssets[0].ID))
+	assert.Contains(t, out, fmt.Sprintf("  n%s -> n%s [label=\"node\"];\n", createdAssets[0].ID, createdAssets[1].ID))
+	assert.Equal(t, len(createdRelations), strings.Count(out, " -> "))
+
+	// nothing was seen after the future time, so the graphs are empty
+	dot.Reset()
+	assert.NoError(t, db.ExportDOT(&dot, time.Now().Add(time.Hour)))
+	assert.Equal(t, "digraph assetdb {\n}\n", dot.String())
+
+	assert.Equal(t, `"say \"hi\" \\ bye"`, dotQuote(`say "hi" \ bye`))
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	ids, err := db.VerifyIntegrity()
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+
+	createdAssets := createAssets(db)
+	err = db.RawQuery(`INSERT INTO assets (type, content) VALUES ('IPAddress', '{"address":"invalid"}'), ('Unknown', '{}')`, nil)
+	assert.NoError(t, err)
+	last, err := db.Create(nil, "", &domain.FQDN{Name: "after.corrupt.owasp.org"})
+	assert.NoError(t, err)
+
+	lastId, err := strconv.ParseUint(last.ID, 10, 64)
+	assert.NoError(t, err)
+	corrupt := []string{strconv.FormatUint(lastId-2, 10), strconv.FormatUint(lastId-1, 10)}
+
+	ids, err = db.VerifyIntegrity()
+	assert.NoError(t, err)
+	assert.Equal(t, corrupt, ids)
+
+	var checked int64
+	failures := make(map[string]error)
+	err = db.VerifyIntegrityFunc(func(id string, err error) error {
+		failures[id] = err
+		return nil
+	}, func(n int64) {
+		checked = n
+	})
+	assert.NoError(t, err)
+	assert.Len(t, failures, 2)
+	assert.Error(t, failures[corrupt[1]])
+	assert.Equal(t, int64(len(createdAssets)+3), checked)
+
+	stop := errors.New("stop")
+	err = db.VerifyIntegrityFunc(func(string, error) error { return stop }, nil)
+	assert.ErrorIs(t, err, stop)
+
+	// the IDs are passed back as returned to remove the corrupt assets
+	for _, id := range ids {
+		assert.NoError(t, db.DeleteAsset(id))
+	}
+	ids, err = db.VerifyIntegrity()
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	const writers = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			parent, err := db.Create(nil, "", &domain.FQDN{Name: "example.com"})
+			if err != nil {
+				errs <- err
+				return
+			}
+			child, err := db.Create(parent, "node", &domain.FQDN{Name: "www.example.com"})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if _, err := db.Link(parent, "node", child); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := db.FindByContent(&domain.FQDN{Name: "www.example.com"}, time.Time{}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	assets, err := db.AssetQuery("")
+	assert.NoError(t, err)
+	assert.Len(t, assets, 2)
+
+	relations, err := db.RelationQuery("")
+	assert.NoError(t, err)
+	assert.Len(t, relations, 1)
+}
+
+func TestCloseContext(t *testing.T) {
+	g, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+	assert.NoError(t, g.Close())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	// the hook runs inside Create, holding the operation open until released
+	db := New(repository.SQLite, "test.db", repository.WithAssetCreated(func(*types.Asset) {
+		close(started)
+		<-release
+	}))
+
+	createErr := make(chan error, 1)
+	go func() {
+		_, err := db.Create(nil, "", &domain.FQDN{Name: "www.example.com"})
+		createErr <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	closed := make(chan error, 1)
+	go func() { closed <- db.CloseContext(ctx) }()
+
+	select {
+	case <-closed:
+		t.Fatal("CloseContext returned while an operation was blocked")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	_, err = db.FindByType(oam.FQDN, time.Time{})
+	assert.ErrorIs(t, err, ErrDatabaseClosed)
+	var opErr *Error
+	if assert.ErrorAs(t, db.DeleteAsset("1"), &opErr) {
+		assert.Equal(t, "DeleteAsset", opErr.Op)
+		assert.ErrorIs(t, opErr, ErrDatabaseClosed)
+	}
+
+	close(release)
+	assert.NoError(t, <-createErr)
+	assert.NoError(t, <-closed)
+}
+
+func TestCloseContextTimeout(t *testing.T) {
+	g, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+	assert.NoError(t, g.Close())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	db := New(repository.SQLite, "test.db", repository.WithAssetCreated(func(*types.Asset) {
+		close(started)
+		<-release
+	}))
+
+	createErr := make(chan error, 1)
+	go func() {
+		_, err := db.Create(nil, "", &domain.FQDN{Name: "www.example.com"})
+		createErr <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, db.CloseContext(ctx), context.DeadlineExceeded)
+
+	close(release)
+	<-createErr
+}
+
+func TestFindByContents(t *testing.T) {
+	db, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	createdAssets := createAssets(db)
+
+	missing := &domain.FQDN{Name: "missing.example.com"}
+	inputs := []oam.Asset{createdAssets[0].Asset, createdAssets[1].Asset, createdAssets[5].Asset, createdAssets[11].Asset, missing}
+
+	results, err := db.FindByContents(inputs, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+	assert.Equal(t, []*types.Asset{createdAssets[0]}, results[repository.ContentsKey(createdAssets[0].Asset)])
+	assert.Equal(t, []*types.Asset{createdAssets[1]}, results[repository.ContentsKey(createdAssets[1].Asset)])
+	assert.Equal(t, []*types.Asset{createdAssets[5]}, results[repository.ContentsKey(createdAssets[5].Asset)])
+	assert.Equal(t, []*types.Asset{createdAssets[11]}, results[repository.ContentsKey(createdAssets[11].Asset)])
+	assert.Empty(t, results[repository.ContentsKey(missing)])
+}
+
+func TestCopyTo(t *testing.T) {
+	src, err := newGraph("local", "test.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("test.db")
+
+	dest, err := newGraph("local", "copy.db")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer teardownSqlite("copy.db")
+
+	createdAssets := createAssets(src)
+	createdRelations := createRelations(createdAssets, src)
+
+	// an asset already in the destination must not be duplicated
+	existing, err := dest.Create(nil, "", createdAssets[2].Asset)
+	assert.NoError(t, err)
+
+	// a full batch of rows that fail to parse does not end the copy early
+	err = src.RawQuery(fmt.Sprintf(`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < %d)
+		INSERT INTO assets (type, content) SELECT 'IPAddress', '{"address":"invalid"}' FROM n`, copyBatchSize), nil)
+	assert.NoError(t, err)
+	last, err := src.Create(nil, "", &domain.FQDN{Name: "after.unparsable.owasp.org"})
+	assert.NoError(t, err)
+	createdAssets = append(createdAssets, last)
+
+	// the confidence of an observation is copied along with its relation
+	observer, err := src.Create(nil, "", &source.Source{Name: "Copied", Confidence: 80})
+	assert.NoError(t, err)
+	createdAssets = append(createdAssets, observer)
+	observation, err := src.repository.LinkObservation(createdAssets[0], observer, 80)
+	assert.NoError(t, err)
+	createdRelations = append(createdRelations, observation)
+
+	// the raw data is copied to the asset with the ID assigned by the destination
+	withRaw, err := src.CreateWithRaw(nil, "", &domain.FQDN{Name: "raw.copied.owasp.org"}, []byte("raw response"))
+	assert.NoError(t, err)
+	createdAssets = append(createdAssets, withRaw)
+
+	// the external ID is copied, so the asset keeps its identity in the destination
+	stable, err := src.CreateWithExternalID(nil, "", &domain.FQDN{Name: "stable.copied.owasp.org"}, "3f2b9c1e-stable")
+	assert.NoError(t, err)
+	createdAssets = append(createdAssets, stable)
+
+	// the sources asserting a relation are copied to the relation with the ID assigned by the destination
+	asserter, err := src.Create(nil, "", &source.Source{Name: "Asserting", Confidence: 90})
+	assert.NoError(t, err)
+	createdAssets = append(createdAssets, asserter)
+	asserted, err := src.LinkWithSource(createdAssets[0], "node", createdAssets[2], asserter)
+	assert.NoError(t, err)
+	createdRelations = append(createdRelations, asserted)
+
+	// the previous contents are copied to the asset with the ID assigned by the destination
+	replacedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{"Example Corp.", "Example LLC"} {
+		assert.NoError(t, src.repository.ImportAssetHistory(createdAssets[11].ID, repository.AssetHistory{
+			Type:       string(oam.Organization),
+			Content:    []byte(`{"name":"` + name + `"}`),
+			LastSeen:   replacedAt.Add(-time.Hour),
+			ReplacedAt: replacedAt,
+		}))
+		replacedAt = replacedAt.Add(24 * time.Hour)
+	}
+
+	// the tags are copied to the asset with the ID assigned by the destination
+	assert.NoError(t, src.AddTag(createdAssets[1].ID, "client", "acme"))
+	assert.NoError(t, src.AddTag(createdAssets[1].ID, "status", "triaged"))
+
+	err = src.CopyTo(dest)
+	assert.NoError(t, err)
+
+	copiedAssets, err := dest.AssetQuery("")
+	assert.NoError(t, err)
+	assert.Len(t, copiedAssets, len(createdAssets))
+
+	for _, a := range createdAssets {
+		found, err := dest.FindByContent(a.Asset, time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, found, 1)
+
+		// the later last seen is kept for the asset already in the destination
+		expected := a.LastSeen
+		if a == createdAssets[2] && existing.LastSeen.After(expected) {
+			expected = existing.LastSeen
+		}
+		assert.Equal(t, expected.UTC(), found[0].LastSeen.UTC())
+	}
+
+	copiedRelations, err := dest.RelationQuery("")
+	assert.NoError(t, err)
+	assert.Len(t, copiedRelations, len(createdRelations))
+
+	for _, r := range createdRelations {
+		from, err := src.FindById(r.FromAsset.ID, time.Time{})
+		assert.NoError(t, err)
+		to, err := src.FindById(r.ToAsset.ID, time.Time{})
+		assert.NoError(t, err)
+
+		var found bool
+		for _, c := range copiedRelations {
+			if c.Type == r.Type && assert.ObjectsAreEqual(from.Asset, c.FromAsset.Asset) &&
+				assert.ObjectsAreEqual(to.Asset, c.ToAsset.Asset) {
+				found = true
+				break
+			}
+		}
+		assert.True(t, found, "relation %s was not copied", r.Type)
+	}
+
+	copied, err := dest.FindByContent(createdAssets[0].Asset, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, copied, 1) {
+		observations, err := dest.Observations(copied[0], time.Time{})
+		assert.NoError(t, err)
+		if assert.Len(t, observations, 1) {
+			assert.Equal(t, 80, observations[0].Confidence)
+		}
+	}
+
+	copied, err = dest.FindByContent(withRaw.Asset, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, copied, 1) {
+		raw, err := dest.FindRawById(copied[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("raw response"), raw)
+	}
+
+	for _, c := range copiedRelations {
+		sources, err := dest.RelationSources(c.ID)
+		assert.NoError(t, err)
+		if c.Type == "node" && c.ToAsset.Asset.Key() == "www.example.org" {
+			if assert.Len(t, sources, 1) {
+				assert.Equal(t, asserter.Asset, sources[0].Asset)
+			}
+		} else {
+			assert.Empty(t, sources)
+		}
+	}
+
+	copied, err = dest.FindByContent(createdAssets[11].Asset, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, copied, 1) {
+		versions, err := dest.FindHistoryById(copied[0].ID)
+		assert.NoError(t, err)
+		if assert.Len(t, versions, 2) {
+			assert.Equal(t, copied[0].ID, versions[0].AssetID)
+			assert.Equal(t, "Example LLC", versions[0].Asset.Key())
+			assert.Equal(t, "Example Corp.", versions[1].Asset.Key())
+			assert.Equal(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), versions[1].ReplacedAt.UTC())
+		}
+	}
+
+	copied, err = dest.FindByContent(createdAssets[1].Asset, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, copied, 1) {
+		tags, err := dest.Tags(copied[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"client": "acme", "status": "triaged"}, tags)
+	}
+
+	copiedStable, err := dest.FindByExternalID(oam.FQDN, "3f2b9c1e-stable", time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, stable.Asset, copiedStable.Asset)
+	assert.Equal(t, "3f2b9c1e-stable", copiedStable.ExternalID)
+}
+
+func assetIDs(assets []*types.Asset) []string {
+	var ids []string
+	for _, a := range assets {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+func createRelations(assets []*types.Asset, db *AssetDB) []*types.Relation {
+	var relations []*types.Relation
+
+	// Create test relations
+	relation, err := db.repository.Link(assets[0], "node", assets[1])
+	if err != nil {
+		panic(err)
+	}
+	relations = append(relations, relation)
+	relation, err = db.repository.Link(assets[0], "a_record", assets[5])
+	if err != nil {
+		panic(err)
+	}
+	relations = append(relations, relation)
+	relation, err = db.repository.Link(assets[0], "aaaa_record", assets[6])
+	if err != nil {
+		panic(err)
+	}
+	relations = append(relations, relation)
+	relation, err = db.repository.Link(assets[3], "contains", assets[6])
+	if err != nil {
+		panic(err)
+	}
+	relations = append(relations, relation)
+	relation, err = db.repository.Link(assets[5], "port", assets[8])
+	if err != nil {
+		panic(err)
+	}
+	relations = append(relations, relation)
+
+	return relations
+}
+
+func createAssets(db *AssetDB) []*types.Asset {
+	// Create test assets
+	assets := []oam.Asset{
+		&domain.FQDN{Name: "example.com"},
+		&domain.FQDN{Name: "www.example.com"},
+		&domain.FQDN{Name: "www.example.org"},
+		&network.Netblock{CIDR: netip.MustParsePrefix("198.51.100.0/24"), Type: "IPv4"},
+		&network.Netblock{CIDR: netip.MustParsePrefix("2001:db8::/32"), Type: "IPv6"},
+		&network.IPAddress{Address: netip.MustParseAddr("192.168.1.2"), Type: "IPv4"},
+		&network.IPAddress{Address: netip.MustParseAddr("2001:db8::1"), Type: "IPv6"},
+		&network.SocketAddress{Address: netip.MustParseAddrPort("192.168.1.1:80"), IPAddress: netip.MustParseAddr("192.168.1.1"), Port: 80, Protocol: "tcp"},
+		&network.SocketAddress{Address: netip.MustParseAddrPort("192.168.1.1:443"), IPAddress: netip.MustParseAddr("192.168.1.1"), Port: 443, Protocol: "tcp"},
+		&network.AutonomousSystem{Number: 12345},
+		&url.URL{Scheme: "https", Host: "example.com"},
+		&org.Organization{Name: "Example Inc."},
+		&people.Person{FullName: "John Doe"},
+		&oamreg.DomainRecord{Domain: "example.com"},
+		&contact.EmailAddress{Address: "test@example.com"},
+		&contact.Phone{Raw: "+1-555-555-5555"},
+		&contact.Location{Address: "123 Example St., Example, EX 12345"},
+		&oamtls.TLSCertificate{SerialNumber: "1234567890"},
+		&fingerprint.Fingerprint{Value: "fingerprint"},
+		&contact.ContactRecord{DiscoveredAt: "https://owasp.org"},
+	}
+
+	var createdAssets []*types.Asset
+	for _, asset := range assets {
+		createdAsset, err := db.Create(nil, "", asset)
+		if err != nil {
+			panic(err)
+		}
+		createdAssets = append(createdAssets, createdAsset)
+	}
+	return createdAssets
+}
+
+func teardownSqlite(dsn string) {
+	err := os.Remove(dsn)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func newGraph(system, path string) (*AssetDB, error) {
+	var dsn string
+	var dbtype repository.DBType
+
+	switch system {
+	case "memory":
+		dbtype = repository.SQLite
+		dsn = fmt.Sprintf("file:sqlite%d?mode=memory&cache=shared", rand.Int31n(100))
+	case "local":
+		dbtype = repository.SQLite
+		dsn = path
+	case "postgres":
+		dbtype = repository.Postgres
+		dsn = path
+	default:
+		return nil, errors.New("newGraph: no valid database type provided")
+	}
+
+	store := New(dbtype, dsn)
+	if store == nil {
+		return nil, errors.New("newGraph: failed to create the new database")
+	}
+
+	var name string
+	var fs embed.FS
+	var database gorm.Dialector
+	switch dbtype {
+	case repository.SQLite:
+		name = "sqlite3"
+		fs = sqlitemigrations.Migrations()
+		database = sqlite.Open(dsn)
+	case repository.Postgres:
+		name = "postgres"
+		fs = pgmigrations.Migrations()
+		database = postgres.Open(dsn)
+	}
+
+	sql, err := gorm.Open(database, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	migrationsSource := migrate.EmbedFileSystemMigrationSource{
+		FileSystem: fs,
+		Root:       "/",
+	}
+
+	sqlDb, err := sql.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = migrate.Exec(sqlDb, name, migrationsSource, migrate.Up)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+type mockAssetDB struct {
+	mock.Mock
+}
+
+func (m *mockAssetDB) Close() error {
+	return nil
+}
+
+func (m *mockAssetDB) GetDBType() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func (m *mockAssetDB) CreateAsset(asset oam.Asset) (*types.Asset, error) {
+	args := m.Called(asset)
+	return args.Get(0).(*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) CreateOrUpdateAsset(asset oam.Asset) (*types.Asset, bool, error) {
+	args := m.Called(asset)
+	return args.Get(0).(*types.Asset), args.Bool(1), args.Error(2)
+}
+
+func (m *mockAssetDB) CreateAssetIfNotSeenSince(asset oam.Asset, since time.Time) (*types.Asset, bool, error) {
+	args := m.Called(asset, since)
+	return args.Get(0).(*types.Asset), args.Bool(1), args.Error(2)
+}
+
+func (m *mockAssetDB) ImportAsset(asset *types.Asset) (*types.Asset, error) {
+	args := m.Called(asset)
+	return args.Get(0).(*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) UpdateAssetLastSeen(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) RetypeAsset(id string, atype oam.AssetType) error {
+	args := m.Called(id, atype)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) DeleteAsset(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) DeleteAssetsNotSeenSince(cutoff time.Time) (int64, error) {
+	args := m.Called(cutoff)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockAssetDB) PreviewDeleteAssetsNotSeenSince(cutoff time.Time) ([]string, error) {
+	args := m.Called(cutoff)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockAssetDB) DeleteRelation(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) BackfillAssetHashes() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockAssetDB) LinkObservation(asset *types.Asset, src *types.Asset, confidence int) (*types.Relation, error) {
+	args := m.Called(asset, src, confidence)
+	return args.Get(0).(*types.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) Observations(asset *types.Asset, since time.Time) ([]*types.Relation, error) {
+	args := m.Called(asset, since)
+	return args.Get(0).([]*types.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetsWithOutgoingRelation(atype oam.AssetType, relationType string, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(atype, relationType, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetsWithIncomingRelation(atype oam.AssetType, relationType string, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(atype, relationType, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByTypeFromSource(atype oam.AssetType, sourceName string, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(atype, sourceName, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByTypes(atypes []oam.AssetType, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(atypes, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetIDsByContent(asset oam.Asset, since time.Time) ([]string, error) {
+	args := m.Called(asset, since)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetIDsByType(atype oam.AssetType, since time.Time) ([]string, error) {
+	args := m.Called(atype, since)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockAssetDB) RecentlyChangedAssets(limit int) ([]*types.Asset, error) {
+	args := m.Called(limit)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) StalestAssetsByType(atype oam.AssetType, n int) ([]*types.Asset, error) {
+	args := m.Called(atype, n)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindDuplicateAssets(atype oam.AssetType) ([][]*types.Asset, error) {
+	args := m.Called(atype)
+	return args.Get(0).([][]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) CreateAssetWithRaw(asset oam.Asset, raw []byte) (*types.Asset, error) {
+	args := m.Called(asset, raw)
+	return args.Get(0).(*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) CreateAssetWithExternalID(asset oam.Asset, externalID string) (*types.Asset, error) {
+	args := m.Called(asset, externalID)
+	return args.Get(0).(*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) CreateAssetFromContent(atype string, content []byte) (*types.Asset, error) {
+	args := m.Called(atype, content)
+	return args.Get(0).(*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetRawById(id string) ([]byte, error) {
+	args := m.Called(id)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetHistory(id string) ([]*types.AssetVersion, error) {
+	args := m.Called(id)
+	return args.Get(0).([]*types.AssetVersion), args.Error(1)
+}
+
+func (m *mockAssetDB) ImportAssetHistory(assetID string, version repository.AssetHistory) error {
+	args := m.Called(assetID, version)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) AssetInScope(asset oam.Asset, constraints []oam.Asset, since time.Time) (bool, error) {
+	args := m.Called(asset, constraints, since)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockAssetDB) FindLocationsByCountry(cc string, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(cc, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindRegistrationRecords(atype oam.AssetType, fields map[string]interface{}, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(atype, fields, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindRegistrationRecordsCreated(atype oam.AssetType, start, end time.Time, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(atype, start, end, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindRegistrationRecordsByOrganization(atype oam.AssetType, relation, name string, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(atype, relation, name, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) SelectAssetField(atype oam.AssetType, field string, since time.Time) ([]string, error) {
+	args := m.Called(atype, field, since)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByTypeOrdered(atype oam.AssetType, since time.Time, order repository.Order) ([]*types.Asset, error) {
+	args := m.Called(atype, since, order)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByScopeOrdered(constraints []oam.Asset, since time.Time, order repository.Order) ([]*types.Asset, error) {
+	args := m.Called(constraints, since, order)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) IncomingRelationsOrdered(asset *types.Asset, since time.Time, order repository.Order, relationTypes ...string) ([]*types.Relation, error) {
+	args := m.Called(asset, since, order, relationTypes)
+	return args.Get(0).([]*types.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) OutgoingRelationsOrdered(asset *types.Asset, since time.Time, order repository.Order, relationTypes ...string) ([]*types.Relation, error) {
+	args := m.Called(asset, since, order, relationTypes)
+	return args.Get(0).([]*types.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) ReplaceOutgoingRelations(source *types.Asset, relationType string, destinations []*types.Asset) error {
+	args := m.Called(source, relationType, destinations)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) Explain(sqlstr string, args ...interface{}) (string, error) {
+	a := m.Called(sqlstr, args)
+	return a.String(0), a.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetById(id string, since time.Time) (*types.Asset, error) {
+	args := m.Called(id, since)
+	return args.Get(0).(*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByExternalID(atype oam.AssetType, externalID string, since time.Time) (*types.Asset, error) {
+	args := m.Called(atype, externalID, since)
+	return args.Get(0).(*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByContent(asset oam.Asset, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(asset, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByContents(assets []oam.Asset, since time.Time) (map[string][]*types.Asset, error) {
+	args := m.Called(assets, since)
+	return args.Get(0).(map[string][]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByScope(constraints []oam.Asset, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(constraints, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByContentAny(constraints []oam.Asset, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(constraints, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByType(atype oam.AssetType, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(atype, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) Link(source *types.Asset, relation string, destination *types.Asset) (*types.Relation, error) {
 	args := m.Called(source, relation, destination)
 	return args.Get(0).(*types.Relation), args.Error(1)
 }
 
+func (m *mockAssetDB) ImportRelation(relation *types.Relation) (*types.Relation, error) {
+	args := m.Called(relation)
+	return args.Get(0).(*types.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) ImportAssetRaw(id string, raw []byte) error {
+	args := m.Called(id, raw)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) ImportAssetTag(assetID string, tag repository.AssetTag) error {
+	args := m.Called(assetID, tag)
+	return args.Error(0)
+}
+
 func (m *mockAssetDB) IncomingRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, error) {
 	args := m.Called(asset, since, relationTypes)
 	return args.Get(0).([]*types.Relation), args.Error(1)
 }
 
+func (m *mockAssetDB) IncomingRelationsFrom(asset *types.Asset, since time.Time, fromType oam.AssetType, relationTypes ...string) ([]*types.Relation, error) {
+	args := m.Called(asset, since, fromType, relationTypes)
+	return args.Get(0).([]*types.Relation), args.Error(1)
+}
+
 func (m *mockAssetDB) OutgoingRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, error) {
 	args := m.Called(asset, since, relationTypes)
 	return args.Get(0).([]*types.Relation), args.Error(1)
 }
 
+func (m *mockAssetDB) AllRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, []types.Direction, error) {
+	args := m.Called(asset, since, relationTypes)
+	return args.Get(0).([]*types.Relation), args.Get(1).([]types.Direction), args.Error(2)
+}
+
+func (m *mockAssetDB) FindTransitiveClosure(start *types.Asset, relationType string, maxDepth int, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(start, relationType, maxDepth, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) ExpandRelations(asset *types.Asset, dir types.Direction, depth int, since time.Time, relationTypes ...string) ([][]*types.Relation, error) {
+	args := m.Called(asset, dir, depth, since, relationTypes)
+	return args.Get(0).([][]*types.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) RelationsBetween(idA, idB string, since time.Time) ([]*types.Relation, error) {
+	args := m.Called(idA, idB, since)
+	return args.Get(0).([]*types.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) FindLatestRelation(fromID, toID, relationType string) (*types.Relation, error) {
+	args := m.Called(fromID, toID, relationType)
+	return args.Get(0).(*types.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) IncomingRelationsCreated(asset *types.Asset, start, end time.Time, relationTypes ...string) ([]*types.Relation, error) {
+	args := m.Called(asset, start, end, relationTypes)
+	return args.Get(0).([]*types.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) OutgoingRelationsCreated(asset *types.Asset, start, end time.Time, relationTypes ...string) ([]*types.Relation, error) {
+	args := m.Called(asset, start, end, relationTypes)
+	return args.Get(0).([]*types.Relation), args.Error(1)
+}
+
 func (m *mockAssetDB) RawQuery(sqlstr string, results interface{}) error {
 	args := m.Called(sqlstr, results)
 	return args.Error(0)
 }
 
-func (m *mockAssetDB) AssetQuery(query string) ([]*types.Asset, error) {
-	args := m.Called(query)
+func (m *mockAssetDB) RawAssetQuery(sqlstr string, args ...interface{}) ([]*types.Asset, error) {
+	called := m.Called(sqlstr, args)
+	return called.Get(0).([]*types.Asset), called.Error(1)
+}
+
+func (m *mockAssetDB) AssetQuery(query string, args ...interface{}) ([]*types.Asset, error) {
+	called := m.Called(query, args)
+	return called.Get(0).([]*types.Asset), called.Error(1)
+}
+
+func (m *mockAssetDB) AssetRowsAfter(id uint64, limit int) ([]repository.Asset, error) {
+	args := m.Called(id, limit)
+	return args.Get(0).([]repository.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) RelationRowsAfter(id uint64, limit int) ([]repository.Relation, error) {
+	args := m.Called(id, limit)
+	return args.Get(0).([]repository.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) ForEachRelation(relationType string, since time.Time, fn func(*types.Relation) error) error {
+	args := m.Called(relationType, since, fn)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) AssetRawRowsAfter(id uint64, limit int) ([]repository.AssetRaw, error) {
+	args := m.Called(id, limit)
+	return args.Get(0).([]repository.AssetRaw), args.Error(1)
+}
+
+func (m *mockAssetDB) AssetTagRowsAfter(assetID uint64, key string, limit int) ([]repository.AssetTag, error) {
+	args := m.Called(assetID, key, limit)
+	return args.Get(0).([]repository.AssetTag), args.Error(1)
+}
+
+func (m *mockAssetDB) RelationSourceRowsAfter(relationID, sourceID uint64, limit int) ([]repository.RelationSource, error) {
+	args := m.Called(relationID, sourceID, limit)
+	return args.Get(0).([]repository.RelationSource), args.Error(1)
+}
+
+func (m *mockAssetDB) AssetHistoryRowsAfter(id uint64, limit int) ([]repository.AssetHistory, error) {
+	args := m.Called(id, limit)
+	return args.Get(0).([]repository.AssetHistory), args.Error(1)
+}
+
+func (m *mockAssetDB) RelationQuery(constraints string, args ...interface{}) ([]*types.Relation, error) {
+	called := m.Called(constraints, args)
+	return called.Get(0).([]*types.Relation), called.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByJSONPath(atype oam.AssetType, path string, value interface{}, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(atype, path, value, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindSimilarOrganizations(name string, threshold float64) ([]*types.Asset, error) {
+	args := m.Called(name, threshold)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindSimilarPeople(fullName string, threshold float64) ([]*types.Asset, error) {
+	args := m.Called(fullName, threshold)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) DeleteRelations(ids []string) (int64, error) {
+	args := m.Called(ids)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockAssetDB) RelationCounts(id string) (map[string]int64, map[string]int64, error) {
+	args := m.Called(id)
+	return args.Get(0).(map[string]int64), args.Get(1).(map[string]int64), args.Error(2)
+}
+
+func (m *mockAssetDB) OutgoingRelationTypeCounts(asset *types.Asset, since time.Time) (map[string]int64, error) {
+	args := m.Called(asset, since)
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+func (m *mockAssetDB) IncomingRelationTypeCounts(asset *types.Asset, since time.Time) (map[string]int64, error) {
+	args := m.Called(asset, since)
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+func (m *mockAssetDB) ListenChanges(ctx context.Context) (<-chan *types.Change, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(<-chan *types.Change), args.Error(1)
+}
+
+func (m *mockAssetDB) Transaction(fn func(repository.Repository) error) error {
+	args := m.Called(fn)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) LinkRelationSource(relation *types.Relation, src *types.Asset) error {
+	args := m.Called(relation, src)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) RelationSources(relationID string) ([]*types.Asset, error) {
+	args := m.Called(relationID)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) ImportRelationSource(relationID, sourceID string, rs repository.RelationSource) error {
+	args := m.Called(relationID, sourceID, rs)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) AddAssetTag(assetID, key, value string) error {
+	args := m.Called(assetID, key, value)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) RemoveAssetTag(assetID, key string) error {
+	args := m.Called(assetID, key)
+	return args.Error(0)
+}
+
+func (m *mockAssetDB) AssetTags(assetID string) (map[string]string, error) {
+	args := m.Called(assetID)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetsByTag(key, value string, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(key, value, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindNeighborsByType(asset *types.Asset, neighborType oam.AssetType, since time.Time, relationTypes ...string) ([]*types.Asset, error) {
+	args := m.Called(asset, neighborType, since, relationTypes)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetsInAS(asn int, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(asn, since)
+	return args.Get(0).([]*types.Asset), args.Error(1)
+}
+
+func (m *mockAssetDB) RelationQueryWithLimit(constraints string, limit int, args ...interface{}) ([]*types.Relation, error) {
+	called := m.Called(constraints, limit, args)
+	return called.Get(0).([]*types.Relation), called.Error(1)
+}
+
+func (m *mockAssetDB) LinkAt(source *types.Asset, relation string, destination *types.Asset, observedAt time.Time) (*types.Relation, error) {
+	args := m.Called(source, relation, destination, observedAt)
+	return args.Get(0).(*types.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) FindAssetByTypeFiltered(atype oam.AssetType, filter repository.ContentFilter, since time.Time) ([]*types.Asset, error) {
+	args := m.Called(atype, filter, since)
 	return args.Get(0).([]*types.Asset), args.Error(1)
 }
 
-func (m *mockAssetDB) RelationQuery(constraints string) ([]*types.Relation, error) {
-	args := m.Called(constraints)
+func (m *mockAssetDB) RelationsAmong(ids []string, since time.Time) ([]*types.Relation, error) {
+	args := m.Called(ids, since)
 	return args.Get(0).([]*types.Relation), args.Error(1)
 }
+
+func (m *mockAssetDB) LinkWeighted(source *types.Asset, relation string, destination *types.Asset, weight float64) (*types.Relation, error) {
+	args := m.Called(source, relation, destination, weight)
+	return args.Get(0).(*types.Relation), args.Error(1)
+}
+
+func (m *mockAssetDB) SchemaVersion() (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+// ResolveSince returns since unchanged, as a repository created without WithDefaultSince does,
+// so the tests of the AssetDB methods only set expectations on the queries.
+func (m *mockAssetDB) ResolveSince(since time.Time) time.Time {
+	return since
+}
+
+// Now returns the current system time, as a repository created without WithClock does.
+func (m *mockAssetDB) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// MaxTraversalNodes returns zero, as a repository created without WithMaxTraversalNodes does.
+func (m *mockAssetDB) MaxTraversalNodes() int {
+	return 0
+}
+
+func (m *mockAssetDB) TopAssetsByDegree(atype oam.AssetType, n int, since time.Time) ([]types.AssetDegree, error) {
+	args := m.Called(atype, n, since)
+	return args.Get(0).([]types.AssetDegree), args.Error(1)
+}
+
+func (m *mockAssetDB) Stats() (*types.DBStats, error) {
+	args := m.Called()
+	return args.Get(0).(*types.DBStats), args.Error(1)
+}
@@ -0,0 +1,100 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package assetdb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/owasp-amass/asset-db/repository"
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	oamtls "github.com/owasp-amass/open-asset-model/certificate"
+)
+
+// issuerRelation is the relation linking a TLS certificate to the certificate that issued it.
+const issuerRelation = "issuing_certificate"
+
+// CertificateChain follows the issuing_certificate relations upward from the leaf TLS certificate and returns the chain,
+// starting with the leaf and ending with the last issuer found.
+// The traversal stops at a self-signed root, at a certificate without an issuer in the database,
+// or once maxDepth issuers have been added to the chain. When a certificate has several issuers, the oldest relation is followed.
+// When the chain would hold more issuers than the maximum set by repository.WithMaxTraversalNodes, the issuers found so far
+// are returned along with an error wrapping repository.ErrTraversalTruncated.
+// It returns the ordered chain and an error, if any.
+func (as *AssetDB) CertificateChain(leaf *types.Asset, maxDepth int) ([]*types.Asset, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("CertificateChain", storedType(leaf), err)
+	}
+	defer as.ops.leave()
+
+	if leaf == nil || leaf.Asset == nil || leaf.Asset.AssetType() != oam.TLSCertificate {
+		return nil, opError("CertificateChain", storedType(leaf), errors.New("the leaf must be a TLS certificate"))
+	}
+	if maxDepth < 0 {
+		return nil, opError("CertificateChain", storedType(leaf), errors.New("the maximum depth cannot be negative"))
+	}
+
+	chain := []*types.Asset{leaf}
+	visited := map[string]struct{}{leaf.ID: {}}
+	for cur := leaf; len(chain) <= maxDepth && !selfSigned(cur); {
+		issuer, err := as.issuer(cur)
+		if err != nil {
+			return nil, opError("CertificateChain", storedType(leaf), err)
+		}
+		if issuer == nil {
+			break
+		}
+		// a certificate issued by one already in the chain ends the traversal
+		if _, found := visited[issuer.ID]; found {
+			break
+		}
+		if limit := as.repository.MaxTraversalNodes(); limit > 0 && len(chain) > limit {
+			return chain, opError("CertificateChain", storedType(leaf),
+				fmt.Errorf("%w: more than %d assets reached", repository.ErrTraversalTruncated, limit))
+		}
+
+		visited[issuer.ID] = struct{}{}
+		chain = append(chain, issuer)
+		cur = issuer
+	}
+	return chain, nil
+}
+
+// issuer returns the certificate that issued the provided certificate, or nil when the database does not hold one.
+func (as *AssetDB) issuer(cert *types.Asset) (*types.Asset, error) {
+	rels, err := as.repository.OutgoingRelationsOrdered(cert, time.Time{}, repository.Order{Field: repository.OrderByID}, issuerRelation)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rel := range rels {
+		a, err := as.repository.FindAssetById(rel.ToAsset.ID, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		if a.Asset.AssetType() == oam.TLSCertificate {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+// selfSigned returns true if the certificate names itself as its issuer.
+func selfSigned(cert *types.Asset) bool {
+	var tls *oamtls.TLSCertificate
+
+	switch v := cert.Asset.(type) {
+	case *oamtls.TLSCertificate:
+		tls = v
+	case oamtls.TLSCertificate:
+		tls = &v
+	default:
+		return false
+	}
+	return tls.IssuerCommonName != "" && tls.IssuerCommonName == tls.SubjectCommonName &&
+		(tls.AuthorityKeyID == "" || tls.AuthorityKeyID == tls.SubjectKeyID)
+}
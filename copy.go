@@ -0,0 +1,218 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package assetdb
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/owasp-amass/asset-db/types"
+)
+
+// copyBatchSize is the number of rows requested from the source database per query during a copy.
+const copyBatchSize = 1000
+
+// CopyTo copies all assets, their raw data, previous contents and tags, and relations, along with the sources asserting them, stored in the
+// asset database into the destination.
+// Asset and relation IDs are remapped by the destination, while CreatedAt, LastSeen, ExternalID, and the relation topology are preserved,
+// so assets holding an external ID can be found in the destination by FindByExternalID.
+// Rows are read from the source in batches, so only the mappings of asset and relation IDs are held in memory.
+// Assets with content that fails to parse are skipped, along with their raw data, previous contents and tags,
+// and the relations that reference them.
+func (as *AssetDB) CopyTo(dest *AssetDB) error {
+	return opError("CopyTo", "", as.copyTo(dest))
+}
+
+// copyTo copies the rows into the destination once both databases have accepted the operation.
+func (as *AssetDB) copyTo(dest *AssetDB) error {
+	if err := as.ops.enter(); err != nil {
+		return err
+	}
+	defer as.ops.leave()
+
+	if err := dest.ops.enter(); err != nil {
+		return err
+	}
+	defer dest.ops.leave()
+
+	// maps source asset IDs to the IDs assigned by the destination
+	ids := make(map[uint64]string)
+	// maps source relation IDs to the IDs assigned by the destination
+	rels := make(map[uint64]string)
+
+	var last uint64
+	for {
+		rows, err := as.repository.AssetRowsAfter(last, copyBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for i := range rows {
+			row := &rows[i]
+			last = row.ID
+
+			parsed, err := row.Parse()
+			if err != nil {
+				continue
+			}
+
+			imported, err := dest.repository.ImportAsset(&types.Asset{
+				ID:         strconv.FormatUint(row.ID, 10),
+				CreatedAt:  row.CreatedAt,
+				LastSeen:   row.LastSeen,
+				ExternalID: row.ExternalIDValue(),
+				Asset:      parsed,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to copy asset %d: %w", row.ID, err)
+			}
+			ids[row.ID] = imported.ID
+		}
+	}
+
+	last = 0
+	for {
+		rows, err := as.repository.AssetRawRowsAfter(last, copyBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, r := range rows {
+			last = r.AssetID
+
+			id, found := ids[r.AssetID]
+			if !found {
+				continue
+			}
+
+			if err := dest.repository.ImportAssetRaw(id, r.Raw); err != nil {
+				return fmt.Errorf("failed to copy the raw data of asset %d: %w", r.AssetID, err)
+			}
+		}
+	}
+
+	last = 0
+	for {
+		rows, err := as.repository.AssetHistoryRowsAfter(last, copyBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, v := range rows {
+			last = v.ID
+
+			id, found := ids[v.AssetID]
+			if !found {
+				continue
+			}
+
+			if err := dest.repository.ImportAssetHistory(id, v); err != nil {
+				return fmt.Errorf("failed to copy version %d of asset %d: %w", v.ID, v.AssetID, err)
+			}
+		}
+	}
+
+	var lastKey string
+	last = 0
+	for {
+		rows, err := as.repository.AssetTagRowsAfter(last, lastKey, copyBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, t := range rows {
+			last, lastKey = t.AssetID, t.Key
+
+			id, found := ids[t.AssetID]
+			if !found {
+				continue
+			}
+
+			if err := dest.repository.ImportAssetTag(id, t); err != nil {
+				return fmt.Errorf("failed to copy the %s tag of asset %d: %w", t.Key, t.AssetID, err)
+			}
+		}
+	}
+
+	last = 0
+	for {
+		rows, err := as.repository.RelationRowsAfter(last, copyBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, r := range rows {
+			last = r.ID
+
+			from, found := ids[r.FromAssetID]
+			if !found {
+				continue
+			}
+			to, found := ids[r.ToAssetID]
+			if !found {
+				continue
+			}
+
+			imported, err := dest.repository.ImportRelation(&types.Relation{
+				Type:       r.Type,
+				CreatedAt:  r.CreatedAt,
+				LastSeen:   r.LastSeen,
+				Confidence: r.Confidence,
+				Weight:     r.Weight,
+				FromAsset:  &types.Asset{ID: from},
+				ToAsset:    &types.Asset{ID: to},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to copy relation %d: %w", r.ID, err)
+			}
+			rels[r.ID] = imported.ID
+		}
+	}
+
+	var lastSource uint64
+	last = 0
+	for {
+		rows, err := as.repository.RelationSourceRowsAfter(last, lastSource, copyBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, rs := range rows {
+			last, lastSource = rs.RelationID, rs.SourceID
+
+			rel, found := rels[rs.RelationID]
+			if !found {
+				continue
+			}
+			src, found := ids[rs.SourceID]
+			if !found {
+				continue
+			}
+
+			if err := dest.repository.ImportRelationSource(rel, src, rs); err != nil {
+				return fmt.Errorf("failed to copy source %d of relation %d: %w", rs.SourceID, rs.RelationID, err)
+			}
+		}
+	}
+	return nil
+}
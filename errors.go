@@ -0,0 +1,58 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package assetdb
+
+import (
+	"fmt"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+)
+
+// Error describes a failed operation of the assetdb, such as the creation of an asset, and the type of the asset it was applied to.
+// Every method of the AssetDB wraps the errors it returns, including ErrDatabaseClosed, in an Error.
+// The cause is returned by Unwrap, so errors.Is and errors.As still match the errors returned by gorm and the database driver.
+type Error struct {
+	Op        string        // The assetdb method that failed, such as "Create".
+	AssetType oam.AssetType // The type of the asset the operation was applied to, empty when no asset was provided.
+	Err       error         // The cause of the failure.
+}
+
+// Error returns the operation, the asset type, and the message of the cause.
+func (e *Error) Error() string {
+	if e.AssetType == "" {
+		return fmt.Sprintf("assetdb: %s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("assetdb: %s %s: %v", e.Op, e.AssetType, e.Err)
+}
+
+// Unwrap returns the cause of the failure.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// opError wraps the error in an Error for the operation and asset type, and returns nil when there is no error.
+func opError(op string, atype oam.AssetType, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Op: op, AssetType: atype, Err: err}
+}
+
+// assetType returns the type of the asset, or an empty type when no asset is provided.
+func assetType(a oam.Asset) oam.AssetType {
+	if a == nil {
+		return ""
+	}
+	return a.AssetType()
+}
+
+// storedType returns the type of the stored asset, or an empty type when no asset is provided.
+func storedType(a *types.Asset) oam.AssetType {
+	if a == nil {
+		return ""
+	}
+	return assetType(a.Asset)
+}
@@ -0,0 +1,76 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package assetdb
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Evictor periodically removes the assets that have not been seen within a TTL.
+type Evictor struct {
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// StartEvictor starts a background task that removes the assets last seen more than ttl ago,
+// along with their relations, every interval. The age of the assets is measured with the Clock of the repository.
+// The number of assets removed is logged for each cycle that removes any.
+// The returned Evictor must be stopped before the assetdb is closed, although cycles stop once closing begins.
+func (as *AssetDB) StartEvictor(ttl, interval time.Duration) *Evictor {
+	e := &Evictor{done: make(chan struct{})}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-e.done:
+				return
+			case <-t.C:
+				if err := as.ops.enter(); err != nil {
+					return
+				}
+
+				cutoff := as.repository.Now().Add(-ttl)
+				n, err := as.repository.DeleteAssetsNotSeenSince(cutoff)
+				as.ops.leave()
+				if err != nil {
+					log.Println("[ERROR] failed to evict assets", err)
+					continue
+				}
+				if n > 0 {
+					log.Printf("[INFO] evicted %d assets not seen since %s", n, cutoff.Format(time.RFC3339))
+				}
+			}
+		}
+	}()
+	return e
+}
+
+// PreviewEviction returns the IDs of the assets that an evictor started with the ttl would currently remove,
+// measuring their age with the Clock of the repository as the evictor does.
+// Nothing is removed from the database, so the result can be reviewed before starting the evictor.
+func (as *AssetDB) PreviewEviction(ttl time.Duration) ([]string, error) {
+	if err := as.ops.enter(); err != nil {
+		return nil, opError("PreviewEviction", "", err)
+	}
+	defer as.ops.leave()
+
+	ids, err := as.repository.PreviewDeleteAssetsNotSeenSince(as.repository.Now().Add(-ttl))
+	return ids, opError("PreviewEviction", "", err)
+}
+
+// Stop terminates the evictor and waits for a cycle in progress to finish.
+func (e *Evictor) Stop() {
+	e.once.Do(func() { close(e.done) })
+	e.wg.Wait()
+}
@@ -0,0 +1,157 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package assetdb
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	oam "github.com/owasp-amass/open-asset-model"
+)
+
+// ExportGraphML writes the assets and relations last seen at or after the since parameter to w as a GraphML document,
+// which can be opened by tools such as Gephi. Each asset is a node labeled with its key and holding its asset type,
+// and each relation is a directed edge labeled with its relation type.
+// The rows are read in batches and written as they are read, so only the IDs of the exported assets are held in memory.
+// Assets with content that fails to parse are skipped, along with the relations that reference them,
+// and relations are only exported when both of their assets are.
+// If since.IsZero(), the parameter will be ignored.
+func (as *AssetDB) ExportGraphML(w io.Writer, since time.Time) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(bw, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(bw, `  <key id="label" for="node" attr.name="label" attr.type="string"/>`)
+	fmt.Fprintln(bw, `  <key id="type" for="node" attr.name="type" attr.type="string"/>`)
+	fmt.Fprintln(bw, `  <key id="relation" for="edge" attr.name="label" attr.type="string"/>`)
+	fmt.Fprintln(bw, `  <graph id="assetdb" edgedefault="directed">`)
+
+	err := as.exportGraph(since, func(id uint64, a oam.Asset) error {
+		_, err := fmt.Fprintf(bw, "    <node id=\"n%d\"><data key=\"label\">%s</data><data key=\"type\">%s</data></node>\n",
+			id, xmlEscape(a.Key()), xmlEscape(string(a.AssetType())))
+		return err
+	}, func(id, from, to uint64, rtype string) error {
+		_, err := fmt.Fprintf(bw, "    <edge id=\"e%d\" source=\"n%d\" target=\"n%d\"><data key=\"relation\">%s</data></edge>\n",
+			id, from, to, xmlEscape(rtype))
+		return err
+	})
+	if err != nil {
+		return opError("ExportGraphML", "", err)
+	}
+
+	fmt.Fprintln(bw, "  </graph>")
+	fmt.Fprintln(bw, "</graphml>")
+	return opError("ExportGraphML", "", bw.Flush())
+}
+
+// ExportDOT writes the assets and relations last seen at or after the since parameter to w as a Graphviz DOT digraph.
+// The graph holds the same nodes and edges, read the same way, as the document written by ExportGraphML.
+// If since.IsZero(), the parameter will be ignored.
+func (as *AssetDB) ExportDOT(w io.Writer, since time.Time) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph assetdb {")
+	err := as.exportGraph(since, func(id uint64, a oam.Asset) error {
+		_, err := fmt.Fprintf(bw, "  n%d [label=%s, type=%s];\n", id, dotQuote(a.Key()), dotQuote(string(a.AssetType())))
+		return err
+	}, func(_, from, to uint64, rtype string) error {
+		_, err := fmt.Fprintf(bw, "  n%d -> n%d [label=%s];\n", from, to, dotQuote(rtype))
+		return err
+	})
+	if err != nil {
+		return opError("ExportDOT", "", err)
+	}
+
+	fmt.Fprintln(bw, "}")
+	return opError("ExportDOT", "", bw.Flush())
+}
+
+// exportGraph calls node with each asset and then edge with each relation last seen at or after the since parameter,
+// reading the rows in batches ordered by ID. Relations are skipped unless node was called with both of their assets.
+func (as *AssetDB) exportGraph(since time.Time, node func(uint64, oam.Asset) error, edge func(id, from, to uint64, rtype string) error) error {
+	if err := as.ops.enter(); err != nil {
+		return err
+	}
+	defer as.ops.leave()
+
+	since = as.repository.ResolveSince(since)
+	exported := make(map[uint64]struct{})
+
+	var last uint64
+	for {
+		rows, err := as.repository.AssetRowsAfter(last, copyBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for i := range rows {
+			row := &rows[i]
+			last = row.ID
+
+			if !since.IsZero() && row.LastSeen.Before(since) {
+				continue
+			}
+			parsed, err := row.Parse()
+			if err != nil {
+				continue
+			}
+
+			if err := node(row.ID, parsed); err != nil {
+				return err
+			}
+			exported[row.ID] = struct{}{}
+		}
+	}
+
+	last = 0
+	for {
+		rows, err := as.repository.RelationRowsAfter(last, copyBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			last = row.ID
+
+			if !since.IsZero() && row.LastSeen.Before(since) {
+				continue
+			}
+			if _, found := exported[row.FromAssetID]; !found {
+				continue
+			}
+			if _, found := exported[row.ToAssetID]; !found {
+				continue
+			}
+
+			if err := edge(row.ID, row.FromAssetID, row.ToAssetID, row.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// xmlEscape returns the text escaped for use as XML character data.
+func xmlEscape(s string) string {
+	var b strings.Builder
+
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// dotQuote returns the text as a double-quoted DOT string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
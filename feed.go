@@ -0,0 +1,98 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package assetdb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/owasp-amass/asset-db/repository"
+	"github.com/owasp-amass/asset-db/types"
+)
+
+// SubscriptionBuffer is the number of assets buffered for each subscriber.
+// Assets created while the buffer of a subscriber is full are dropped for that subscriber.
+const SubscriptionBuffer = 256
+
+// feed fans out the newly created assets to the subscribers.
+type feed struct {
+	sync.RWMutex
+	subs map[chan *types.Asset]struct{}
+}
+
+// publish delivers the asset to every subscriber with room in its buffer, without blocking the writer.
+func (f *feed) publish(a *types.Asset) {
+	f.RLock()
+	defer f.RUnlock()
+
+	for ch := range f.subs {
+		select {
+		case ch <- a:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel that receives each asset stored as a new row by Create, along with a function that ends the subscription.
+// Assets are delivered after they are committed, and up to SubscriptionBuffer assets are buffered for a subscriber;
+// assets created while the buffer is full are dropped for that subscriber, so a slow consumer never blocks the writers.
+// The channel is closed once the subscription ends.
+func (as *AssetDB) Subscribe() (<-chan *types.Asset, func()) {
+	ch := make(chan *types.Asset, SubscriptionBuffer)
+
+	as.feed.Lock()
+	if as.feed.subs == nil {
+		as.feed.subs = make(map[chan *types.Asset]struct{})
+	}
+	as.feed.subs[ch] = struct{}{}
+	as.feed.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			as.feed.Lock()
+			delete(as.feed.subs, ch)
+			close(ch)
+			as.feed.Unlock()
+		})
+	}
+}
+
+// SubscribeChanges returns a channel that receives the assets and relations inserted into the database, until the context is done.
+// On Postgres, the rows are announced by the database once their transaction commits, so the changes made by other processes
+// sharing the database are delivered as well, and a connection is held for the subscription.
+// Other databases fall back to the in-process feed of Subscribe, which only delivers the assets created through this AssetDB.
+// Up to SubscriptionBuffer changes are buffered, and changes received while the buffer is full are dropped.
+// The channel is closed once the context is done or the subscription fails.
+func (as *AssetDB) SubscribeChanges(ctx context.Context) (<-chan *types.Change, error) {
+	if as.repository.GetDBType() == string(repository.Postgres) {
+		ch, err := as.repository.ListenChanges(ctx)
+		return ch, opError("SubscribeChanges", "", err)
+	}
+
+	assets, cancel := as.Subscribe()
+	ch := make(chan *types.Change, SubscriptionBuffer)
+	go func() {
+		defer close(ch)
+		defer cancel()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case a, ok := <-assets:
+				if !ok {
+					return
+				}
+
+				select {
+				case ch <- &types.Change{Table: "assets", ID: a.ID, Type: string(a.Asset.AssetType())}:
+				default:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,217 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package assetdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/owasp-amass/asset-db/repository"
+	oam "github.com/owasp-amass/open-asset-model"
+)
+
+// DefaultIngestBatchSize is the number of items committed together by an Ingestor created with a batch size of zero.
+const DefaultIngestBatchSize = 100
+
+// ErrIngestorClosed is returned by the methods of an Ingestor called after Close.
+var ErrIngestorClosed = errors.New("the ingestor is closed")
+
+// IngestItem is an asset pushed onto an Ingestor, along with the relation linking it from another asset, if any.
+type IngestItem struct {
+	Asset    oam.Asset // The asset to store.
+	Source   oam.Asset // The asset the relation starts from, stored as well, or nil when the asset is not linked.
+	Relation string    // The type of the relation from the source to the asset.
+}
+
+// Ingestor buffers the assets pushed onto it and commits them in batches, each within a single transaction,
+// which is the high-throughput write path for collectors. The buffer holds a single batch, so Push blocks
+// while a batch is committed and the buffer is full, slowing the producers down to the pace of the database.
+// An Ingestor is safe for concurrent use by multiple goroutines, and must be closed before the assetdb is closed.
+type Ingestor struct {
+	as      *AssetDB
+	size    int
+	items   chan IngestItem
+	flushes chan chan error
+	done    chan struct{}
+	mu      sync.RWMutex
+	closed  bool
+	wg      sync.WaitGroup
+	errs    []error
+}
+
+// NewIngestor starts an Ingestor committing the items pushed onto it once batchSize items are buffered,
+// or every flushInterval when the interval is positive. A batchSize of zero uses DefaultIngestBatchSize.
+func (as *AssetDB) NewIngestor(batchSize int, flushInterval time.Duration) *Ingestor {
+	if batchSize <= 0 {
+		batchSize = DefaultIngestBatchSize
+	}
+
+	in := &Ingestor{
+		as:      as,
+		size:    batchSize,
+		items:   make(chan IngestItem, batchSize),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+	}
+
+	in.wg.Add(1)
+	go in.run(flushInterval)
+	return in
+}
+
+// Push adds the item to the buffer of the Ingestor, blocking while the buffer is full until a batch is committed
+// or the context is done. The item is committed later, so errors storing it are returned by Flush or Close.
+// It returns ErrIngestorClosed after Close, and the context error if the context is done first.
+func (in *Ingestor) Push(ctx context.Context, item IngestItem) error {
+	if item.Asset == nil {
+		return errors.New("no asset provided")
+	}
+
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+
+	if in.closed {
+		return ErrIngestorClosed
+	}
+
+	select {
+	case in.items <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush commits the items pushed before it was called and waits for them to be stored.
+// It returns the errors met committing the items since the previous call to Flush, if any.
+func (in *Ingestor) Flush() error {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+
+	if in.closed {
+		return ErrIngestorClosed
+	}
+
+	errc := make(chan error)
+	in.flushes <- errc
+	return <-errc
+}
+
+// Close stops accepting items, commits the items remaining in the buffer and waits for them to be stored.
+// It returns the errors met committing the items since the previous call to Flush, if any.
+func (in *Ingestor) Close() error {
+	in.mu.Lock()
+	if in.closed {
+		in.mu.Unlock()
+		return ErrIngestorClosed
+	}
+	// the pushes in progress have finished once the lock is held, so every item accepted is in the buffer
+	in.closed = true
+	in.mu.Unlock()
+
+	close(in.done)
+	in.wg.Wait()
+	return in.takeErrors()
+}
+
+// run collects the items into batches and commits them until the Ingestor is closed.
+func (in *Ingestor) run(flushInterval time.Duration) {
+	defer in.wg.Done()
+
+	var tick <-chan time.Time
+	if flushInterval > 0 {
+		t := time.NewTicker(flushInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	batch := make([]IngestItem, 0, in.size)
+	for {
+		select {
+		case item := <-in.items:
+			if batch = append(batch, item); len(batch) >= in.size {
+				batch = in.commit(batch)
+			}
+		case <-tick:
+			batch = in.commit(batch)
+		case errc := <-in.flushes:
+			batch = in.commit(in.drain(batch))
+			errc <- in.takeErrors()
+		case <-in.done:
+			in.commit(in.drain(batch))
+			return
+		}
+	}
+}
+
+// drain appends the items waiting in the buffer to the batch, committing each batch filled along the way.
+func (in *Ingestor) drain(batch []IngestItem) []IngestItem {
+	for {
+		select {
+		case item := <-in.items:
+			if batch = append(batch, item); len(batch) >= in.size {
+				batch = in.commit(batch)
+			}
+		default:
+			return batch
+		}
+	}
+}
+
+// commit stores the batch within a single transaction and returns the emptied batch.
+// When the transaction fails, the items are stored one at a time, so a single invalid item does not discard the batch.
+func (in *Ingestor) commit(batch []IngestItem) []IngestItem {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := in.as.ops.enter(); err != nil {
+		in.errs = append(in.errs, opError("Ingest", "", err))
+		return batch[:0]
+	}
+	defer in.as.ops.leave()
+
+	err := in.as.repository.Transaction(func(r repository.Repository) error {
+		for _, item := range batch {
+			if err := ingestItem(r, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for _, item := range batch {
+			if err := ingestItem(in.as.repository, item); err != nil {
+				in.errs = append(in.errs, opError("Ingest", assetType(item.Asset), err))
+			}
+		}
+	}
+	return batch[:0]
+}
+
+// takeErrors returns the errors met since the previous call and forgets them.
+func (in *Ingestor) takeErrors() error {
+	err := errors.Join(in.errs...)
+	in.errs = nil
+	return err
+}
+
+// ingestItem stores the asset of the item and, when a source is provided, the source and the relation linking them.
+func ingestItem(r repository.Repository, item IngestItem) error {
+	a, err := r.CreateAsset(item.Asset)
+	if err != nil || item.Source == nil {
+		return err
+	}
+
+	src, err := r.CreateAsset(item.Source)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Link(src, item.Relation, a)
+	return err
+}
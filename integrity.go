@@ -0,0 +1,68 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package assetdb
+
+import "strconv"
+
+// VerifyIntegrity reads every asset stored in the database and attempts to parse its content into its declared type,
+// such as rows left behind by schema drift or a bad write.
+// The rows are read in batches, so only the IDs of the failing rows are held in memory.
+// It returns the IDs of the assets with content that fails to parse, in ascending order, and an error, if any.
+func (as *AssetDB) VerifyIntegrity() ([]string, error) {
+	ids := []string{}
+
+	err := as.verifyIntegrity(func(id string, _ error) error {
+		ids = append(ids, id)
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, opError("VerifyIntegrity", "", err)
+	}
+	return ids, nil
+}
+
+// VerifyIntegrityFunc reads every asset as VerifyIntegrity does and calls fn with the ID of each asset with content
+// that fails to parse, along with the parse error. If fn returns an error, the verification stops and the error is returned wrapped in an Error.
+// If progress is not nil, it is called after each batch with the number of assets checked so far.
+func (as *AssetDB) VerifyIntegrityFunc(fn func(id string, err error) error, progress func(checked int64)) error {
+	return opError("VerifyIntegrityFunc", "", as.verifyIntegrity(fn, progress))
+}
+
+// verifyIntegrity reads the assets in batches and calls fn with each one that fails to parse.
+func (as *AssetDB) verifyIntegrity(fn func(id string, err error) error, progress func(checked int64)) error {
+	if err := as.ops.enter(); err != nil {
+		return err
+	}
+	defer as.ops.leave()
+
+	var checked int64
+	var last uint64
+	for {
+		rows, err := as.repository.AssetRowsAfter(last, copyBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for i := range rows {
+			row := &rows[i]
+			last = row.ID
+
+			if _, err := row.Parse(); err != nil {
+				if err := fn(strconv.FormatUint(row.ID, 10), err); err != nil {
+					return err
+				}
+			}
+		}
+
+		checked += int64(len(rows))
+		if progress != nil {
+			progress(checked)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+-- +migrate Up
+
+-- The SHA-256 hash of the asset type and key field, used to find duplicate assets with an index seek
+ALTER TABLE assets ADD COLUMN hash VARCHAR(64);
+
+-- Backfill the hash for existing rows, keeping it on the lowest id when duplicates are already present
+-- Each field is prefixed with its length in bytes, as the repository does when hashing an asset
+UPDATE assets SET hash = h.hash
+FROM (
+    SELECT DISTINCT ON (hash) id, hash
+    FROM (
+        SELECT id, encode(sha256(convert_to(
+            octet_length(type) || ':' || type || octet_length(key_field) || ':' || key_field, 'UTF8')), 'hex') AS hash
+        FROM (
+            SELECT id, type, (
+                CASE type
+                    WHEN 'FQDN' THEN content->>'name'
+                    WHEN 'NetworkEndpoint' THEN content->>'address'
+                    WHEN 'IPAddress' THEN content->>'address'
+                    WHEN 'AutonomousSystem' THEN content->>'number'
+                    WHEN 'AutnumRecord' THEN content->>'handle'
+                    WHEN 'Netblock' THEN content->>'cidr'
+                    WHEN 'IPNetRecord' THEN content->>'handle'
+                    WHEN 'SocketAddress' THEN content->>'address'
+                    WHEN 'DomainRecord' THEN content->>'domain'
+                    WHEN 'Fingerprint' THEN content->>'value'
+                    WHEN 'Organization' THEN content->>'name'
+                    WHEN 'Person' THEN content->>'full_name'
+                    WHEN 'Phone' THEN content->>'raw'
+                    WHEN 'EmailAddress' THEN content->>'address'
+                    WHEN 'Location' THEN content->>'address'
+                    WHEN 'ContactRecord' THEN content->>'discovered_at'
+                    WHEN 'TLSCertificate' THEN content->>'serial_number'
+                    WHEN 'URL' THEN content->>'url'
+                    WHEN 'Source' THEN content->>'name'
+                    WHEN 'Service' THEN content->>'identifier'
+                END) AS key_field
+            FROM assets
+        ) AS keyed
+    ) AS hashed
+    WHERE hash IS NOT NULL
+    ORDER BY hash, id
+) AS h
+WHERE assets.id = h.id;
+
+-- Rows left without a hash are still found by their content, since the unique index allows NULLs
+CREATE UNIQUE INDEX idx_assets_hash ON assets (hash);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_assets_hash;
+ALTER TABLE assets DROP COLUMN hash;
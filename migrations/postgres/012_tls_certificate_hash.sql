@@ -0,0 +1,26 @@
+-- +migrate Up
+
+-- TLS certificates are matched on the serial number and issuer, so their hash is recomputed
+UPDATE assets SET hash = NULL WHERE type = 'TLSCertificate';
+
+UPDATE assets SET hash = h.hash
+FROM (
+    SELECT DISTINCT ON (hash) id, hash
+    FROM (
+        SELECT id, encode(sha256(convert_to('14:TLSCertificate' ||
+            octet_length(key_field) || ':' || key_field || octet_length(extra) || ':' || extra, 'UTF8')), 'hex') AS hash
+        FROM (
+            SELECT id, content->>'serial_number' AS key_field, coalesce(content->>'issuer_common_name', '') AS extra
+            FROM assets
+            WHERE type = 'TLSCertificate'
+        ) AS keyed
+    ) AS hashed
+    WHERE hash IS NOT NULL
+    ORDER BY hash, id
+) AS h
+WHERE assets.id = h.id;
+
+-- +migrate Down
+
+-- TLS certificates without a hash are found by their content until the hash is backfilled
+UPDATE assets SET hash = NULL WHERE type = 'TLSCertificate';
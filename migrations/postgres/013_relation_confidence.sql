@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- The confidence of the observation, for relations linking an asset to the source that discovered it
+ALTER TABLE relations ADD COLUMN confidence INTEGER NOT NULL DEFAULT 0;
+
+-- +migrate Down
+
+ALTER TABLE relations DROP COLUMN confidence;
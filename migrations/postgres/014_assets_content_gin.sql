@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- Index the `content` jsonb for the containment queries used to match assets by their content
+CREATE INDEX idx_assets_content ON assets USING gin (content jsonb_path_ops);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_assets_content;
@@ -0,0 +1,15 @@
+-- +migrate Up
+
+-- The raw data (e.g. a DNS response or HTTP header dump) that produced an asset
+-- Kept apart from the assets table so that asset queries never read the blobs
+CREATE TABLE IF NOT EXISTS asset_raw(
+    asset_id INT PRIMARY KEY,
+    raw BYTEA,
+    CONSTRAINT fk_raw_asset
+        FOREIGN KEY (asset_id)
+        REFERENCES assets(id)
+        ON DELETE CASCADE);
+
+-- +migrate Down
+
+DROP TABLE asset_raw;
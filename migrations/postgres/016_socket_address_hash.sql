@@ -0,0 +1,26 @@
+-- +migrate Up
+
+-- Socket addresses are matched on the address and protocol, so their hash is recomputed
+UPDATE assets SET hash = NULL WHERE type = 'SocketAddress';
+
+UPDATE assets SET hash = h.hash
+FROM (
+    SELECT DISTINCT ON (hash) id, hash
+    FROM (
+        SELECT id, encode(sha256(convert_to('13:SocketAddress' ||
+            octet_length(key_field) || ':' || key_field || octet_length(extra) || ':' || extra, 'UTF8')), 'hex') AS hash
+        FROM (
+            SELECT id, content->>'address' AS key_field, coalesce(content->>'protocol', '') AS extra
+            FROM assets
+            WHERE type = 'SocketAddress'
+        ) AS keyed
+    ) AS hashed
+    WHERE hash IS NOT NULL
+    ORDER BY hash, id
+) AS h
+WHERE assets.id = h.id;
+
+-- +migrate Down
+
+-- Socket addresses without a hash are found by their content until the hash is backfilled
+UPDATE assets SET hash = NULL WHERE type = 'SocketAddress';
@@ -0,0 +1,16 @@
+-- +migrate Up
+
+-- Remove the duplicate relations stored by concurrent writers, keeping the lowest id
+DELETE FROM relations a
+USING relations b
+WHERE a.from_asset_id = b.from_asset_id
+    AND a.to_asset_id = b.to_asset_id
+    AND a.type = b.type
+    AND a.id > b.id;
+
+-- A relation is stored once for each pair of assets and relation type, so concurrent links cannot duplicate it
+CREATE UNIQUE INDEX idx_relations_unique ON relations (from_asset_id, to_asset_id, type);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_relations_unique;
@@ -0,0 +1,13 @@
+-- +migrate Up
+
+-- The version of the schema is checked by the repository when it is created, so code built for a different schema
+-- does not write into the database. Every later migration must update the version to its own number.
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER NOT NULL
+);
+
+INSERT INTO schema_version (version) VALUES (18);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS schema_version;
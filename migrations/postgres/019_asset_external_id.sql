@@ -0,0 +1,16 @@
+-- +migrate Up
+
+-- The stable identifier assigned to the asset by an external system, which identifies the asset across databases
+ALTER TABLE assets ADD COLUMN external_id VARCHAR(255);
+
+-- Assets without an external ID are not covered by the unique index, since it allows NULLs
+CREATE UNIQUE INDEX idx_assets_type_external_id ON assets (type, external_id);
+
+UPDATE schema_version SET version = 19;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 18;
+
+DROP INDEX IF EXISTS idx_assets_type_external_id;
+ALTER TABLE assets DROP COLUMN external_id;
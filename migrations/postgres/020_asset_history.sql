@@ -0,0 +1,24 @@
+-- +migrate Up
+
+-- The previous contents of an asset, kept when the asset is stored again with a different content
+CREATE TABLE IF NOT EXISTS asset_history(
+    id SERIAL PRIMARY KEY,
+    asset_id INT NOT NULL,
+    type VARCHAR(255),
+    content JSONB,
+    last_seen TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    replaced_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_history_asset
+        FOREIGN KEY (asset_id)
+        REFERENCES assets(id)
+        ON DELETE CASCADE);
+
+CREATE INDEX idx_asset_history_asset_id ON asset_history (asset_id, id);
+
+UPDATE schema_version SET version = 20;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 19;
+
+DROP TABLE asset_history;
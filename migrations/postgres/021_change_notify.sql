@@ -0,0 +1,28 @@
+-- +migrate Up
+
+-- Notify the listeners of the asset_db_changes channel of each asset and relation inserted, once the transaction commits
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION asset_db_notify_change() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('asset_db_changes',
+        json_build_object('table', TG_TABLE_NAME, 'id', NEW.id::text, 'type', NEW.type)::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER assets_notify_change AFTER INSERT ON assets
+    FOR EACH ROW EXECUTE FUNCTION asset_db_notify_change();
+
+CREATE TRIGGER relations_notify_change AFTER INSERT ON relations
+    FOR EACH ROW EXECUTE FUNCTION asset_db_notify_change();
+
+UPDATE schema_version SET version = 21;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 20;
+
+DROP TRIGGER relations_notify_change ON relations;
+DROP TRIGGER assets_notify_change ON assets;
+DROP FUNCTION asset_db_notify_change();
@@ -0,0 +1,27 @@
+-- +migrate Up
+
+-- The sources asserting each relation, along with when they first and last asserted it
+CREATE TABLE IF NOT EXISTS relation_sources(
+    relation_id INT NOT NULL,
+    source_id INT NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_seen TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (relation_id, source_id),
+    CONSTRAINT fk_relation_sources_relation
+        FOREIGN KEY (relation_id)
+        REFERENCES relations(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_relation_sources_source
+        FOREIGN KEY (source_id)
+        REFERENCES assets(id)
+        ON DELETE CASCADE);
+
+CREATE INDEX idx_relation_sources_source_id ON relation_sources (source_id);
+
+UPDATE schema_version SET version = 22;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 21;
+
+DROP TABLE relation_sources;
@@ -0,0 +1,12 @@
+-- +migrate Up
+
+-- Index the country of the Location assets, so they can be found by country without reading every Location
+CREATE INDEX idx_assets_location_country ON assets (type, (UPPER(content->>'country')));
+
+UPDATE schema_version SET version = 23;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 22;
+
+DROP INDEX idx_assets_location_country;
@@ -0,0 +1,12 @@
+-- +migrate Up
+
+-- Index the created date of the registration records, so they can be found by the date they were registered
+CREATE INDEX idx_assets_created_date ON assets (type, (content->>'created_date'));
+
+UPDATE schema_version SET version = 24;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 23;
+
+DROP INDEX idx_assets_created_date;
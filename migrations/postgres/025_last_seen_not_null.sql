@@ -0,0 +1,19 @@
+-- +migrate Up
+
+-- Rows stored without a last seen timestamp, such as rows inserted with raw SQL, cannot be read and never match a since filter,
+-- so they are given the time they were created, as are the rows holding the zero time or a time before their creation
+UPDATE assets SET last_seen = COALESCE(created_at, CURRENT_TIMESTAMP) WHERE last_seen IS NULL OR last_seen < created_at;
+UPDATE relations SET last_seen = COALESCE(created_at, CURRENT_TIMESTAMP) WHERE last_seen IS NULL OR last_seen < created_at;
+
+-- Reject the rows stored without a last seen timestamp from now on
+ALTER TABLE assets ALTER COLUMN last_seen SET NOT NULL;
+ALTER TABLE relations ALTER COLUMN last_seen SET NOT NULL;
+
+UPDATE schema_version SET version = 25;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 24;
+
+ALTER TABLE relations ALTER COLUMN last_seen DROP NOT NULL;
+ALTER TABLE assets ALTER COLUMN last_seen DROP NOT NULL;
@@ -0,0 +1,18 @@
+-- +migrate Up
+
+-- The names of organizations and persons are matched regardless of case, so their hashes are computed from the lowercased name.
+-- The hashes are computed by the application, so they are cleared here and assigned again by BackfillAssetHashes,
+-- while the rows without a hash are still found by the lowercased name
+UPDATE assets SET hash = NULL WHERE type IN ('Organization', 'Person');
+
+CREATE INDEX idx_assets_organization_name ON assets (type, LOWER(content->>'name'));
+CREATE INDEX idx_assets_person_full_name ON assets (type, LOWER(content->>'full_name'));
+
+UPDATE schema_version SET version = 26;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 25;
+
+DROP INDEX idx_assets_person_full_name;
+DROP INDEX idx_assets_organization_name;
@@ -0,0 +1,23 @@
+-- +migrate Up
+
+-- The tags attached to assets by users, kept apart from the content of the assets
+CREATE TABLE IF NOT EXISTS asset_tags(
+    asset_id INT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (asset_id, key),
+    CONSTRAINT fk_asset_tags_assets
+        FOREIGN KEY (asset_id)
+        REFERENCES assets(id)
+        ON DELETE CASCADE);
+
+CREATE INDEX idx_asset_tags_key_value ON asset_tags (key, value);
+
+UPDATE schema_version SET version = 27;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 26;
+
+DROP TABLE asset_tags;
@@ -0,0 +1,12 @@
+-- +migrate Up
+
+-- Serves the incoming relations of an asset filtered by their weight, such as the traversals following incoming relations
+CREATE INDEX idx_relations_to_weight ON relations (to_asset_id, weight);
+
+UPDATE schema_version SET version = 29;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 28;
+
+DROP INDEX IF EXISTS idx_relations_to_weight;
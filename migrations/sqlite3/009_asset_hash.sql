@@ -0,0 +1,13 @@
+-- +migrate Up
+
+-- The SHA-256 hash of the asset type and key field, used to find duplicate assets with an index seek
+-- SQLite provides no SHA-256 function, so existing rows are backfilled by the repository (BackfillAssetHashes)
+ALTER TABLE assets ADD COLUMN hash TEXT;
+
+-- Rows left without a hash are still found by their content, since the unique index allows NULLs
+CREATE UNIQUE INDEX idx_assets_hash ON assets (hash);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_assets_hash;
+ALTER TABLE assets DROP COLUMN hash;
@@ -0,0 +1,9 @@
+-- +migrate Up
+
+-- TLS certificates are matched on the serial number and issuer, so their hash is cleared and
+-- recomputed by the repository (BackfillAssetHashes)
+UPDATE assets SET hash = NULL WHERE type = 'TLSCertificate';
+
+-- +migrate Down
+
+UPDATE assets SET hash = NULL WHERE type = 'TLSCertificate';
@@ -0,0 +1,9 @@
+-- +migrate Up
+
+-- Socket addresses are matched on the address and protocol, so their hash is cleared and
+-- recomputed by the repository (BackfillAssetHashes)
+UPDATE assets SET hash = NULL WHERE type = 'SocketAddress';
+
+-- +migrate Down
+
+UPDATE assets SET hash = NULL WHERE type = 'SocketAddress';
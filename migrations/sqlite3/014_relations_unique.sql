@@ -0,0 +1,14 @@
+-- +migrate Up
+
+-- Remove the duplicate relations stored by concurrent writers, keeping the lowest id
+DELETE FROM relations
+WHERE id NOT IN (
+    SELECT MIN(id) FROM relations GROUP BY from_asset_id, to_asset_id, type
+);
+
+-- A relation is stored once for each pair of assets and relation type, so concurrent links cannot duplicate it
+CREATE UNIQUE INDEX idx_relations_unique ON relations (from_asset_id, to_asset_id, type);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_relations_unique;
@@ -0,0 +1,21 @@
+-- +migrate Up
+
+-- The previous contents of an asset, kept when the asset is stored again with a different content
+CREATE TABLE IF NOT EXISTS asset_history(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    asset_id INTEGER NOT NULL,
+    type TEXT,
+    content TEXT,
+    last_seen DATETIME NOT NULL,
+    replaced_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(asset_id) REFERENCES assets(id) ON DELETE CASCADE);
+
+CREATE INDEX idx_asset_history_asset_id ON asset_history (asset_id, id);
+
+UPDATE schema_version SET version = 17;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 16;
+
+DROP TABLE asset_history;
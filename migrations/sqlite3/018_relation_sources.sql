@@ -0,0 +1,21 @@
+-- +migrate Up
+
+-- The sources asserting each relation, along with when they first and last asserted it
+CREATE TABLE IF NOT EXISTS relation_sources(
+    relation_id INTEGER NOT NULL,
+    source_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (relation_id, source_id),
+    FOREIGN KEY(relation_id) REFERENCES relations(id) ON DELETE CASCADE,
+    FOREIGN KEY(source_id) REFERENCES assets(id) ON DELETE CASCADE);
+
+CREATE INDEX idx_relation_sources_source_id ON relation_sources (source_id);
+
+UPDATE schema_version SET version = 18;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 17;
+
+DROP TABLE relation_sources;
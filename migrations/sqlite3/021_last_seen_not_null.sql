@@ -0,0 +1,47 @@
+-- +migrate Up
+
+-- Rows stored without a last seen timestamp, such as rows inserted with raw SQL, cannot be read and never match a since filter,
+-- so they are given the time they were created, as are the rows holding the zero time or a time before their creation
+UPDATE assets SET last_seen = COALESCE(created_at, CURRENT_TIMESTAMP) WHERE last_seen IS NULL OR last_seen < created_at;
+UPDATE relations SET last_seen = COALESCE(created_at, CURRENT_TIMESTAMP) WHERE last_seen IS NULL OR last_seen < created_at;
+
+-- SQLite cannot add a NOT NULL constraint to an existing column, so the triggers reject the rows without a last seen timestamp,
+-- as the constraint does on Postgres
+-- +migrate StatementBegin
+CREATE TRIGGER assets_last_seen_insert BEFORE INSERT ON assets WHEN NEW.last_seen IS NULL
+BEGIN
+    SELECT RAISE(ABORT, 'NOT NULL constraint failed: assets.last_seen');
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER assets_last_seen_update BEFORE UPDATE OF last_seen ON assets WHEN NEW.last_seen IS NULL
+BEGIN
+    SELECT RAISE(ABORT, 'NOT NULL constraint failed: assets.last_seen');
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER relations_last_seen_insert BEFORE INSERT ON relations WHEN NEW.last_seen IS NULL
+BEGIN
+    SELECT RAISE(ABORT, 'NOT NULL constraint failed: relations.last_seen');
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER relations_last_seen_update BEFORE UPDATE OF last_seen ON relations WHEN NEW.last_seen IS NULL
+BEGIN
+    SELECT RAISE(ABORT, 'NOT NULL constraint failed: relations.last_seen');
+END;
+-- +migrate StatementEnd
+
+UPDATE schema_version SET version = 21;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 20;
+
+DROP TRIGGER IF EXISTS relations_last_seen_update;
+DROP TRIGGER IF EXISTS relations_last_seen_insert;
+DROP TRIGGER IF EXISTS assets_last_seen_update;
+DROP TRIGGER IF EXISTS assets_last_seen_insert;
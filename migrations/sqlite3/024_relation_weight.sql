@@ -0,0 +1,16 @@
+-- +migrate Up
+
+-- The weight of a relation, such as the confidence of an edge used to propagate risk, left NULL when no weight is assigned
+ALTER TABLE relations ADD COLUMN weight REAL;
+
+-- Serves the outgoing relations of an asset ordered by their weight
+CREATE INDEX idx_relations_from_weight ON relations (from_asset_id, weight);
+
+UPDATE schema_version SET version = 24;
+
+-- +migrate Down
+
+UPDATE schema_version SET version = 23;
+
+DROP INDEX IF EXISTS idx_relations_from_weight;
+ALTER TABLE relations DROP COLUMN weight;
@@ -0,0 +1,60 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package assetdb
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrDatabaseClosed is returned by operations started after the assetdb began closing.
+var ErrDatabaseClosed = errors.New("the database is closed")
+
+// operations tracks the assetdb operations in progress, so closing waits for each of them to finish as a whole.
+type operations struct {
+	sync.Mutex
+	count   int
+	closing bool
+	done    chan struct{}
+}
+
+// enter registers a new operation, or returns ErrDatabaseClosed if the assetdb is closing.
+func (o *operations) enter() error {
+	o.Lock()
+	defer o.Unlock()
+
+	if o.closing {
+		return ErrDatabaseClosed
+	}
+	o.count++
+	return nil
+}
+
+// leave marks an operation registered by enter as finished.
+func (o *operations) leave() {
+	o.Lock()
+	defer o.Unlock()
+
+	o.count--
+	if o.closing && o.count == 0 {
+		close(o.done)
+	}
+}
+
+// close stops new operations from being registered and returns a channel
+// that is closed once all outstanding operations have finished.
+func (o *operations) close() <-chan struct{} {
+	o.Lock()
+	defer o.Unlock()
+
+	if !o.closing {
+		o.closing = true
+		o.done = make(chan struct{})
+		if o.count == 0 {
+			close(o.done)
+		}
+	}
+	return o.done
+}
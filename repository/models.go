@@ -5,32 +5,93 @@
 package repository
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	oam "github.com/owasp-amass/open-asset-model"
 	oamtls "github.com/owasp-amass/open-asset-model/certificate"
-	"github.com/owasp-amass/open-asset-model/contact"
-	"github.com/owasp-amass/open-asset-model/domain"
-	"github.com/owasp-amass/open-asset-model/fingerprint"
 	"github.com/owasp-amass/open-asset-model/network"
-	"github.com/owasp-amass/open-asset-model/org"
-	"github.com/owasp-amass/open-asset-model/people"
-	oamreg "github.com/owasp-amass/open-asset-model/registration"
-	"github.com/owasp-amass/open-asset-model/service"
-	"github.com/owasp-amass/open-asset-model/source"
-	"github.com/owasp-amass/open-asset-model/url"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Asset represents an asset stored in the database.
 type Asset struct {
-	ID        uint64         `gorm:"primaryKey;autoIncrement:true"`                               // The unique identifier of the asset.
-	CreatedAt time.Time      `gorm:"type:datetime;default:CURRENT_TIMESTAMP();column=created_at"` // The creation timestamp of the asset.
-	LastSeen  time.Time      `gorm:"type:datetime;default:CURRENT_TIMESTAMP();column=last_seen"`  // The last seen timestamp of the asset.
-	Type      string         // The type of the asset.
-	Content   datatypes.JSON // The JSON-encoded content of the asset.
+	ID         uint64         `gorm:"primaryKey;autoIncrement:true"`                               // The unique identifier of the asset.
+	CreatedAt  time.Time      `gorm:"type:datetime;default:CURRENT_TIMESTAMP();column=created_at"` // The creation timestamp of the asset.
+	LastSeen   time.Time      `gorm:"type:datetime;default:CURRENT_TIMESTAMP();column=last_seen"`  // The last seen timestamp of the asset.
+	Type       string         // The type of the asset.
+	Content    datatypes.JSON // The JSON-encoded content of the asset.
+	Hash       *string        // The hash of the asset type and key field, used to find duplicate assets.
+	ExternalID *string        // The stable identifier assigned to the asset by an external system, unique per asset type.
+	parsed     atomic.Value   // The parsedAsset cached by AsOAM.
+}
+
+// parsedAsset holds the result of parsing the content of an asset.
+type parsedAsset struct {
+	asset oam.Asset
+	err   error
+}
+
+// AssetRaw represents the raw data that produced an asset, stored apart from the asset so that it is only read on request.
+type AssetRaw struct {
+	AssetID uint64 `gorm:"primaryKey;autoIncrement:false"` // The ID of the asset produced by the raw data.
+	Raw     []byte // The raw data, such as a DNS response or HTTP header dump.
+}
+
+// TableName returns the name of the table storing the raw data of assets.
+func (AssetRaw) TableName() string {
+	return "asset_raw"
+}
+
+// AssetHistory represents a previous content of an asset, kept when the asset is stored again with a different content.
+type AssetHistory struct {
+	ID         uint64         `gorm:"primaryKey;autoIncrement:true"` // The unique identifier of the version.
+	AssetID    uint64         // The ID of the asset the content belonged to.
+	Type       string         // The type of the asset when the content was stored.
+	Content    datatypes.JSON // The JSON-encoded content replaced by a later observation.
+	LastSeen   time.Time      // The last time the content was seen before it was replaced.
+	ReplacedAt time.Time      `gorm:"type:datetime;default:CURRENT_TIMESTAMP();"` // The time the content was replaced.
+}
+
+// TableName returns the name of the table storing the previous contents of assets.
+func (AssetHistory) TableName() string {
+	return "asset_history"
+}
+
+// RelationSource represents a source asserting a relation, recorded apart from the relation so that several sources can assert it.
+type RelationSource struct {
+	RelationID uint64    `gorm:"primaryKey;autoIncrement:false"`             // The ID of the relation asserted by the source.
+	SourceID   uint64    `gorm:"primaryKey;autoIncrement:false"`             // The ID of the source asset.
+	CreatedAt  time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP();"` // The first time the source asserted the relation.
+	LastSeen   time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP();"` // The last time the source asserted the relation.
+}
+
+// TableName returns the name of the table storing the sources asserting relations.
+func (RelationSource) TableName() string {
+	return "relation_sources"
+}
+
+// AssetTag represents a tag attached to an asset by a user, stored apart from the content of the asset.
+type AssetTag struct {
+	AssetID   uint64    `gorm:"primaryKey;autoIncrement:false"` // The ID of the tagged asset.
+	Key       string    `gorm:"primaryKey"`                     // The key of the tag, such as "client".
+	Value     string    // The value of the tag, which may be empty.
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP();"` // The time the tag was attached.
+}
+
+// TableName returns the name of the table storing the tags of assets.
+func (AssetTag) TableName() string {
+	return "asset_tags"
 }
 
 // Relation represents a relationship between two assets stored in the database.
@@ -39,177 +100,302 @@ type Relation struct {
 	CreatedAt   time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP();"` // The creation timestamp of the relation.
 	LastSeen    time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP();"` // The last seen timestamp of the relation.
 	Type        string    // The type of the relation.
+	Confidence  int       // The confidence of the observation, when the relation links an asset to its source.
+	Weight      *float64  // The weight of the relation, or nil when no weight was assigned.
 	FromAssetID uint64    // The ID of the asset from which the relation originates.
 	ToAssetID   uint64    // The ID of the asset to which the relation points.
 	FromAsset   Asset     // The asset from which the relation originates.
 	ToAsset     Asset     // The asset to which the relation points.
 }
 
+// ExternalIDValue returns the external ID of the asset, or an empty string if the asset has none.
+func (a *Asset) ExternalIDValue() string {
+	if a.ExternalID == nil {
+		return ""
+	}
+	return *a.ExternalID
+}
+
+// nullableExternalID returns the external ID to store, which is NULL when the ID is empty.
+func nullableExternalID(id string) *string {
+	if id == "" {
+		return nil
+	}
+	return &id
+}
+
 // Parse parses the content of the asset into the corresponding Open Asset Model (OAM) asset type.
 // It returns the parsed asset and an error, if any.
 func (a *Asset) Parse() (oam.Asset, error) {
-	var err error
-	var asset oam.Asset
-
-	switch a.Type {
-	case string(oam.FQDN):
-		var fqdn domain.FQDN
-
-		err = json.Unmarshal(a.Content, &fqdn)
-		asset = &fqdn
-	case string(oam.NetworkEndpoint):
-		var ne domain.NetworkEndpoint
-
-		err = json.Unmarshal(a.Content, &ne)
-		asset = &ne
-	case string(oam.IPAddress):
-		var ip network.IPAddress
-
-		err = json.Unmarshal(a.Content, &ip)
-		asset = &ip
-	case string(oam.AutonomousSystem):
-		var as network.AutonomousSystem
-
-		err = json.Unmarshal(a.Content, &as)
-		asset = &as
-	case string(oam.AutnumRecord):
-		var ar oamreg.AutnumRecord
-
-		err = json.Unmarshal(a.Content, &ar)
-		asset = &ar
-	case string(oam.Netblock):
-		var netblock network.Netblock
-
-		err = json.Unmarshal(a.Content, &netblock)
-		asset = &netblock
-	case string(oam.IPNetRecord):
-		var ipnetrec oamreg.IPNetRecord
-
-		err = json.Unmarshal(a.Content, &ipnetrec)
-		asset = &ipnetrec
-	case string(oam.SocketAddress):
-		var sa network.SocketAddress
-
-		err = json.Unmarshal(a.Content, &sa)
-		asset = &sa
-	case string(oam.DomainRecord):
-		var dr oamreg.DomainRecord
-
-		err = json.Unmarshal(a.Content, &dr)
-		asset = &dr
-	case string(oam.Fingerprint):
-		var fingerprint fingerprint.Fingerprint
-
-		err = json.Unmarshal(a.Content, &fingerprint)
-		asset = &fingerprint
-	case string(oam.Organization):
-		var organization org.Organization
-
-		err = json.Unmarshal(a.Content, &organization)
-		asset = &organization
-	case string(oam.Person):
-		var person people.Person
-
-		err = json.Unmarshal(a.Content, &person)
-		asset = &person
-	case string(oam.Phone):
-		var phone contact.Phone
-
-		err = json.Unmarshal(a.Content, &phone)
-		asset = &phone
-	case string(oam.EmailAddress):
-		var emailAddress contact.EmailAddress
-
-		err = json.Unmarshal(a.Content, &emailAddress)
-		asset = &emailAddress
-	case string(oam.Location):
-		var location contact.Location
-
-		err = json.Unmarshal(a.Content, &location)
-		asset = &location
-	case string(oam.ContactRecord):
-		var cr contact.ContactRecord
-
-		err = json.Unmarshal(a.Content, &cr)
-		asset = &cr
-	case string(oam.TLSCertificate):
-		var tlsCertificate oamtls.TLSCertificate
-
-		err = json.Unmarshal(a.Content, &tlsCertificate)
-		asset = &tlsCertificate
-	case string(oam.URL):
-		var url url.URL
-
-		err = json.Unmarshal(a.Content, &url)
-		asset = &url
-	case string(oam.Source):
-		var src source.Source
-
-		err = json.Unmarshal(a.Content, &src)
-		asset = &src
-	case string(oam.Service):
-		var serv service.Service
-
-		err = json.Unmarshal(a.Content, &serv)
-		asset = &serv
-	default:
-		return nil, fmt.Errorf("unknown asset type: %s", a.Type)
-	}
-
-	return asset, err
+	d, found := assetTypeDescriptor(oam.AssetType(a.Type))
+	if !found {
+		reportUnknownAssetType("Parse", a.Type)
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAssetType, a.Type)
+	}
+	return d.Unmarshal(a.Content)
+}
+
+// ErrUnsupportedAssetType is returned when an asset of a type not supported by the repository is parsed, queried or stored.
+var ErrUnsupportedAssetType = errors.New("unknown asset type")
+
+// unknownAssetTypeHook holds the function registered by SetUnknownAssetTypeHook.
+var unknownAssetTypeHook atomic.Pointer[func(op, atype string)]
+
+// SetUnknownAssetTypeHook registers a function that is called each time Parse or JSONQuery meets an asset type
+// they do not support, with the name of the method and the type, so the types stored by a newer version of the
+// Open Asset Model can be monitored before they cause queries to fail. JSONQuery parses the content first,
+// so a type unknown to Parse is reported once, by Parse. The function replaces any function registered
+// before, and a nil function removes it. It is called synchronously, possibly from multiple goroutines, so it must not block.
+func SetUnknownAssetTypeHook(fn func(op, atype string)) {
+	if fn == nil {
+		unknownAssetTypeHook.Store(nil)
+		return
+	}
+	unknownAssetTypeHook.Store(&fn)
+}
+
+// reportUnknownAssetType calls the function registered by SetUnknownAssetTypeHook, if any.
+func reportUnknownAssetType(op, atype string) {
+	if fn := unknownAssetTypeHook.Load(); fn != nil {
+		(*fn)(op, atype)
+	}
+}
+
+// AsOAM returns the Open Asset Model (OAM) asset parsed from the content, parsing it only on the first call.
+// The result is cached and shared by subsequent calls, including calls made concurrently from multiple goroutines,
+// so the Content must not be modified after AsOAM is called.
+func (a *Asset) AsOAM() (oam.Asset, error) {
+	if p, ok := a.parsed.Load().(parsedAsset); ok {
+		return p.asset, p.err
+	}
+
+	asset, err := a.Parse()
+	// keep the result of the first caller to finish, so every caller receives the same asset
+	a.parsed.CompareAndSwap(nil, parsedAsset{asset: asset, err: err})
+
+	p := a.parsed.Load().(parsedAsset)
+	return p.asset, p.err
+}
+
+// assetHash returns the hex-encoded SHA-256 hash of the asset type and the identity fields matched by JSONQuery.
+// Assets that would be matched by JSONQuery produce the same hash.
+func assetHash(asset oam.Asset) string {
+	sum := sha256.Sum256([]byte(ContentsKey(asset)))
+	return hex.EncodeToString(sum[:])
 }
 
 // JSONQuery generates a JSON query expression based on the asset's content.
+// Assets are matched on every field returned by IdentityFields, so TLS certificates are also matched on the issuer,
+// since serial numbers are only unique per issuer, and socket addresses are also matched on the protocol.
+// The names of organizations and persons are matched regardless of case, by comparing the lowercased key field,
+// while the other fields are matched exactly. On Postgres, the exact matches use jsonb containment.
 // It returns the generated JSON query expression and an error, if any.
-func (a *Asset) JSONQuery() (*datatypes.JSONQueryExpression, error) {
+func (a *Asset) JSONQuery() (clause.Expression, error) {
 	asset, err := a.Parse()
 	if err != nil {
 		return nil, err
 	}
 
-	jsonQuery := datatypes.JSONQuery("content")
+	field, value, err := keyField(asset)
+	if err != nil {
+		reportUnknownAssetType("JSONQuery", a.Type)
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAssetType, a.Type)
+	}
+
+	fields, err := IdentityFields(asset)
+	if err != nil {
+		return nil, err
+	}
+
+	if caseInsensitive(asset.AssetType()) {
+		// the field is the key field of the type, so it is safe to place within the statement
+		return clause.Expr{
+			SQL:  fmt.Sprintf("LOWER(content->>'%s') = ?", field),
+			Vars: []interface{}{strings.ToLower(asset.Key())},
+		}, nil
+	}
+
+	// the key field keeps its JSON type, so numeric keys are matched as numbers
+	query := jsonEquals(value, field)
+	for _, f := range fields[1:] {
+		query = query.And(f.Value, f.Name)
+	}
+	return query, nil
+}
+
+// caseInsensitiveTypes are the asset types identified by a name that sources write with varying case,
+// so their key field is matched regardless of case while the content keeps the case it was last stored with.
+// FQDNs and email addresses are lowercased by the normalization of the repository instead, and the key fields
+// of the other types, such as fingerprints, serial numbers and handles, are matched exactly.
+var caseInsensitiveTypes = []oam.AssetType{oam.Organization, oam.Person}
+
+// caseInsensitive reports whether the key field of the asset type is matched regardless of case.
+func caseInsensitive(atype oam.AssetType) bool {
+	return slices.Contains(caseInsensitiveTypes, atype)
+}
+
+// IdentityField is a field of the JSON content that identifies an asset within its asset type.
+type IdentityField struct {
+	Name  string // The name of the field in the JSON content of the asset.
+	Value string // The value of the field.
+}
+
+// IdentityFields returns every field identifying the provided asset within its asset type, starting with the key field.
+// Most assets are identified by the key field alone, as returned by KeyField, while TLS certificates are also identified
+// by the issuer and socket addresses by the protocol.
+// It returns an error if the asset type is not supported.
+func IdentityFields(asset oam.Asset) ([]IdentityField, error) {
+	asset = assetPointer(asset)
+
+	field, _, err := keyField(asset)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []IdentityField{{Name: field, Value: asset.Key()}}
 	switch v := asset.(type) {
-	case *domain.FQDN:
-		return jsonQuery.Equals(v.Name, "name"), nil
-	case *domain.NetworkEndpoint:
-		return jsonQuery.Equals(v.Address, "address"), nil
-	case *network.SocketAddress:
-		return jsonQuery.Equals(v.Address.String(), "address"), nil
-	case *network.IPAddress:
-		return jsonQuery.Equals(v.Address.String(), "address"), nil
-	case *network.AutonomousSystem:
-		return jsonQuery.Equals(v.Number, "number"), nil
-	case *network.Netblock:
-		return jsonQuery.Equals(v.CIDR.String(), "cidr"), nil
-	case *oamreg.IPNetRecord:
-		return jsonQuery.Equals(v.Handle, "handle"), nil
-	case *oamreg.AutnumRecord:
-		return jsonQuery.Equals(v.Handle, "handle"), nil
-	case *oamreg.DomainRecord:
-		return jsonQuery.Equals(v.Domain, "domain"), nil
-	case *fingerprint.Fingerprint:
-		return jsonQuery.Equals(v.Value, "value"), nil
-	case *org.Organization:
-		return jsonQuery.Equals(v.Name, "name"), nil
-	case *people.Person:
-		return jsonQuery.Equals(v.FullName, "full_name"), nil
-	case *contact.Phone:
-		return jsonQuery.Equals(v.Raw, "raw"), nil
-	case *contact.EmailAddress:
-		return jsonQuery.Equals(v.Address, "address"), nil
-	case *contact.Location:
-		return jsonQuery.Equals(v.Address, "address"), nil
-	case *contact.ContactRecord:
-		return jsonQuery.Equals(v.DiscoveredAt, "discovered_at"), nil
 	case *oamtls.TLSCertificate:
-		return jsonQuery.Equals(v.SerialNumber, "serial_number"), nil
-	case *url.URL:
-		return jsonQuery.Equals(v.Raw, "url"), nil
-	case *source.Source:
-		return jsonQuery.Equals(v.Name, "name"), nil
-	case *service.Service:
-		return jsonQuery.Equals(v.Identifier, "identifier"), nil
+		fields = append(fields, IdentityField{Name: "issuer_common_name", Value: v.IssuerCommonName})
+	case *network.SocketAddress:
+		// the address includes the port, while the same address is a distinct asset for each protocol
+		fields = append(fields, IdentityField{Name: "protocol", Value: v.Protocol})
+	}
+	return fields, nil
+}
+
+// KeyField returns the name and value of the key field of the provided asset within its asset type.
+// The field is named as in the JSON content of the asset, and the value is the Key of the asset.
+// Some asset types are identified by more than the key field; use IdentityFields to get every identifying field.
+// It returns an error if the asset type is not supported.
+func KeyField(asset oam.Asset) (field string, value string, err error) {
+	asset = assetPointer(asset)
+
+	field, _, err = keyField(asset)
+	if err != nil {
+		return "", "", err
+	}
+	return field, asset.Key(), nil
+}
+
+// assetPointer returns the asset as a pointer, since the assets are also accepted by value while keyField expects pointers.
+func assetPointer(asset oam.Asset) oam.Asset {
+	if v := reflect.ValueOf(asset); v.IsValid() && v.Kind() != reflect.Pointer {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return p.Interface().(oam.Asset)
+	}
+	return asset
+}
+
+// checkSupported returns an error wrapping ErrUnsupportedAssetType if the type of the asset is not supported.
+// Each write storing an asset calls it before any statement, since an asset of an unsupported type could be
+// neither parsed nor found once stored.
+func checkSupported(asset oam.Asset) error {
+	_, _, err := keyField(assetPointer(asset))
+	return err
+}
+
+// keyField returns the name of the field identifying the asset and its value, as stored in the JSON content.
+func keyField(asset oam.Asset) (string, interface{}, error) {
+	if asset == nil {
+		return "", nil, errors.New("no asset provided")
+	}
+
+	d, found := assetTypeDescriptor(asset.AssetType())
+	if !found {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnsupportedAssetType, asset.AssetType())
+	}
+	return d.KeyField(asset)
+}
+
+// contentFields returns the JSON names of the top-level fields of the content of the asset type.
+// It fails when the asset type does not parse its content into a pointer to a struct.
+func contentFields(atype oam.AssetType) ([]string, error) {
+	a, err := (&Asset{Type: string(atype), Content: []byte("{}")}).Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(a)
+	if !v.IsValid() || v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("the content of the %s asset type is not parsed into a pointer to a struct", atype)
+	}
+
+	var fields []string
+	t := v.Elem().Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+// jsonFields matches the assets holding the provided value for each field of their JSON content.
+// A field can be nested within objects of the content, in which case it is reached by the path of keys leading to it.
+// On Postgres, the match is rendered as a jsonb containment, which is accelerated by the GIN index on the content column.
+// Other databases compare the values extracted by datatypes.JSONQuery.
+type jsonFields []jsonField
+
+type jsonField struct {
+	path  []string
+	value interface{}
+}
+
+// jsonEquals returns a match on the value of the field.
+func jsonEquals(value interface{}, key string) jsonFields {
+	return jsonFields{{path: []string{key}, value: value}}
+}
+
+// jsonPathEquals returns a match on the value of the field reached by the path of keys.
+func jsonPathEquals(value interface{}, path ...string) jsonFields {
+	return jsonFields{{path: path, value: value}}
+}
+
+// And adds a match on the value of another field.
+func (f jsonFields) And(value interface{}, key string) jsonFields {
+	return append(f, jsonField{path: []string{key}, value: value})
+}
+
+// Build implements the clause.Expression interface.
+func (f jsonFields) Build(builder clause.Builder) {
+	if stmt, ok := builder.(*gorm.Statement); ok && stmt.Dialector.Name() == "postgres" {
+		doc := make(map[string]interface{}, len(f))
+		for _, field := range f {
+			// nest the value within an object for each key leading to the field
+			obj := doc
+			for _, key := range field.path[:len(field.path)-1] {
+				next, ok := obj[key].(map[string]interface{})
+				if !ok {
+					next = make(map[string]interface{})
+					obj[key] = next
+				}
+				obj = next
+			}
+			obj[field.path[len(field.path)-1]] = field.value
+		}
+
+		content, err := json.Marshal(doc)
+		if err != nil {
+			_ = stmt.AddError(err)
+			return
+		}
+
+		stmt.WriteQuoted("content")
+		stmt.WriteString(" @> ")
+		stmt.AddVar(stmt, string(content))
+		stmt.WriteString("::jsonb")
+		return
 	}
 
-	return nil, fmt.Errorf("unknown asset type: %s", a.Type)
+	exprs := make([]clause.Expression, 0, len(f))
+	for _, field := range f {
+		exprs = append(exprs, datatypes.JSONQuery("content").Equals(field.value, field.path...))
+	}
+	if len(exprs) == 1 {
+		exprs[0].Build(builder)
+		return
+	}
+	clause.And(exprs...).Build(builder)
 }
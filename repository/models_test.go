@@ -5,9 +5,12 @@
 package repository
 
 import (
+	"encoding/json"
 	"net/netip"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/glebarez/sqlite"
 	oam "github.com/owasp-amass/open-asset-model"
@@ -24,6 +27,7 @@ import (
 	"github.com/owasp-amass/open-asset-model/url"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func TestModels(t *testing.T) {
@@ -144,7 +148,7 @@ func TestModels(t *testing.T) {
 		testCases := []struct {
 			description   string
 			asset         oam.Asset
-			expectedQuery *datatypes.JSONQueryExpression
+			expectedQuery clause.Expression
 		}{
 			{
 				description:   "json query for fqdn",
@@ -182,14 +186,17 @@ func TestModels(t *testing.T) {
 				expectedQuery: datatypes.JSONQuery("content").Equals(64496, "number"),
 			},
 			{
-				description:   "json query for socket address",
-				asset:         &network.SocketAddress{Address: netip.MustParseAddrPort("192.168.1.1:443")},
-				expectedQuery: datatypes.JSONQuery("content").Equals("192.168.1.1:443", "address"),
+				description: "json query for socket address",
+				asset:       &network.SocketAddress{Address: netip.MustParseAddrPort("192.168.1.1:443"), Protocol: "tcp"},
+				expectedQuery: clause.Expr{SQL: "(? AND ?)", Vars: []interface{}{
+					datatypes.JSONQuery("content").Equals("192.168.1.1:443", "address"),
+					datatypes.JSONQuery("content").Equals("tcp", "protocol"),
+				}},
 			},
 			{
 				description:   "json query for person",
 				asset:         &people.Person{FullName: "John Doe"},
-				expectedQuery: datatypes.JSONQuery("content").Equals("John Doe", "full_name"),
+				expectedQuery: clause.Expr{SQL: "LOWER(content->>'full_name') = ?", Vars: []interface{}{"john doe"}},
 			},
 			{
 				description:   "json query for phone",
@@ -217,9 +224,12 @@ func TestModels(t *testing.T) {
 				expectedQuery: datatypes.JSONQuery("content").Equals("https://www.example.com", "url"),
 			},
 			{
-				description:   "json query for tls certificate",
-				asset:         &oamcert.TLSCertificate{SerialNumber: "25:89:5f:3b:96:c8:18:89:09:04:8b:6c:64:88:6f:1b"},
-				expectedQuery: datatypes.JSONQuery("content").Equals("25:89:5f:3b:96:c8:18:89:09:04:8b:6c:64:88:6f:1b", "serial_number"),
+				description: "json query for tls certificate",
+				asset:       &oamcert.TLSCertificate{SerialNumber: "25:89:5f:3b:96:c8:18:89:09:04:8b:6c:64:88:6f:1b", IssuerCommonName: "R3"},
+				expectedQuery: clause.Expr{SQL: "(? AND ?)", Vars: []interface{}{
+					datatypes.JSONQuery("content").Equals("25:89:5f:3b:96:c8:18:89:09:04:8b:6c:64:88:6f:1b", "serial_number"),
+					datatypes.JSONQuery("content").Equals("R3", "issuer_common_name"),
+				}},
 			},
 			{
 				description:   "json query for the domain record",
@@ -229,7 +239,7 @@ func TestModels(t *testing.T) {
 			{
 				description:   "json query for organization",
 				asset:         &org.Organization{Name: "Example, Inc."},
-				expectedQuery: datatypes.JSONQuery("content").Equals("Example, Inc.", "name"),
+				expectedQuery: clause.Expr{SQL: "LOWER(content->>'name') = ?", Vars: []interface{}{"example, inc."}},
 			},
 			{
 				description:   "json query for contact record",
@@ -282,4 +292,278 @@ func TestModels(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("KeyField", func(t *testing.T) {
+		testCases := []struct {
+			description string
+			asset       oam.Asset
+			field       string
+			value       string
+		}{
+			{
+				description: "key field for fqdn",
+				asset:       &domain.FQDN{Name: "www.example.com"},
+				field:       "name",
+				value:       "www.example.com",
+			},
+			{
+				description: "key field for fqdn passed by value",
+				asset:       domain.FQDN{Name: "www.example.com"},
+				field:       "name",
+				value:       "www.example.com",
+			},
+			{
+				description: "key field for ip address",
+				asset:       &network.IPAddress{Address: ip, Type: "IPv4"},
+				field:       "address",
+				value:       "192.168.1.1",
+			},
+			{
+				description: "key field for autonomous system",
+				asset:       &network.AutonomousSystem{Number: 64496},
+				field:       "number",
+				value:       "64496",
+			},
+			{
+				description: "key field for url",
+				asset:       &url.URL{Raw: "https://www.example.com"},
+				field:       "url",
+				value:       "https://www.example.com",
+			},
+		}
+
+		for _, tc := range testCases {
+			field, value, err := KeyField(tc.asset)
+			if err != nil {
+				t.Fatalf("%s: failed to get the key field: %s", tc.description, err)
+			}
+			if field != tc.field || value != tc.value {
+				t.Fatalf("%s: expected %s=%s, got %s=%s", tc.description, tc.field, tc.value, field, value)
+			}
+		}
+
+		if _, _, err := KeyField(nil); err == nil {
+			t.Fatalf("expected an error for a nil asset")
+		}
+	})
+
+	t.Run("IdentityFields", func(t *testing.T) {
+		testCases := []struct {
+			description string
+			asset       oam.Asset
+			expected    []IdentityField
+		}{
+			{
+				description: "identity fields for fqdn",
+				asset:       &domain.FQDN{Name: "www.example.com"},
+				expected:    []IdentityField{{Name: "name", Value: "www.example.com"}},
+			},
+			{
+				description: "identity fields for tls certificate",
+				asset:       oamcert.TLSCertificate{SerialNumber: "01", IssuerCommonName: "Example CA"},
+				expected: []IdentityField{
+					{Name: "serial_number", Value: "01"},
+					{Name: "issuer_common_name", Value: "Example CA"},
+				},
+			},
+			{
+				description: "identity fields for socket address",
+				asset:       &network.SocketAddress{Address: netip.MustParseAddrPort("192.168.1.1:443"), Protocol: "tcp"},
+				expected: []IdentityField{
+					{Name: "address", Value: "192.168.1.1:443"},
+					{Name: "protocol", Value: "tcp"},
+				},
+			},
+		}
+
+		for _, tc := range testCases {
+			fields, err := IdentityFields(tc.asset)
+			if err != nil {
+				t.Fatalf("%s: failed to get the identity fields: %s", tc.description, err)
+			}
+			if !reflect.DeepEqual(fields, tc.expected) {
+				t.Fatalf("%s: expected %v, got %v", tc.description, tc.expected, fields)
+			}
+		}
+
+		if _, err := IdentityFields(nil); err == nil {
+			t.Fatalf("expected an error for a nil asset")
+		}
+	})
+
+	t.Run("AsOAM", func(t *testing.T) {
+		asset := &Asset{
+			Type:    string(oam.FQDN),
+			Content: []byte(`{"name":"www.example.com"}`),
+		}
+
+		var wg sync.WaitGroup
+		results := make([]oam.Asset, 10)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				a, err := asset.AsOAM()
+				if err != nil {
+					t.Errorf("failed to parse asset: %s", err)
+				}
+				results[i] = a
+			}(i)
+		}
+		wg.Wait()
+
+		for _, r := range results {
+			if r != results[0] {
+				t.Fatalf("expected every call to return the cached asset")
+			}
+		}
+
+		// the cached asset is returned even after the content changes
+		asset.Content = []byte(`{"name":"www.owasp.org"}`)
+		a, err := asset.AsOAM()
+		if err != nil {
+			t.Fatalf("failed to parse asset: %s", err)
+		}
+		if a.Key() != "www.example.com" {
+			t.Fatalf("expected the cached asset www.example.com, got %s", a.Key())
+		}
+	})
+
+	t.Run("UnknownAssetTypeHook", func(t *testing.T) {
+		var mu sync.Mutex
+		var reported []string
+		SetUnknownAssetTypeHook(func(op, atype string) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, op+" "+atype)
+		})
+		defer SetUnknownAssetTypeHook(nil)
+
+		unknown := Asset{Type: "Spaceship", Content: []byte(`{"name":"enterprise"}`)}
+		if _, err := unknown.Parse(); err == nil {
+			t.Fatalf("expected an error parsing an unknown asset type")
+		}
+		if _, err := unknown.JSONQuery(); err == nil {
+			t.Fatalf("expected an error generating the query of an unknown asset type")
+		}
+
+		known := Asset{Type: string(oam.FQDN), Content: []byte(`{"name":"www.example.com"}`)}
+		if _, err := known.JSONQuery(); err != nil {
+			t.Fatalf("failed to generate the query: %s", err)
+		}
+
+		expected := []string{"Parse Spaceship", "Parse Spaceship"}
+		if !reflect.DeepEqual(reported, expected) {
+			t.Fatalf("expected the unknown types %v to be reported, got %v", expected, reported)
+		}
+
+		// the hook is no longer called once it is removed
+		SetUnknownAssetTypeHook(nil)
+		_, _ = unknown.Parse()
+		if len(reported) != len(expected) {
+			t.Fatalf("expected the removed hook not to be called")
+		}
+	})
+}
+
+// starbase is an asset type defined outside of the Open Asset Model.
+type starbase struct {
+	Registry string `json:"registry"`
+	Sector   string `json:"sector,omitempty"`
 }
+
+func (s *starbase) Key() string              { return s.Registry }
+func (s *starbase) AssetType() oam.AssetType { return "Starbase" }
+func (s *starbase) JSON() ([]byte, error)    { return json.Marshal(s) }
+
+func TestRegisterAssetType(t *testing.T) {
+	descriptor := NewAssetTypeDescriptor[starbase]("registry", func(v *starbase) interface{} { return v.Registry })
+	if err := RegisterAssetType("Starbase", descriptor); err != nil {
+		t.Fatalf("failed to register the asset type: %s", err)
+	}
+	defer func() {
+		assetTypes.Lock()
+		delete(assetTypes.descriptors, "Starbase")
+		assetTypes.Unlock()
+	}()
+
+	if err := RegisterAssetType("Starbase", descriptor); err == nil {
+		t.Fatalf("expected an error registering the asset type twice")
+	}
+	if err := RegisterAssetType(oam.FQDN, descriptor); err == nil {
+		t.Fatalf("expected an error replacing a built-in asset type")
+	}
+	if err := RegisterAssetType("Outpost", AssetTypeDescriptor{}); err == nil {
+		t.Fatalf("expected an error registering an incomplete descriptor")
+	}
+
+	parsed, err := (&Asset{Type: "Starbase", Content: []byte(`{"registry":"SB-39","sector":"001"}`)}).Parse()
+	if err != nil {
+		t.Fatalf("failed to parse the asset: %s", err)
+	}
+	if !reflect.DeepEqual(parsed, &starbase{Registry: "SB-39", Sector: "001"}) {
+		t.Fatalf("expected the parsed starbase, got %v", parsed)
+	}
+
+	// the assets of the registered type are stored and found by their key field
+	stored, err := store.CreateAsset(&starbase{Registry: "SB-39", Sector: "001"})
+	if err != nil {
+		t.Fatalf("failed to create the asset: %s", err)
+	}
+	found, err := store.FindAssetByContent(&starbase{Registry: "SB-39"}, time.Time{})
+	if err != nil {
+		t.Fatalf("failed to find the asset: %s", err)
+	}
+	if len(found) != 1 || found[0].ID != stored.ID || !reflect.DeepEqual(found[0].Asset, parsed) {
+		t.Fatalf("expected to find the stored starbase, got %v", found)
+	}
+
+	// the asset would not parse once the type is removed at the end of the test
+	if err := store.DeleteAsset(stored.ID); err != nil {
+		t.Fatalf("failed to delete the asset: %s", err)
+	}
+}
+
+func TestContentFieldsOfMalformedAssetType(t *testing.T) {
+	key := func(asset oam.Asset) (string, interface{}, error) { return "registry", asset.Key(), nil }
+	descriptors := map[oam.AssetType]AssetTypeDescriptor{
+		"Outpost": {
+			Unmarshal: func(content []byte) (oam.Asset, error) { return nil, nil },
+			KeyField:  key,
+		},
+		"Waystation": {
+			Unmarshal: func(content []byte) (oam.Asset, error) { return waystation("W-1"), nil },
+			KeyField:  key,
+		},
+	}
+
+	for atype, descriptor := range descriptors {
+		if err := RegisterAssetType(atype, descriptor); err != nil {
+			t.Fatalf("failed to register the %s asset type: %s", atype, err)
+		}
+	}
+	defer func() {
+		assetTypes.Lock()
+		for atype := range descriptors {
+			delete(assetTypes.descriptors, atype)
+		}
+		assetTypes.Unlock()
+	}()
+
+	for atype := range descriptors {
+		if _, err := contentFields(atype); err == nil {
+			t.Fatalf("expected an error reading the content fields of the %s asset type", atype)
+		}
+		if _, err := store.FindAssetByTypeFiltered(atype, ContentFilter{Field: "registry", Op: FilterEquals, Value: "W-1"}, time.Time{}); err == nil {
+			t.Fatalf("expected an error filtering the assets of the %s asset type", atype)
+		}
+	}
+}
+
+// waystation is an asset type whose content is not held by a pointer to a struct.
+type waystation string
+
+func (w waystation) Key() string              { return string(w) }
+func (w waystation) AssetType() oam.AssetType { return "Waystation" }
+func (w waystation) JSON() ([]byte, error)    { return json.Marshal(string(w)) }
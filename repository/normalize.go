@@ -0,0 +1,77 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"strings"
+
+	oam "github.com/owasp-amass/open-asset-model"
+	"github.com/owasp-amass/open-asset-model/contact"
+	"github.com/owasp-amass/open-asset-model/domain"
+	"golang.org/x/net/idna"
+)
+
+// domainProfile converts domain names to their lowercase ASCII form, while still accepting
+// the underscores used by names such as SRV and DMARC records.
+var domainProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false))
+
+// normalize returns the asset with the FQDN name or the email address normalized, unless the repository
+// was created with WithExactContent. Other assets are returned unchanged.
+// The asset provided is not modified, and a value is returned for a value as a pointer is for a pointer.
+func (sql *sqlRepository) normalize(asset oam.Asset) oam.Asset {
+	if sql.exactContent {
+		return asset
+	}
+
+	switch v := asset.(type) {
+	case *domain.FQDN:
+		n := *v
+		n.Name = normalizeDomain(n.Name)
+		return &n
+	case domain.FQDN:
+		v.Name = normalizeDomain(v.Name)
+		return v
+	case *contact.EmailAddress:
+		n := normalizeEmail(*v)
+		return &n
+	case contact.EmailAddress:
+		return normalizeEmail(v)
+	}
+	return asset
+}
+
+// normalizeAll returns the provided assets normalized as normalize does.
+func (sql *sqlRepository) normalizeAll(assets []oam.Asset) []oam.Asset {
+	normalized := make([]oam.Asset, 0, len(assets))
+	for _, a := range assets {
+		normalized = append(normalized, sql.normalize(a))
+	}
+	return normalized
+}
+
+// normalizeDomain lowercases the domain name, removes the trailing dot and converts
+// internationalized labels to punycode. Names the IDNA rules reject are only lowercased.
+func normalizeDomain(name string) string {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+
+	if ascii, err := domainProfile.ToASCII(name); err == nil {
+		return ascii
+	}
+	return strings.ToLower(name)
+}
+
+// normalizeEmail lowercases the email address and normalizes its domain as normalizeDomain does.
+func normalizeEmail(e contact.EmailAddress) contact.EmailAddress {
+	e.Username = strings.ToLower(strings.TrimSpace(e.Username))
+	e.Domain = normalizeDomain(e.Domain)
+
+	addr := strings.TrimSpace(e.Address)
+	if at := strings.LastIndex(addr, "@"); at >= 0 {
+		e.Address = strings.ToLower(addr[:at]) + "@" + normalizeDomain(addr[at+1:])
+	} else {
+		e.Address = strings.ToLower(addr)
+	}
+	return e
+}
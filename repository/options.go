@@ -0,0 +1,202 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+)
+
+// Option configures optional behavior of the repository.
+type Option func(*sqlRepository)
+
+// Clock provides the current time used for the CreatedAt and LastSeen timestamps.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is a Clock that returns the current system time in UTC.
+type SystemClock struct{}
+
+// Now returns the current system time in UTC.
+func (SystemClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// WithClock causes the repository to set the CreatedAt and LastSeen timestamps in Go using the provided Clock,
+// instead of relying on the CURRENT_TIMESTAMP default of the database server. The times are stored in UTC,
+// whatever location the Clock returns them in.
+func WithClock(clock Clock) Option {
+	return func(sql *sqlRepository) {
+		sql.clock = clock
+	}
+}
+
+// WithConnMaxIdleTime sets the maximum amount of time a Postgres connection may remain idle in the pool before it is closed.
+func WithConnMaxIdleTime(d time.Duration) Option {
+	return func(sql *sqlRepository) {
+		sql.connMaxIdleTime = d
+	}
+}
+
+// WithConnMaxLifetime sets the maximum amount of time a Postgres connection may be reused before it is replaced.
+func WithConnMaxLifetime(d time.Duration) Option {
+	return func(sql *sqlRepository) {
+		sql.connMaxLifetime = d
+	}
+}
+
+// WithAssetCreated registers a function that is called with each asset CreateAsset stores as a new row.
+// The function is called synchronously once the row has been committed, so it must not block.
+func WithAssetCreated(fn func(*types.Asset)) Option {
+	return func(sql *sqlRepository) {
+		sql.created = append(sql.created, fn)
+	}
+}
+
+// WithExactContent causes the repository to store and look up FQDNs and email addresses exactly as provided.
+// By default, the names are lowercased, trailing dots are removed and internationalized domain names are
+// converted to punycode, so lookups match regardless of how the name was written.
+func WithExactContent() Option {
+	return func(sql *sqlRepository) {
+		sql.exactContent = true
+	}
+}
+
+// WithReadTimeout bounds each query issued by the repository, so a runaway find is stopped once the duration has passed
+// and returns an error. A zero duration, the default, leaves the queries unbounded.
+// The deadline is placed on the context of the statement rather than set with statement_timeout, which SQLite does not provide.
+// The Postgres server is asked to cancel a query running past the deadline. SQLite only checks the deadline until the query
+// starts returning rows, so a query doing its work while the rows are read, such as an aggregate, runs to completion.
+func WithReadTimeout(d time.Duration) Option {
+	return func(sql *sqlRepository) {
+		sql.readTimeout = d
+	}
+}
+
+// WithWriteTimeout bounds each create, update, delete and Exec statement issued by the repository, as WithReadTimeout bounds the queries.
+// Both Postgres and SQLite stop a write running past the deadline, and the writes of the statement are rolled back.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(sql *sqlRepository) {
+		sql.writeTimeout = d
+	}
+}
+
+// WithBatchSize sets the number of rows or IDs handled by each statement of the batch operations, such as the IDs
+// removed by DeleteRelations and the rows loaded by each query of ForEachRelation.
+// By default, 400 is used for SQLite, which keeps the statements within its limit of 999 bind variables, and 1000 for Postgres.
+func WithBatchSize(n int) Option {
+	return func(sql *sqlRepository) {
+		sql.batchSize = n
+	}
+}
+
+// WithoutSchemaCheck causes New to skip comparing the database schema version with the version expected by the repository.
+// It is meant for tools that migrate the database after creating the repository; writing into a database with a different
+// schema version can corrupt its content.
+func WithoutSchemaCheck() Option {
+	return func(sql *sqlRepository) {
+		sql.skipSchemaCheck = true
+	}
+}
+
+// WithUpsertRetries sets the number of times CreateOrUpdateAsset retries its transaction when it fails because of
+// concurrent transactions, such as a Postgres serialization failure or deadlock, or a busy SQLite database.
+// The retries wait for a jittered backoff, and 5 retries are made by default. Zero disables the retries.
+func WithUpsertRetries(n int) Option {
+	return func(sql *sqlRepository) {
+		sql.upsertRetries = n
+	}
+}
+
+// WithDefaultSince sets the freshness window applied by the AssetDB methods reading assets and relations when they are called
+// with a zero since, so only the rows last seen within the window before the current time are returned.
+// A since passed explicitly always takes precedence over the window, and a zero window, the default, returns the full history.
+// The window is not applied to writes, such as CreateIfNotSeenSince, nor to the methods of the repository itself.
+func WithDefaultSince(window time.Duration) Option {
+	return func(sql *sqlRepository) {
+		sql.defaultWindow = window
+	}
+}
+
+// WithSymmetricRelations marks the relation types as symmetric, such as a relation linking two FQDNs operated by the same owner.
+// Link stores a symmetric relation in both directions, so IncomingRelations and OutgoingRelations return it for either asset.
+// Each direction is deduplicated on its own, so linking the assets in both directions still stores two rows rather than four.
+// Both directions must be valid in the taxonomy. ReplaceOutgoingRelations, DeleteRelation, DeleteRelations, LinkObservation and
+// LinkRelationSource change both directions of a symmetric relation within a single transaction.
+func WithSymmetricRelations(relationTypes ...string) Option {
+	return func(sql *sqlRepository) {
+		if sql.symmetric == nil {
+			sql.symmetric = make(map[string]struct{})
+		}
+		for _, rtype := range relationTypes {
+			sql.symmetric[rtype] = struct{}{}
+		}
+	}
+}
+
+// WithContentHistory causes the repository to keep up to depth previous contents of each asset, so the versions replaced
+// when an asset is stored again with a different content, such as an organization with an updated name, can be read by
+// FindAssetHistory. Only the most recent versions are kept, and the history of an asset is removed along with it.
+// A zero depth, the default, keeps no history.
+func WithContentHistory(depth int) Option {
+	return func(sql *sqlRepository) {
+		sql.historyDepth = depth
+	}
+}
+
+// WithReadOnly causes the repository to reject every statement that writes to the database, such as the creation,
+// linking, update and removal of assets and relations, with ErrReadOnly before the statement reaches the database.
+// The connections are also opened in read-only mode, with default_transaction_read_only set on Postgres and the query_only pragma
+// set on SQLite, so the database rejects the writes issued through RawQuery as well. The repository never applies the migrations, so they are not affected.
+func WithReadOnly() Option {
+	return func(sql *sqlRepository) {
+		sql.readOnly = true
+	}
+}
+
+// WithMaxResults sets the maximum number of rows loaded by the queries returning every matching row at once, such as
+// FindAssetByType, AssetQuery and OutgoingRelations. The rows are read one at a time, and the query fails with
+// ErrResultSetTooLarge once more rows than the maximum are found, so a query missing its constraints cannot load a whole
+// table into memory. The paginated, streaming and self-limited methods, such as AssetRowsAfter, ForEachRelation and
+// RecentlyChangedAssets, are exempt. Each limited method notes it in its own documentation. Zero, the default, sets no maximum.
+func WithMaxResults(n int) Option {
+	return func(sql *sqlRepository) {
+		sql.maxResults = n
+	}
+}
+
+// WithLastSeenJitter causes the repository to move the last seen time of each asset it stores as a new row back by a random duration
+// within the window, so the assets created together by a large batch, such as those committed by an Ingestor, do not share
+// the same last seen time and a scheduler refreshing the stalest assets spreads their re-scans out over the window.
+// The creation time is left at the insertion time, so a new asset can be last seen up to the window before it was created,
+// and CreateAssetIfNotSeenSince with a since parameter within the window may refresh an asset it has just created.
+// The assets already stored and the relations keep their timestamps, and a zero window, the default, applies no jitter.
+func WithLastSeenJitter(window time.Duration) Option {
+	return func(sql *sqlRepository) {
+		sql.lastSeenJitter = window
+	}
+}
+
+// WithMaxTraversalNodes sets the maximum number of assets reached by the traversals, which are ExpandRelations,
+// FindTransitiveClosure and FindNeighborsByType, along with the CertificateChain of the assetdb, not counting the asset
+// they start from, so expanding from a densely connected hub cannot exhaust the memory of the process. A traversal reaching
+// more assets stops at the maximum and returns the assets and relations found so far along with an error wrapping
+// ErrTraversalTruncated. Zero, the default, sets no maximum.
+func WithMaxTraversalNodes(n int) Option {
+	return func(sql *sqlRepository) {
+		sql.maxTraversal = n
+	}
+}
+
+// WithMinTraversalWeight sets the minimum weight of the relations followed by the traversals, which are ExpandRelations,
+// FindTransitiveClosure and FindNeighborsByType, so a traversal of a weighted graph, such as one propagating risk, leaves out the edges of low confidence.
+// Once a minimum is set, the relations without a weight are not followed. By default, relations are followed regardless of their weight.
+func WithMinTraversalWeight(weight float64) Option {
+	return func(sql *sqlRepository) {
+		sql.minWeight = &weight
+	}
+}
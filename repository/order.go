@@ -0,0 +1,202 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OrderField represents the field by which the results of a find method are ordered.
+type OrderField string
+
+const (
+	OrderByID        OrderField = "id"
+	OrderByCreatedAt OrderField = "created_at"
+	OrderByLastSeen  OrderField = "last_seen"
+	// OrderByKey orders assets by their key field, such as the name of an FQDN.
+	// It is not supported for relations.
+	OrderByKey OrderField = "key"
+	// OrderByWeight orders relations by their weight, placing the relations without a weight last in either direction.
+	// It is not supported for assets.
+	OrderByWeight OrderField = "weight"
+)
+
+// Order describes how the results of a find method are ordered.
+// Results with equal values are ordered by their ID, so the ordering is stable across calls.
+// The zero value leaves the ordering to the database.
+type Order struct {
+	Field OrderField // The field by which the results are ordered.
+	Desc  bool       // True if the results are ordered in descending order.
+}
+
+// orderBy returns the order by clause for the order, with the columns qualified by the table.
+// The key expression is used when the results are ordered by their key field.
+func (o Order) orderBy(table string, key clause.Expression) (clause.Expression, error) {
+	id := clause.Column{Table: table, Name: "id"}
+
+	switch o.Field {
+	case OrderByID:
+		return clause.OrderBy{Columns: []clause.OrderByColumn{{Column: id, Desc: o.Desc}}}, nil
+	case OrderByCreatedAt, OrderByLastSeen:
+		return clause.OrderBy{Columns: []clause.OrderByColumn{
+			{Column: clause.Column{Table: table, Name: string(o.Field)}, Desc: o.Desc},
+			{Column: id, Desc: o.Desc},
+		}}, nil
+	case OrderByWeight:
+		if table != "relations" {
+			return nil, errors.New("only relations can be ordered by their weight")
+		}
+		dir := " ASC"
+		if o.Desc {
+			dir = " DESC"
+		}
+		// Postgres and SQLite sort NULL values at opposite ends, so the relations without a weight are placed last explicitly
+		return clause.OrderBy{Expression: clause.Expr{
+			SQL:                "? IS NULL, ?" + dir + ", ?" + dir,
+			Vars:               []interface{}{clause.Column{Table: table, Name: "weight"}, clause.Column{Table: table, Name: "weight"}, id},
+			WithoutParentheses: true,
+		}}, nil
+	case OrderByKey:
+		if key == nil {
+			return nil, errors.New("the results cannot be ordered by their key field")
+		}
+		dir := " ASC"
+		if o.Desc {
+			dir = " DESC"
+		}
+		return clause.OrderBy{Expression: clause.Expr{
+			SQL:                "?" + dir + ", ?" + dir,
+			Vars:               []interface{}{key, id},
+			WithoutParentheses: true,
+		}}, nil
+	}
+	return nil, errors.New("unknown order field: " + string(o.Field))
+}
+
+// apply adds the ordering to the query, unless the order is the zero value.
+func (o Order) apply(tx *gorm.DB, table string, key clause.Expression) (*gorm.DB, error) {
+	if o.Field == "" {
+		return tx, nil
+	}
+
+	expr, err := o.orderBy(table, key)
+	if err != nil {
+		return nil, err
+	}
+	return tx.Clauses(expr), nil
+}
+
+// sortAssets orders assets that were not retrieved by a single query, such as the results of FindAssetByScope.
+// Assets ordered by their key field are compared as the database compares the JSON values of the key fields.
+func (o Order) sortAssets(assets []*types.Asset) error {
+	if o.Field == "" {
+		return nil
+	}
+
+	var compare func(a, b *types.Asset) int
+	switch o.Field {
+	case OrderByID:
+		compare = func(a, b *types.Asset) int { return 0 }
+	case OrderByCreatedAt:
+		compare = func(a, b *types.Asset) int { return a.CreatedAt.Compare(b.CreatedAt) }
+	case OrderByLastSeen:
+		compare = func(a, b *types.Asset) int { return a.LastSeen.Compare(b.LastSeen) }
+	case OrderByKey:
+		compare = func(a, b *types.Asset) int { return compareKeys(a.Asset, b.Asset) }
+	case OrderByWeight:
+		return errors.New("only relations can be ordered by their weight")
+	default:
+		return errors.New("unknown order field: " + string(o.Field))
+	}
+
+	sort.SliceStable(assets, func(i, j int) bool {
+		c := compare(assets[i], assets[j])
+		if c == 0 {
+			c = compareIDs(assets[i].ID, assets[j].ID)
+		}
+		if o.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return nil
+}
+
+// compareKeys compares the key field values of the assets as the JSON values are compared by the database,
+// so numeric key fields are ordered numerically and before the key fields holding strings.
+func compareKeys(a, b oam.Asset) int {
+	_, x, _ := keyField(a)
+	_, y, _ := keyField(b)
+
+	xn, xnum := keyNumber(x)
+	yn, ynum := keyNumber(y)
+	switch {
+	case xnum && ynum:
+		return cmp.Compare(xn, yn)
+	case xnum:
+		return -1
+	case ynum:
+		return 1
+	}
+	return strings.Compare(fmt.Sprint(x), fmt.Sprint(y))
+}
+
+// keyNumber returns the key field value as a number, and false if the value is not numeric.
+func keyNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// compareIDs compares the IDs numerically, as they are ordered by the database.
+func compareIDs(a, b string) int {
+	x, _ := strconv.ParseUint(a, 10, 64)
+	y, _ := strconv.ParseUint(b, 10, 64)
+
+	if x < y {
+		return -1
+	} else if x > y {
+		return 1
+	}
+	return 0
+}
+
+// keyExpression returns the expression extracting the key field of the asset type from the content column.
+func (sql *sqlRepository) keyExpression(atype oam.AssetType) (clause.Expression, error) {
+	empty := &Asset{Type: string(atype), Content: datatypes.JSON("{}")}
+
+	a, err := empty.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	field, _, err := keyField(a)
+	if err != nil {
+		return nil, err
+	}
+
+	// the JSON values are compared, so numeric key fields are ordered numerically
+	if sql.dbType == Postgres {
+		return clause.Expr{SQL: "assets.content -> ?::text", Vars: []interface{}{field}}, nil
+	}
+	return clause.Expr{SQL: "json_extract(assets.content, ?)", Vars: []interface{}{"$." + field}}, nil
+}
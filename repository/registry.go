@@ -0,0 +1,139 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	oam "github.com/owasp-amass/open-asset-model"
+	oamtls "github.com/owasp-amass/open-asset-model/certificate"
+	"github.com/owasp-amass/open-asset-model/contact"
+	"github.com/owasp-amass/open-asset-model/domain"
+	"github.com/owasp-amass/open-asset-model/fingerprint"
+	"github.com/owasp-amass/open-asset-model/network"
+	"github.com/owasp-amass/open-asset-model/org"
+	"github.com/owasp-amass/open-asset-model/people"
+	oamreg "github.com/owasp-amass/open-asset-model/registration"
+	"github.com/owasp-amass/open-asset-model/service"
+	"github.com/owasp-amass/open-asset-model/source"
+	"github.com/owasp-amass/open-asset-model/url"
+)
+
+// AssetTypeDescriptor describes how the repository parses and identifies the assets of an asset type.
+type AssetTypeDescriptor struct {
+	// Unmarshal parses the JSON content of an asset of the type.
+	Unmarshal func(content []byte) (oam.Asset, error)
+	// KeyField returns the JSON name of the field identifying the asset within its type, and its value as stored in the content.
+	KeyField func(asset oam.Asset) (string, interface{}, error)
+}
+
+// NewAssetTypeDescriptor returns the descriptor of an asset type held by a pointer to the struct T,
+// identified by the field with the provided JSON name, whose value is returned by the value function.
+func NewAssetTypeDescriptor[T any, P interface {
+	*T
+	oam.Asset
+}](field string, value func(P) interface{}) AssetTypeDescriptor {
+	return AssetTypeDescriptor{
+		Unmarshal: func(content []byte) (oam.Asset, error) {
+			var v T
+
+			err := json.Unmarshal(content, &v)
+			return P(&v), err
+		},
+		KeyField: func(asset oam.Asset) (string, interface{}, error) {
+			v, ok := asset.(P)
+			if !ok {
+				return "", nil, fmt.Errorf("%w: %s held by a %T", ErrUnsupportedAssetType, asset.AssetType(), asset)
+			}
+			return field, value(v), nil
+		},
+	}
+}
+
+// assetTypes holds the descriptors of the asset types supported by the repository.
+var assetTypes = struct {
+	sync.RWMutex
+	descriptors map[oam.AssetType]AssetTypeDescriptor
+}{descriptors: map[oam.AssetType]AssetTypeDescriptor{
+	oam.FQDN: NewAssetTypeDescriptor[domain.FQDN]("name",
+		func(v *domain.FQDN) interface{} { return v.Name }),
+	oam.NetworkEndpoint: NewAssetTypeDescriptor[domain.NetworkEndpoint]("address",
+		func(v *domain.NetworkEndpoint) interface{} { return v.Address }),
+	oam.SocketAddress: NewAssetTypeDescriptor[network.SocketAddress]("address",
+		func(v *network.SocketAddress) interface{} { return v.Address.String() }),
+	oam.IPAddress: NewAssetTypeDescriptor[network.IPAddress]("address",
+		func(v *network.IPAddress) interface{} { return v.Address.String() }),
+	oam.AutonomousSystem: NewAssetTypeDescriptor[network.AutonomousSystem]("number",
+		func(v *network.AutonomousSystem) interface{} { return v.Number }),
+	oam.Netblock: NewAssetTypeDescriptor[network.Netblock]("cidr",
+		func(v *network.Netblock) interface{} { return v.CIDR.String() }),
+	oam.IPNetRecord: NewAssetTypeDescriptor[oamreg.IPNetRecord]("handle",
+		func(v *oamreg.IPNetRecord) interface{} { return v.Handle }),
+	oam.AutnumRecord: NewAssetTypeDescriptor[oamreg.AutnumRecord]("handle",
+		func(v *oamreg.AutnumRecord) interface{} { return v.Handle }),
+	oam.DomainRecord: NewAssetTypeDescriptor[oamreg.DomainRecord]("domain",
+		func(v *oamreg.DomainRecord) interface{} { return v.Domain }),
+	oam.Fingerprint: NewAssetTypeDescriptor[fingerprint.Fingerprint]("value",
+		func(v *fingerprint.Fingerprint) interface{} { return v.Value }),
+	oam.Organization: NewAssetTypeDescriptor[org.Organization]("name",
+		func(v *org.Organization) interface{} { return v.Name }),
+	oam.Person: NewAssetTypeDescriptor[people.Person]("full_name",
+		func(v *people.Person) interface{} { return v.FullName }),
+	oam.Phone: NewAssetTypeDescriptor[contact.Phone]("raw",
+		func(v *contact.Phone) interface{} { return v.Raw }),
+	oam.EmailAddress: NewAssetTypeDescriptor[contact.EmailAddress]("address",
+		func(v *contact.EmailAddress) interface{} { return v.Address }),
+	oam.Location: NewAssetTypeDescriptor[contact.Location]("address",
+		func(v *contact.Location) interface{} { return v.Address }),
+	// the discovered_at field is the only field provided by the contact record
+	oam.ContactRecord: NewAssetTypeDescriptor[contact.ContactRecord]("discovered_at",
+		func(v *contact.ContactRecord) interface{} { return v.DiscoveredAt }),
+	oam.TLSCertificate: NewAssetTypeDescriptor[oamtls.TLSCertificate]("serial_number",
+		func(v *oamtls.TLSCertificate) interface{} { return v.SerialNumber }),
+	oam.URL: NewAssetTypeDescriptor[url.URL]("url",
+		func(v *url.URL) interface{} { return v.Raw }),
+	oam.Source: NewAssetTypeDescriptor[source.Source]("name",
+		func(v *source.Source) interface{} { return v.Name }),
+	oam.Service: NewAssetTypeDescriptor[service.Service]("identifier",
+		func(v *service.Service) interface{} { return v.Identifier }),
+}}
+
+// RegisterAssetType adds an asset type to the types supported by the repository, so its assets can be stored, parsed and found
+// by their content, such as a type defined outside of the Open Asset Model:
+//
+//	err := repository.RegisterAssetType("Spacecraft", repository.NewAssetTypeDescriptor[Spacecraft]("registry",
+//		func(v *Spacecraft) interface{} { return v.Registry }))
+//
+// The relations of the assets must still be valid in the Open Asset Model taxonomy to be linked.
+// Returns an error if the descriptor is incomplete or the type is already supported.
+func RegisterAssetType(atype oam.AssetType, descriptor AssetTypeDescriptor) error {
+	if atype == "" {
+		return errors.New("no asset type provided")
+	}
+	if descriptor.Unmarshal == nil || descriptor.KeyField == nil {
+		return fmt.Errorf("the descriptor of the %s asset type is incomplete", atype)
+	}
+
+	assetTypes.Lock()
+	defer assetTypes.Unlock()
+
+	if _, found := assetTypes.descriptors[atype]; found {
+		return fmt.Errorf("the %s asset type is already supported", atype)
+	}
+	assetTypes.descriptors[atype] = descriptor
+	return nil
+}
+
+// assetTypeDescriptor returns the descriptor of the asset type, and false if the type is not supported.
+func assetTypeDescriptor(atype oam.AssetType) (AssetTypeDescriptor, bool) {
+	assetTypes.RLock()
+	defer assetTypes.RUnlock()
+
+	d, found := assetTypes.descriptors[atype]
+	return d, found
+}
@@ -5,6 +5,7 @@
 package repository
 
 import (
+	"context"
 	"time"
 
 	"github.com/owasp-amass/asset-db/types"
@@ -13,21 +14,110 @@ import (
 
 // Repository defines the methods for interacting with the asset database.
 // It provides operations for creating, retrieving, and linking assets.
+// Methods taking a since parameter only return assets and relations with a last seen timestamp at or after it,
+// the complement of the assets removed by DeleteAssetsNotSeenSince for the same cutoff, and ignore it when it is zero.
 type Repository interface {
 	GetDBType() string
 	CreateAsset(asset oam.Asset) (*types.Asset, error)
+	CreateAssetWithRaw(asset oam.Asset, raw []byte) (*types.Asset, error)
+	CreateAssetFromContent(atype string, content []byte) (*types.Asset, error)
+	CreateAssetWithExternalID(asset oam.Asset, externalID string) (*types.Asset, error)
+	CreateOrUpdateAsset(asset oam.Asset) (*types.Asset, bool, error)
+	CreateAssetIfNotSeenSince(asset oam.Asset, since time.Time) (*types.Asset, bool, error)
+	ImportAsset(asset *types.Asset) (*types.Asset, error)
 	UpdateAssetLastSeen(id string) error
+	RetypeAsset(id string, atype oam.AssetType) error
 	DeleteAsset(id string) error
+	DeleteAssetsNotSeenSince(cutoff time.Time) (int64, error)
+	PreviewDeleteAssetsNotSeenSince(cutoff time.Time) ([]string, error)
 	DeleteRelation(id string) error
+	DeleteRelations(ids []string) (int64, error)
+	BackfillAssetHashes() (int64, error)
 	FindAssetById(id string, since time.Time) (*types.Asset, error)
+	FindAssetRawById(id string) ([]byte, error)
+	FindAssetHistory(id string) ([]*types.AssetVersion, error)
+	ImportAssetHistory(assetID string, version AssetHistory) error
+	FindAssetByExternalID(atype oam.AssetType, externalID string, since time.Time) (*types.Asset, error)
 	FindAssetByContent(asset oam.Asset, since time.Time) ([]*types.Asset, error)
+	FindAssetByContents(assets []oam.Asset, since time.Time) (map[string][]*types.Asset, error)
 	FindAssetByType(atype oam.AssetType, since time.Time) ([]*types.Asset, error)
+	FindAssetByTypeOrdered(atype oam.AssetType, since time.Time, order Order) ([]*types.Asset, error)
+	SelectAssetField(atype oam.AssetType, field string, since time.Time) ([]string, error)
+	FindAssetByTypes(atypes []oam.AssetType, since time.Time) ([]*types.Asset, error)
+	FindAssetByTypeFiltered(atype oam.AssetType, filter ContentFilter, since time.Time) ([]*types.Asset, error)
+	FindAssetIDsByContent(asset oam.Asset, since time.Time) ([]string, error)
+	FindAssetIDsByType(atype oam.AssetType, since time.Time) ([]string, error)
+	RecentlyChangedAssets(limit int) ([]*types.Asset, error)
+	StalestAssetsByType(atype oam.AssetType, n int) ([]*types.Asset, error)
+	FindDuplicateAssets(atype oam.AssetType) ([][]*types.Asset, error)
+	FindAssetByJSONPath(atype oam.AssetType, path string, value interface{}, since time.Time) ([]*types.Asset, error)
+	FindSimilarOrganizations(name string, threshold float64) ([]*types.Asset, error)
+	FindSimilarPeople(fullName string, threshold float64) ([]*types.Asset, error)
+	FindAssetsWithOutgoingRelation(atype oam.AssetType, relationType string, since time.Time) ([]*types.Asset, error)
+	FindAssetsWithIncomingRelation(atype oam.AssetType, relationType string, since time.Time) ([]*types.Asset, error)
+	FindAssetByTypeFromSource(atype oam.AssetType, sourceName string, since time.Time) ([]*types.Asset, error)
 	FindAssetByScope(constraints []oam.Asset, since time.Time) ([]*types.Asset, error)
+	AssetInScope(asset oam.Asset, constraints []oam.Asset, since time.Time) (bool, error)
+	FindLocationsByCountry(cc string, since time.Time) ([]*types.Asset, error)
+	FindRegistrationRecords(atype oam.AssetType, fields map[string]interface{}, since time.Time) ([]*types.Asset, error)
+	FindRegistrationRecordsCreated(atype oam.AssetType, start, end time.Time, since time.Time) ([]*types.Asset, error)
+	FindRegistrationRecordsByOrganization(atype oam.AssetType, relation, name string, since time.Time) ([]*types.Asset, error)
+	FindAssetByScopeOrdered(constraints []oam.Asset, since time.Time, order Order) ([]*types.Asset, error)
+	FindAssetByContentAny(constraints []oam.Asset, since time.Time) ([]*types.Asset, error)
 	Link(source *types.Asset, relation string, destination *types.Asset) (*types.Relation, error)
+	LinkAt(source *types.Asset, relation string, destination *types.Asset, observedAt time.Time) (*types.Relation, error)
+	LinkWeighted(source *types.Asset, relation string, destination *types.Asset, weight float64) (*types.Relation, error)
+	ReplaceOutgoingRelations(source *types.Asset, relationType string, destinations []*types.Asset) error
+	ImportRelation(relation *types.Relation) (*types.Relation, error)
+	ImportAssetRaw(id string, raw []byte) error
+	LinkObservation(asset *types.Asset, src *types.Asset, confidence int) (*types.Relation, error)
+	LinkRelationSource(relation *types.Relation, src *types.Asset) error
+	RelationSources(relationID string) ([]*types.Asset, error)
+	ImportRelationSource(relationID, sourceID string, rs RelationSource) error
+	AddAssetTag(assetID, key, value string) error
+	RemoveAssetTag(assetID, key string) error
+	AssetTags(assetID string) (map[string]string, error)
+	FindAssetsByTag(key, value string, since time.Time) ([]*types.Asset, error)
+	ImportAssetTag(assetID string, tag AssetTag) error
+	Observations(asset *types.Asset, since time.Time) ([]*types.Relation, error)
 	IncomingRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, error)
+	IncomingRelationsFrom(asset *types.Asset, since time.Time, fromType oam.AssetType, relationTypes ...string) ([]*types.Relation, error)
 	OutgoingRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, error)
+	AllRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, []types.Direction, error)
+	ExpandRelations(asset *types.Asset, dir types.Direction, depth int, since time.Time, relationTypes ...string) ([][]*types.Relation, error)
+	FindTransitiveClosure(start *types.Asset, relationType string, maxDepth int, since time.Time) ([]*types.Asset, error)
+	FindNeighborsByType(asset *types.Asset, neighborType oam.AssetType, since time.Time, relationTypes ...string) ([]*types.Asset, error)
+	FindAssetsInAS(asn int, since time.Time) ([]*types.Asset, error)
+	RelationsBetween(idA, idB string, since time.Time) ([]*types.Relation, error)
+	FindLatestRelation(fromID, toID, relationType string) (*types.Relation, error)
+	RelationsAmong(ids []string, since time.Time) ([]*types.Relation, error)
+	IncomingRelationsOrdered(asset *types.Asset, since time.Time, order Order, relationTypes ...string) ([]*types.Relation, error)
+	OutgoingRelationsOrdered(asset *types.Asset, since time.Time, order Order, relationTypes ...string) ([]*types.Relation, error)
+	IncomingRelationsCreated(asset *types.Asset, start, end time.Time, relationTypes ...string) ([]*types.Relation, error)
+	OutgoingRelationsCreated(asset *types.Asset, start, end time.Time, relationTypes ...string) ([]*types.Relation, error)
 	RawQuery(sqlstr string, results interface{}) error
-	AssetQuery(constraints string) ([]*types.Asset, error)
-	RelationQuery(constraints string) ([]*types.Relation, error)
+	Explain(sqlstr string, args ...interface{}) (string, error)
+	RawAssetQuery(sqlstr string, args ...interface{}) ([]*types.Asset, error)
+	AssetQuery(constraints string, args ...interface{}) ([]*types.Asset, error)
+	RelationQuery(constraints string, args ...interface{}) ([]*types.Relation, error)
+	RelationQueryWithLimit(constraints string, limit int, args ...interface{}) ([]*types.Relation, error)
+	AssetRowsAfter(id uint64, limit int) ([]Asset, error)
+	RelationRowsAfter(id uint64, limit int) ([]Relation, error)
+	ForEachRelation(relationType string, since time.Time, fn func(*types.Relation) error) error
+	AssetRawRowsAfter(id uint64, limit int) ([]AssetRaw, error)
+	AssetTagRowsAfter(assetID uint64, key string, limit int) ([]AssetTag, error)
+	RelationSourceRowsAfter(relationID, sourceID uint64, limit int) ([]RelationSource, error)
+	AssetHistoryRowsAfter(id uint64, limit int) ([]AssetHistory, error)
+	SchemaVersion() (int, error)
+	ResolveSince(since time.Time) time.Time
+	Now() time.Time
+	MaxTraversalNodes() int
+	Stats() (*types.DBStats, error)
+	RelationCounts(id string) (map[string]int64, map[string]int64, error)
+	OutgoingRelationTypeCounts(asset *types.Asset, since time.Time) (map[string]int64, error)
+	IncomingRelationTypeCounts(asset *types.Asset, since time.Time) (map[string]int64, error)
+	TopAssetsByDegree(atype oam.AssetType, n int, since time.Time) ([]types.AssetDegree, error)
+	ListenChanges(ctx context.Context) (<-chan *types.Change, error)
+	Transaction(fn func(Repository) error) error
 	Close() error
 }
@@ -5,17 +5,23 @@
 package repository
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"log"
+	"maps"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/glebarez/sqlite"
 	"github.com/owasp-amass/asset-db/types"
 	oam "github.com/owasp-amass/open-asset-model"
+	"github.com/owasp-amass/open-asset-model/source"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -31,29 +37,125 @@ const (
 
 // sqlRepository is a repository implementation using GORM as the underlying ORM.
 type sqlRepository struct {
-	db     *gorm.DB
-	dbType DBType
+	db              *gorm.DB
+	dbType          DBType
+	clock           Clock
+	connMaxIdleTime time.Duration
+	connMaxLifetime time.Duration
+	created         []func(*types.Asset)
+	exactContent    bool
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	batchSize       int
+	skipSchemaCheck bool
+	upsertRetries   int
+	defaultWindow   time.Duration
+	symmetric       map[string]struct{}
+	historyDepth    int
+	readOnly        bool
+	maxResults      int
+	lastSeenJitter  time.Duration
+	maxTraversal    int
+	minWeight       *float64
+	committed       *[]*types.Asset
 }
 
+const (
+	defaultConnMaxIdleTime = 5 * time.Minute
+	defaultConnMaxLifetime = time.Hour
+)
+
+// The default batch sizes keep each statement within the bind variable limit of the database,
+// which is 999 for SQLite builds older than 3.32 and 65535 for Postgres.
+// A statement binds at most twice the batch size, when the IDs are matched against two columns.
+const (
+	defaultSQLiteBatchSize   = 400
+	defaultPostgresBatchSize = 1000
+)
+
 // New creates a new instance of the asset database repository.
-func New(dbType DBType, dsn string) *sqlRepository {
-	db, err := newDatabase(dbType, dsn)
+// The provided options are applied to the repository in order.
+// New panics with an error wrapping ErrSchemaVersion if the database schema is not the version expected by the repository,
+// unless the WithoutSchemaCheck option is provided.
+func New(dbType DBType, dsn string, opts ...Option) *sqlRepository {
+	sql := &sqlRepository{
+		dbType:          dbType,
+		connMaxIdleTime: defaultConnMaxIdleTime,
+		connMaxLifetime: defaultConnMaxLifetime,
+		upsertRetries:   defaultUpsertRetries,
+	}
+	for _, opt := range opts {
+		opt(sql)
+	}
+
+	db, err := newDatabase(dbType, dsn, sql.readOnly)
 	if err != nil {
 		panic(err)
 	}
+	sql.db = db
 
-	return &sqlRepository{
-		db:     db,
-		dbType: dbType,
+	if err := sql.configurePool(); err != nil {
+		panic(err)
+	}
+	if err := sql.configureTimeouts(); err != nil {
+		panic(err)
+	}
+	if err := sql.configureReadOnly(); err != nil {
+		panic(err)
+	}
+	if !sql.skipSchemaCheck {
+		if err := sql.checkSchemaVersion(); err != nil {
+			panic(err)
+		}
 	}
+	return sql
+}
+
+// batch returns the number of rows or IDs handled by each statement of a batch operation,
+// which is set by WithBatchSize or defaults to a size suited to the database.
+func (sql *sqlRepository) batch() int {
+	if sql.batchSize > 0 {
+		return sql.batchSize
+	}
+	if sql.dbType == SQLite {
+		return defaultSQLiteBatchSize
+	}
+	return defaultPostgresBatchSize
+}
+
+// configurePool sets the connection pool limits of the Postgres database, so connections broken by a
+// server restart are eventually replaced even when they are never borrowed again.
+// The pgx driver also pings connections that have been idle for more than a second before handing them out,
+// and the pool replaces the connections reported as bad, so operations recover once the server is back.
+// SQLite connections are left open, since closing all of them discards a shared in-memory database.
+func (sql *sqlRepository) configurePool() error {
+	if sql.dbType != Postgres {
+		return nil
+	}
+
+	db, err := sql.db.DB()
+	if err != nil {
+		return err
+	}
+
+	db.SetConnMaxIdleTime(sql.connMaxIdleTime)
+	db.SetConnMaxLifetime(sql.connMaxLifetime)
+	return nil
 }
 
 // newDatabase creates a new GORM database connection based on the provided database type and data source name (dsn).
-func newDatabase(dbType DBType, dsn string) (*gorm.DB, error) {
+// The connections of a read-only repository are opened in read-only mode.
+func newDatabase(dbType DBType, dsn string, readOnly bool) (*gorm.DB, error) {
 	switch dbType {
 	case Postgres:
+		if readOnly {
+			return readOnlyPostgresDatabase(dsn)
+		}
 		return postgresDatabase(dsn)
 	case SQLite:
+		if readOnly {
+			dsn = readOnlySQLiteDSN(dsn)
+		}
 		return sqliteDatabase(dsn)
 	default:
 		panic("Unknown db type")
@@ -66,8 +168,29 @@ func postgresDatabase(dsn string) (*gorm.DB, error) {
 }
 
 // sqliteDatabase creates a new SQLite database connection using the provided data source name (dsn).
+// SQLite creates a separate in-memory database for each connection, unless the cache is shared and a connection
+// remains open, so the pool of an in-memory database is limited to a single connection that is kept open.
 func sqliteDatabase(dsn string) (*gorm.DB, error) {
-	return gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil || !isMemoryDSN(dsn) {
+		return db, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetMaxIdleConns(1)
+	sqlDB.SetConnMaxIdleTime(0)
+	sqlDB.SetConnMaxLifetime(0)
+	return db, nil
+}
+
+// isMemoryDSN checks if the SQLite data source name refers to an in-memory database.
+func isMemoryDSN(dsn string) bool {
+	return dsn == ":memory:" || strings.HasPrefix(dsn, "file::memory:") || strings.Contains(dsn, "mode=memory")
 }
 
 // Close implements the Repository interface.
@@ -83,21 +206,121 @@ func (sql *sqlRepository) GetDBType() string {
 	return string(sql.dbType)
 }
 
+// ResolveSince returns the since parameter, or the start of the freshness window set by WithDefaultSince when since.IsZero().
+// A zero since is returned unchanged when no window was set.
+func (sql *sqlRepository) ResolveSince(since time.Time) time.Time {
+	if !since.IsZero() || sql.defaultWindow <= 0 {
+		return since
+	}
+
+	now := time.Now()
+	if sql.clock != nil {
+		now = sql.now()
+	}
+	return now.Add(-sql.defaultWindow)
+}
+
+// Now returns the current time of the Clock set by WithClock, or the system time when no Clock was set, in UTC.
+func (sql *sqlRepository) Now() time.Time {
+	if sql.clock == nil {
+		return SystemClock{}.Now()
+	}
+	return sql.now()
+}
+
+// MaxTraversalNodes returns the maximum number of assets reached by a traversal, as set by WithMaxTraversalNodes,
+// or zero when no maximum was set.
+func (sql *sqlRepository) MaxTraversalNodes() int {
+	return sql.maxTraversal
+}
+
+// now returns the current time of the Clock set by WithClock in UTC, since SQLite compares the stored timestamps as text
+// and a Clock may return the time in another location.
+func (sql *sqlRepository) now() time.Time {
+	return sql.clock.Now().UTC()
+}
+
+// sinceArg returns the since parameter, an eviction cutoff, or a bound of a creation window, as it is compared with the timestamps.
+// SQLite compares the timestamps as text, while they are stored both in the CURRENT_TIMESTAMP format and
+// with the zone offset written by the driver, so the parameter is formatted in UTC without the offset,
+// which orders at or before both formats of the same instant.
+func (sql *sqlRepository) sinceArg(since time.Time) interface{} {
+	if sql.dbType == SQLite {
+		return since.UTC().Format("2006-01-02 15:04:05.999999999")
+	}
+	return since
+}
+
 // CreateAsset creates a new asset in the database.
 // It takes an oam.Asset as input and persists it in the database.
 // The asset is serialized to JSON and stored in the Content field of the Asset struct.
-// Returns the created asset as a types.Asset or an error if the creation fails.
+// FQDNs and email addresses are normalized before they are stored, unless the repository was created with WithExactContent.
+// Returns the created asset as a types.Asset, an error wrapping ErrUnsupportedAssetType if the type of the asset is not supported,
+// or an error if the creation fails.
 func (sql *sqlRepository) CreateAsset(assetData oam.Asset) (*types.Asset, error) {
+	stored, created, err := sql.createAsset(assetData)
+	if err != nil {
+		return nil, err
+	}
+
+	if created {
+		sql.notifyCreated(stored)
+	}
+	return stored, nil
+}
+
+// createAsset stores the asset as CreateAsset does, without notifying the functions registered by WithAssetCreated.
+// Returns the stored asset and true if a new row was created, so callers within a transaction can notify once it commits.
+func (sql *sqlRepository) createAsset(assetData oam.Asset) (*types.Asset, bool, error) {
+	if err := checkSupported(assetData); err != nil {
+		return nil, false, err
+	}
+
+	assetData = sql.normalize(assetData)
 	jsonContent, err := assetData.JSON()
+	if err != nil {
+		return nil, false, err
+	}
+	return sql.createAssetContent(assetData, jsonContent)
+}
+
+// CreateAssetFromContent creates a new asset in the database from its asset type and JSON content, without marshaling the asset again.
+// The content must parse into an asset of the type, which is also used to find an asset already stored.
+// The content is stored as provided, so an FQDN or email address that is not normalized is rejected,
+// unless the repository was created with WithExactContent. SQLite keeps the content byte for byte, while Postgres stores it as jsonb.
+// Returns the created asset as a types.Asset or an error if the content does not parse or the creation fails.
+func (sql *sqlRepository) CreateAssetFromContent(atype string, content []byte) (*types.Asset, error) {
+	assetData, err := (&Asset{Type: atype, Content: content}).Parse()
+	if err != nil {
+		return nil, err
+	}
+	if ContentsKey(assetData) != ContentsKey(sql.normalize(assetData)) {
+		return nil, fmt.Errorf("the content of the %s asset is not normalized", atype)
+	}
+
+	stored, created, err := sql.createAssetContent(assetData, content)
 	if err != nil {
 		return nil, err
 	}
 
+	if created {
+		sql.notifyCreated(stored)
+	}
+	return stored, nil
+}
+
+// createAssetContent stores the asset with the provided JSON content, or updates the row already holding the asset.
+// Returns the stored asset and true if a new row was created.
+func (sql *sqlRepository) createAssetContent(assetData oam.Asset, jsonContent []byte) (*types.Asset, bool, error) {
+	hash := assetHash(assetData)
 	asset := Asset{
 		Type:    string(assetData.AssetType()),
 		Content: jsonContent,
+		Hash:    &hash,
 	}
+	sql.stampCreated(&asset)
 
+	var previous *types.Asset
 	// ensure that duplicate assets are not entered into the database
 	if assets, err := sql.FindAssetByContent(assetData, time.Time{}); err == nil && len(assets) > 0 {
 		for _, a := range assets {
@@ -106,29 +329,295 @@ func (sql *sqlRepository) CreateAsset(assetData oam.Asset) (*types.Asset, error)
 					asset.ID = id
 					asset.CreatedAt = a.CreatedAt
 					asset.LastSeen = a.LastSeen
+					// the row is saved in full, so the external ID assigned to it is kept
+					asset.ExternalID = nullableExternalID(a.ExternalID)
+					previous = a
 					break
 				}
 			}
 		}
 	}
 
-	result := sql.db.Save(&asset)
+	created := asset.ID == 0
+	if created {
+		// the insert does nothing when a concurrent writer stored the same asset after the lookup above
+		result := sql.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "hash"}},
+			DoNothing: true,
+		}).Create(&asset)
+		if result.Error != nil {
+			return nil, false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			if err := sql.db.Where("hash = ?", hash).First(&asset).Error; err != nil {
+				return nil, false, err
+			}
+			created = false
+		}
+	} else if err := sql.saveAsset(&asset, previous); err != nil {
+		return nil, false, err
+	}
+
+	stored := &types.Asset{
+		ID:         strconv.FormatUint(asset.ID, 10),
+		CreatedAt:  asset.CreatedAt,
+		LastSeen:   asset.LastSeen,
+		ExternalID: asset.ExternalIDValue(),
+		Asset:      assetData,
+	}
+	return stored, created, nil
+}
+
+// notifyCreated calls the functions registered by WithAssetCreated with the asset stored as a new row.
+// Within a transaction started by Transaction, the asset is held until the transaction is committed.
+func (sql *sqlRepository) notifyCreated(stored *types.Asset) {
+	if sql.committed != nil {
+		*sql.committed = append(*sql.committed, stored)
+		return
+	}
+	for _, fn := range sql.created {
+		fn(stored)
+	}
+}
+
+// CreateOrUpdateAsset creates the asset in the database, or updates the last seen timestamp if the asset already exists.
+// The insert does nothing when a concurrent writer stored the same asset first, and that row is updated instead,
+// so a single row is created no matter how many callers race on the asset.
+// The operation runs in a transaction, which is retried with a jittered backoff when the database reports a serialization failure,
+// a deadlock or a busy SQLite database, up to the number of attempts set by WithUpsertRetries.
+// Returns the stored asset as a types.Asset, true if a new row was created or false if an existing row was updated,
+// and an error wrapping ErrUnsupportedAssetType if the type of the asset is not supported, or an error if the operation fails.
+func (sql *sqlRepository) CreateOrUpdateAsset(assetData oam.Asset) (*types.Asset, bool, error) {
+	var stored *types.Asset
+	var created bool
+
+	err := sql.retry(func() error {
+		return sql.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+
+			stored, created, err = sql.scoped(tx).upsertAsset(assetData)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created {
+		sql.notifyCreated(stored)
+	}
+	return stored, created, nil
+}
+
+// upsertAsset stores the asset as CreateOrUpdateAsset does, without notifying the functions registered by WithAssetCreated.
+func (sql *sqlRepository) upsertAsset(assetData oam.Asset) (*types.Asset, bool, error) {
+	if err := checkSupported(assetData); err != nil {
+		return nil, false, err
+	}
+
+	assetData = sql.normalize(assetData)
+	if assets, err := sql.FindAssetByContent(assetData, time.Time{}); err == nil && len(assets) > 0 {
+		for _, a := range assets {
+			if assetData.AssetType() == a.Asset.AssetType() {
+				return sql.touchAsset(a.ID)
+			}
+		}
+	}
+
+	jsonContent, err := assetData.JSON()
+	if err != nil {
+		return nil, false, err
+	}
+
+	hash := assetHash(assetData)
+	asset := Asset{
+		Type:    string(assetData.AssetType()),
+		Content: jsonContent,
+		Hash:    &hash,
+	}
+	sql.stampCreated(&asset)
+
+	result := sql.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoNothing: true,
+	}).Create(&asset)
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// another writer stored the asset between the lookup and the insert
+		var existing Asset
+		if err := sql.db.Where("hash = ?", hash).First(&existing).Error; err != nil {
+			return nil, false, err
+		}
+		return sql.touchAsset(strconv.FormatUint(existing.ID, 10))
 	}
 
-	return &types.Asset{
+	stored := &types.Asset{
 		ID:        strconv.FormatUint(asset.ID, 10),
 		CreatedAt: asset.CreatedAt,
 		LastSeen:  asset.LastSeen,
 		Asset:     assetData,
+	}
+	return stored, true, nil
+}
+
+// CreateAssetIfNotSeenSince creates the asset in the database unless an asset with the same type and key field was last seen
+// at or after the since parameter, in which case the existing asset is returned unchanged.
+// A stored asset last seen before since has its last seen timestamp updated, as CreateOrUpdateAsset does.
+// The check and the write run in a single transaction, which locks the existing row on Postgres and is retried as
+// the CreateOrUpdateAsset transaction is, so concurrent callers never both create or refresh the asset.
+// If since.IsZero(), any stored asset satisfies the check. The last seen time of a new asset is moved back by the jitter
+// set by WithLastSeenJitter, so the check against a recent since parameter can fail for an asset just created.
+// Returns the stored asset as a types.Asset, true if the asset was created or refreshed, or false if the existing asset
+// was already fresh, and an error if the operation fails.
+func (sql *sqlRepository) CreateAssetIfNotSeenSince(assetData oam.Asset, since time.Time) (*types.Asset, bool, error) {
+	var stored *types.Asset
+	var created, written bool
+
+	err := sql.retry(func() error {
+		return sql.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+
+			stored, created, written, err = sql.scoped(tx).createIfNotSeenSince(assetData, since)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created {
+		sql.notifyCreated(stored)
+	}
+	return stored, written, nil
+}
+
+// createIfNotSeenSince performs the check and the write of CreateAssetIfNotSeenSince within the transaction of the repository.
+// Returns the stored asset, true if a new row was created, and true if the asset was created or refreshed.
+func (sql *sqlRepository) createIfNotSeenSince(assetData oam.Asset, since time.Time) (*types.Asset, bool, bool, error) {
+	assetData = sql.normalize(assetData)
+
+	found, err := sql.FindAssetByContent(assetData, time.Time{})
+	if err != nil {
+		return nil, false, false, err
+	}
+	if len(found) == 0 {
+		stored, created, err := sql.createAsset(assetData)
+		if err != nil {
+			return nil, false, false, err
+		}
+		// a concurrent writer stored the asset first, so it was just seen
+		return stored, created, created, nil
+	}
+
+	existing := found[0]
+	if sql.dbType == Postgres {
+		// lock the row and read its last seen timestamp again, so a concurrent refresh is waited for
+		var row Asset
+		if err := sql.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", existing.ID).First(&row).Error; err != nil {
+			return nil, false, false, err
+		}
+		existing.LastSeen = row.LastSeen
+	}
+	if since.IsZero() || !existing.LastSeen.Before(since) {
+		return existing, false, false, nil
+	}
+
+	refreshed, _, err := sql.touchAsset(existing.ID)
+	if err != nil {
+		return nil, false, false, err
+	}
+	return refreshed, false, true, nil
+}
+
+// touchAsset updates the last seen timestamp of an existing asset and returns the updated asset.
+func (sql *sqlRepository) touchAsset(id string) (*types.Asset, bool, error) {
+	if err := sql.UpdateAssetLastSeen(id); err != nil {
+		return nil, false, err
+	}
+
+	updated, err := sql.FindAssetById(id, time.Time{})
+	if err != nil {
+		return nil, false, err
+	}
+	return updated, false, nil
+}
+
+// ImportAsset creates the provided asset in the database while preserving its CreatedAt and LastSeen timestamps and its ExternalID.
+// If the asset already exists, the earliest CreatedAt and the latest LastSeen of the two are kept,
+// along with the external ID of the existing asset when the provided asset has none.
+// FQDNs and email addresses are normalized before they are stored, as CreateAsset normalizes them,
+// so an asset exported from a repository created with WithExactContent is found by the lookups of this one.
+// Returns the stored asset as a types.Asset, an error wrapping ErrUnsupportedAssetType if the type of the asset is not supported,
+// or an error if the import fails.
+func (sql *sqlRepository) ImportAsset(a *types.Asset) (*types.Asset, error) {
+	if err := checkSupported(a.Asset); err != nil {
+		return nil, err
+	}
+
+	assetData := sql.normalize(a.Asset)
+	jsonContent, err := assetData.JSON()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := assetHash(assetData)
+	asset := Asset{
+		CreatedAt:  a.CreatedAt,
+		LastSeen:   a.LastSeen,
+		Type:       string(assetData.AssetType()),
+		Content:    jsonContent,
+		Hash:       &hash,
+		ExternalID: nullableExternalID(a.ExternalID),
+	}
+
+	// ensure that duplicate assets are not entered into the database
+	if assets, err := sql.FindAssetByContent(assetData, time.Time{}); err == nil && len(assets) > 0 {
+		for _, dup := range assets {
+			if assetData.AssetType() == dup.Asset.AssetType() {
+				if id, err := strconv.ParseUint(dup.ID, 10, 64); err == nil {
+					asset.ID = id
+					if asset.CreatedAt.IsZero() || dup.CreatedAt.Before(asset.CreatedAt) {
+						asset.CreatedAt = dup.CreatedAt
+					}
+					if dup.LastSeen.After(asset.LastSeen) {
+						asset.LastSeen = dup.LastSeen
+					}
+					if asset.ExternalID == nil {
+						asset.ExternalID = nullableExternalID(dup.ExternalID)
+					}
+					break
+				}
+			}
+		}
+	}
+
+	result := sql.db.Save(&asset)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &types.Asset{
+		ID:         strconv.FormatUint(asset.ID, 10),
+		CreatedAt:  asset.CreatedAt,
+		LastSeen:   asset.LastSeen,
+		ExternalID: asset.ExternalIDValue(),
+		Asset:      assetData,
 	}, nil
 }
 
 // UpdateAssetLastSeen performs an update on the asset.
-// this function delegates to the database so that the Timezone information is preserved.
+// this function delegates to the database so that the Timezone information is preserved,
+// unless the repository was configured with a Clock.
 func (sql *sqlRepository) UpdateAssetLastSeen(id string) error {
-	result := sql.db.Exec("UPDATE assets SET last_seen = current_timestamp WHERE id = ?", id)
+	var result *gorm.DB
+
+	if sql.clock != nil {
+		result = sql.db.Exec("UPDATE assets SET last_seen = ? WHERE id = ?", sql.now(), id)
+	} else {
+		result = sql.db.Exec("UPDATE assets SET last_seen = current_timestamp WHERE id = ?", id)
+	}
 	if result.Error != nil {
 		return result.Error
 	}
@@ -137,92 +626,228 @@ func (sql *sqlRepository) UpdateAssetLastSeen(id string) error {
 
 // DeleteAsset removes an asset in the database by its ID.
 // It takes a string representing the asset ID and removes the corresponding asset from the database.
+// The relations, relation sources, raw data, content history and tags of the asset are removed along with it
+// within a single transaction, as DeleteAssetsNotSeenSince removes them.
 // Returns an error if the asset is not found.
 func (sql *sqlRepository) DeleteAsset(id string) error {
-	var ids []uint64
+	assetId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return err
+	}
 
-	if rels, err := sql.IncomingRelations(&types.Asset{ID: id}, time.Time{}); err == nil {
-		for _, rel := range rels {
-			if relId, err := strconv.ParseUint(rel.ID, 10, 64); err == nil {
-				ids = append(ids, relId)
-			}
+	return sql.db.Transaction(func(tx *gorm.DB) error {
+		_, err := sql.deleteAssets(tx, []uint64{assetId})
+		return err
+	})
+}
+
+// DeleteAssetsNotSeenSince removes all assets in the database last seen before the cutoff, along with their relations.
+// The IDs of the stale assets are selected once, and the relations, relation sources, raw data, content history, tags, and assets
+// with those IDs are then removed within a single transaction, so an asset seen again during the removal is never left
+// without its relations.
+// Returns the number of assets removed or an error if the removal fails.
+func (sql *sqlRepository) DeleteAssetsNotSeenSince(cutoff time.Time) (int64, error) {
+	var count int64
+
+	err := sql.db.Transaction(func(tx *gorm.DB) error {
+		stale := tx.Model(&Asset{}).Where("last_seen < ?", sql.sinceArg(cutoff))
+		if sql.dbType == Postgres {
+			// lock the stale rows until they are removed, so their last seen timestamps cannot change
+			stale = stale.Clauses(clause.Locking{Strength: "UPDATE"})
 		}
-	}
 
-	if rels, err := sql.OutgoingRelations(&types.Asset{ID: id}, time.Time{}); err == nil {
-		for _, rel := range rels {
-			if relId, err := strconv.ParseUint(rel.ID, 10, 64); err == nil {
-				ids = append(ids, relId)
-			}
+		var ids []uint64
+		if err := stale.Pluck("id", &ids).Error; err != nil {
+			return err
 		}
-	}
 
-	if err := sql.deleteRelations(ids); err != nil {
+		var err error
+		count, err = sql.deleteAssets(tx, ids)
 		return err
+	})
+	if err != nil {
+		return 0, err
 	}
+	return count, nil
+}
 
-	assetId, err := strconv.ParseUint(id, 10, 64)
-	if err != nil {
-		return err
+// deleteAssets removes the assets with the provided IDs within the transaction, in batches of the size returned by batch,
+// along with the relations from or to them, the sources of those relations, the relations the assets are a source of,
+// and their raw data, content history and tags.
+// Returns the number of assets removed.
+func (sql *sqlRepository) deleteAssets(tx *gorm.DB, ids []uint64) (int64, error) {
+	var count int64
+
+	size := sql.batch()
+	for start := 0; start < len(ids); start += size {
+		batch := ids[start:min(start+size, len(ids))]
+
+		relations := tx.Where("from_asset_id IN ? OR to_asset_id IN ?", batch, batch)
+		if err := deleteRelationSources(tx, relations); err != nil {
+			return count, err
+		}
+		if err := tx.Where("source_id IN ?", batch).Delete(&RelationSource{}).Error; err != nil {
+			return count, err
+		}
+		if err := tx.Where("from_asset_id IN ? OR to_asset_id IN ?", batch, batch).Delete(&Relation{}).Error; err != nil {
+			return count, err
+		}
+		if err := tx.Where("asset_id IN ?", batch).Delete(&AssetRaw{}).Error; err != nil {
+			return count, err
+		}
+		if err := tx.Where("asset_id IN ?", batch).Delete(&AssetHistory{}).Error; err != nil {
+			return count, err
+		}
+		if err := tx.Where("asset_id IN ?", batch).Delete(&AssetTag{}).Error; err != nil {
+			return count, err
+		}
+
+		result := tx.Where("id IN ?", batch).Delete(&Asset{})
+		if result.Error != nil {
+			return count, result.Error
+		}
+		count += result.RowsAffected
 	}
+	return count, nil
+}
 
-	asset := Asset{ID: assetId}
-	result := sql.db.Delete(&asset)
+// PreviewDeleteAssetsNotSeenSince finds the assets that DeleteAssetsNotSeenSince would remove for the cutoff, without removing them.
+// Returns the IDs of the matching assets or an error if the search fails.
+func (sql *sqlRepository) PreviewDeleteAssetsNotSeenSince(cutoff time.Time) ([]string, error) {
+	var ids []uint64
+
+	result := sql.db.Model(&Asset{}).Where("last_seen < ?", sql.sinceArg(cutoff)).Order("id").Pluck("id", &ids)
 	if result.Error != nil {
-		return result.Error
+		return nil, result.Error
 	}
-	return nil
+
+	stale := make([]string, 0, len(ids))
+	for _, id := range ids {
+		stale = append(stale, strconv.FormatUint(id, 10))
+	}
+	return stale, nil
 }
 
 // DeleteRelation removes a relation in the database by its ID.
 // It takes a string representing the relation ID and removes the corresponding relation from the database.
+// A relation of a type set by WithSymmetricRelations is removed in both directions within a single transaction.
 // Returns an error if the relation is not found.
 func (sql *sqlRepository) DeleteRelation(id string) error {
 	relId, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
 		return err
 	}
-	return sql.deleteRelations([]uint64{relId})
+
+	return sql.db.Transaction(func(tx *gorm.DB) error {
+		_, err := sql.deleteRelations(tx, []uint64{relId})
+		return err
+	})
+}
+
+// DeleteRelations removes the relations in the database with the provided IDs.
+// The relations are removed in chunks of IDs, each within a single transaction, and the removal stops at the first chunk that fails.
+// The chunks removed before the failure remain removed. Relations of the types set by WithSymmetricRelations are removed
+// in both directions, along with the other relations of their chunk.
+// Returns the number of relations removed, including the reverse directions and those removed before a failure,
+// and an error if a chunk fails.
+func (sql *sqlRepository) DeleteRelations(ids []string) (int64, error) {
+	relIds := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		relId, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		relIds = append(relIds, relId)
+	}
+
+	var count int64
+	size := sql.batch()
+	for start := 0; start < len(relIds); start += size {
+		batch := relIds[start:min(start+size, len(relIds))]
+
+		err := sql.db.Transaction(func(tx *gorm.DB) error {
+			removed, err := sql.deleteRelations(tx, batch)
+			if err != nil {
+				return err
+			}
+			count += removed
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// deleteRelations removes the relations with the provided IDs and the reverse directions of the symmetric relations among them
+// within the transaction, along with the sources asserting them.
+// Returns the number of relations removed.
+func (sql *sqlRepository) deleteRelations(tx *gorm.DB, ids []uint64) (int64, error) {
+	reverse, err := sql.reverseRelations(tx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	all := slices.Clone(ids)
+	for _, id := range reverse {
+		if !slices.Contains(all, id) {
+			all = append(all, id)
+		}
+	}
+
+	if err := deleteRelationSources(tx, tx.Where("id IN ?", all)); err != nil {
+		return 0, err
+	}
+
+	result := tx.Exec("DELETE FROM relations WHERE id IN ?", all)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
 }
 
-// deleteRelations removes all rows in the Relations table with primary keys in the provided slice.
-func (sql *sqlRepository) deleteRelations(ids []uint64) error {
-	return sql.db.Exec("DELETE FROM relations WHERE id IN ?", ids).Error
+// reverseRelations finds the rows holding the reverse direction of the relations with the provided IDs whose types were set
+// by WithSymmetricRelations, so both directions of a symmetric relation are changed together.
+// Returns the IDs of the reverse rows, or no IDs when no relation type is symmetric.
+func (sql *sqlRepository) reverseRelations(tx *gorm.DB, ids []uint64) ([]uint64, error) {
+	if len(sql.symmetric) == 0 || len(ids) == 0 {
+		return nil, nil
+	}
+
+	var reverse []uint64
+	err := tx.Table("relations AS rev").
+		Joins("JOIN relations AS fwd ON fwd.from_asset_id = rev.to_asset_id AND fwd.to_asset_id = rev.from_asset_id AND fwd.type = rev.type").
+		Where("fwd.id IN ? AND fwd.type IN ?", ids, slices.Collect(maps.Keys(sql.symmetric))).
+		Pluck("rev.id", &reverse).Error
+	if err != nil {
+		return nil, err
+	}
+	return reverse, nil
 }
 
-// FindAssetByContent finds assets in the database that match the provided asset data and last seen after the since parameter.
+// FindAssetByContent finds assets in the database that match the provided asset data and last seen at or after the since parameter.
 // It takes an oam.Asset as input and searches for assets with matching content in the database.
 // If since.IsZero(), the parameter will be ignored.
-// The asset data is serialized to JSON and compared against the Content field of the Asset struct.
+// Assets are matched by their hash, and by the Content field for rows that have not been assigned a hash.
+// The provided asset is normalized as CreateAsset normalizes the assets it stores.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
 // Returns a slice of matching assets as []*types.Asset or an error if the search fails.
 func (sql *sqlRepository) FindAssetByContent(assetData oam.Asset, since time.Time) ([]*types.Asset, error) {
-	jsonContent, err := assetData.JSON()
+	assetData = sql.normalize(assetData)
+	query, err := contentQuery(assetData)
 	if err != nil {
 		return []*types.Asset{}, err
 	}
 
-	asset := Asset{
-		Type:    string(assetData.AssetType()),
-		Content: jsonContent,
-	}
+	tx := sql.db.Where("type = ?", string(assetData.AssetType())).Where(query)
 	if !since.IsZero() {
-		asset.LastSeen = since
-	}
-
-	jsonQuery, err := asset.JSONQuery()
-	if err != nil {
-		return []*types.Asset{}, err
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
 	}
 
 	var assets []Asset
-	var result *gorm.DB
-	if since.IsZero() {
-		result = sql.db.Where("type = ?", asset.Type).Find(&assets, jsonQuery)
-	} else {
-		result = sql.db.Where("type = ? AND last_seen > ?", asset.Type, since).Find(&assets, jsonQuery)
-	}
-	if result.Error != nil {
-		return []*types.Asset{}, result.Error
+	if err := findAll(sql, tx, &assets); err != nil {
+		return []*types.Asset{}, err
 	}
 
 	var storedAssets []*types.Asset
@@ -233,17 +858,189 @@ func (sql *sqlRepository) FindAssetByContent(assetData oam.Asset, since time.Tim
 		}
 
 		storedAssets = append(storedAssets, &types.Asset{
-			ID:        strconv.FormatUint(asset.ID, 10),
-			CreatedAt: asset.CreatedAt,
-			LastSeen:  asset.LastSeen,
-			Asset:     assetData,
+			ID:         strconv.FormatUint(asset.ID, 10),
+			CreatedAt:  asset.CreatedAt,
+			LastSeen:   asset.LastSeen,
+			ExternalID: asset.ExternalIDValue(),
+			Asset:      assetData,
 		})
 	}
 
 	return storedAssets, nil
 }
 
-// FindAssetById finds an asset in the database by its ID and last seen after the since parameter.
+// FindAssetByContents finds assets in the database that match any of the provided assets and last seen at or after the since parameter.
+// The provided assets are grouped by type, and a single query with OR'd content query expressions is issued per type,
+// split into statements matching up to a third of the batch size set by WithBatchSize, since each expression binds several variables.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when a statement finds more assets than the maximum set by WithMaxResults.
+// Returns the matching assets keyed by the ContentsKey of each provided asset, or an error if the search fails.
+func (sql *sqlRepository) FindAssetByContents(assets []oam.Asset, since time.Time) (map[string][]*types.Asset, error) {
+	normalized := sql.normalizeAll(assets)
+	byType, err := contentQueriesByType(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	// the results are keyed by the provided assets, which may differ from their normalized form
+	keys := make(map[string][]string)
+	for i, a := range normalized {
+		nkey, key := ContentsKey(a), ContentsKey(assets[i])
+		if !slices.Contains(keys[nkey], key) {
+			keys[nkey] = append(keys[nkey], key)
+		}
+	}
+
+	// each content expression binds up to five variables, so a statement stays within twice the batch size
+	chunk := max(1, sql.batch()/3)
+
+	results := make(map[string][]*types.Asset)
+	for atype, queries := range byType {
+		var exprs []clause.Expression
+		for _, q := range queries {
+			exprs = append(exprs, q)
+		}
+
+		for part := range slices.Chunk(exprs, chunk) {
+			tx := sql.db.Where("type = ?", atype)
+			if !since.IsZero() {
+				tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+			}
+
+			var found []Asset
+			if err := findAll(sql, tx.Where(anyOf(part)), &found); err != nil {
+				return nil, err
+			}
+
+			for _, f := range found {
+				a, err := sql.gormAssetToAsset(&f)
+				if err != nil {
+					return nil, err
+				}
+
+				if nkey := ContentsKey(a.Asset); queries[nkey] != nil {
+					for _, key := range keys[nkey] {
+						results[key] = append(results[key], a)
+					}
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// contentQueriesByType groups the content query expressions of the provided assets by asset type.
+// Within each type, the expressions are keyed by the ContentsKey of the asset.
+func contentQueriesByType(assets []oam.Asset) (map[string]map[string]clause.Expression, error) {
+	byType := make(map[string]map[string]clause.Expression)
+
+	for _, a := range assets {
+		query, err := contentQuery(a)
+		if err != nil {
+			return nil, err
+		}
+
+		atype := string(a.AssetType())
+		if _, found := byType[atype]; !found {
+			byType[atype] = make(map[string]clause.Expression)
+		}
+		byType[atype][ContentsKey(a)] = query
+	}
+	return byType, nil
+}
+
+// contentQuery returns the expression matching stored assets with the same type and key field as the provided asset.
+// Rows are matched by their hash, and rows without a hash fall back to the JSON query of the content.
+func contentQuery(a oam.Asset) (clause.Expression, error) {
+	jsonContent, err := a.JSON()
+	if err != nil {
+		return nil, err
+	}
+
+	asset := Asset{
+		Type:    string(a.AssetType()),
+		Content: jsonContent,
+	}
+
+	jsonQuery, err := asset.JSONQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	return clause.Expr{
+		SQL:  "(hash = ? OR (hash IS NULL AND ?))",
+		Vars: []interface{}{assetHash(a), jsonQuery},
+	}, nil
+}
+
+// BackfillAssetHashes assigns the hash to stored assets that do not have one, such as rows created before the hash was introduced.
+// Rows that duplicate an asset already holding the hash are left unchanged.
+// Returns the number of assets updated or an error if the backfill fails.
+func (sql *sqlRepository) BackfillAssetHashes() (int64, error) {
+	var count int64
+	var assets []Asset
+
+	result := sql.db.Where("hash IS NULL").FindInBatches(&assets, sql.batch(), func(tx *gorm.DB, batch int) error {
+		for _, a := range assets {
+			asset, err := a.Parse()
+			if err != nil {
+				return err
+			}
+
+			hash := assetHash(asset)
+			update := sql.db.Exec("UPDATE assets SET hash = ? WHERE id = ? AND NOT EXISTS "+
+				"(SELECT 1 FROM assets WHERE hash = ?)", hash, a.ID, hash)
+			if update.Error != nil {
+				return update.Error
+			}
+			count += update.RowsAffected
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return count, result.Error
+	}
+	return count, nil
+}
+
+// anyOf combines the expressions with OR semantics.
+// A single expression is returned as is, since gorm renders a lone OR condition as a bare OR term.
+func anyOf(exprs []clause.Expression) clause.Expression {
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	return clause.Or(exprs...)
+}
+
+// ContentsKey returns the key used to identify the provided asset in the results of FindAssetByContents.
+// The key is built from the asset type and the fields returned by IdentityFields, which are matched by the JSON query of the asset.
+// Each field is prefixed with its length in bytes, so the fields of two different assets can never run together into the same key.
+// The fields of the organizations and persons are lowercased, since their names are matched regardless of case.
+func ContentsKey(asset oam.Asset) string {
+	fields := []string{string(asset.AssetType())}
+
+	if identity, err := IdentityFields(asset); err == nil {
+		for _, f := range identity {
+			if caseInsensitive(asset.AssetType()) {
+				f.Value = strings.ToLower(f.Value)
+			}
+			fields = append(fields, f.Value)
+		}
+	} else {
+		fields = append(fields, asset.Key())
+	}
+
+	var key strings.Builder
+	for _, f := range fields {
+		key.WriteString(strconv.Itoa(len(f)))
+		key.WriteByte(':')
+		key.WriteString(f)
+	}
+	return key.String()
+}
+
+// FindAssetById finds an asset in the database by its ID and last seen at or after the since parameter.
 // It takes a string representing the asset ID and retrieves the corresponding asset from the database.
 // If since.IsZero(), the parameter will be ignored.
 // Returns the found asset as a types.Asset or an error if the asset is not found.
@@ -258,7 +1055,7 @@ func (sql *sqlRepository) FindAssetById(id string, since time.Time) (*types.Asse
 	if since.IsZero() {
 		result = sql.db.First(&asset)
 	} else {
-		result = sql.db.Where("last_seen > ?", since).First(&asset)
+		result = sql.db.Where("last_seen >= ?", sql.sinceArg(since)).First(&asset)
 	}
 	if result.Error != nil {
 		return &types.Asset{}, result.Error
@@ -270,38 +1067,63 @@ func (sql *sqlRepository) FindAssetById(id string, since time.Time) (*types.Asse
 	}
 
 	return &types.Asset{
-		ID:        strconv.FormatUint(asset.ID, 10),
-		CreatedAt: asset.CreatedAt,
-		LastSeen:  asset.LastSeen,
-		Asset:     assetData,
+		ID:         strconv.FormatUint(asset.ID, 10),
+		CreatedAt:  asset.CreatedAt,
+		LastSeen:   asset.LastSeen,
+		ExternalID: asset.ExternalIDValue(),
+		Asset:      assetData,
 	}, nil
 }
 
-// FindAssetByType finds all assets in the database of the provided asset type and last seen after the since parameter.
+// FindAssetByType finds all assets in the database of the provided asset type and last seen at or after the since parameter.
 // It takes an asset type and retrieves the corresponding assets from the database.
 // If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
 // Returns a slice of matching assets as []*types.Asset or an error if the search fails.
 func (sql *sqlRepository) FindAssetByType(atype oam.AssetType, since time.Time) ([]*types.Asset, error) {
-	var assets []Asset
-	var result *gorm.DB
+	return sql.FindAssetByTypeOrdered(atype, since, Order{})
+}
 
-	if since.IsZero() {
-		result = sql.db.Where("type = ?", atype).Find(&assets)
-	} else {
-		result = sql.db.Where("type = ? AND last_seen > ?", atype, since).Find(&assets)
+// FindAssetByTypeOrdered finds all assets in the database of the provided asset type and last seen at or after the since parameter,
+// ordered as described by the order parameter. Assets ordered by their key field are ordered by the JSON value of the field.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns a slice of matching assets as []*types.Asset or an error if the search fails.
+func (sql *sqlRepository) FindAssetByTypeOrdered(atype oam.AssetType, since time.Time, order Order) ([]*types.Asset, error) {
+	tx := sql.db.Where("type = ?", atype)
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
 	}
-	if result.Error != nil {
-		return []*types.Asset{}, result.Error
+
+	var key clause.Expression
+	if order.Field == OrderByKey {
+		var err error
+
+		key, err = sql.keyExpression(atype)
+		if err != nil {
+			return []*types.Asset{}, err
+		}
+	}
+
+	tx, err := order.apply(tx, "assets", key)
+	if err != nil {
+		return []*types.Asset{}, err
+	}
+
+	var assets []Asset
+	if err := findAll(sql, tx, &assets); err != nil {
+		return []*types.Asset{}, err
 	}
 
 	var results []*types.Asset
 	for _, a := range assets {
 		if f, err := a.Parse(); err == nil {
 			results = append(results, &types.Asset{
-				ID:        strconv.FormatUint(a.ID, 10),
-				CreatedAt: a.CreatedAt,
-				LastSeen:  a.LastSeen,
-				Asset:     f,
+				ID:         strconv.FormatUint(a.ID, 10),
+				CreatedAt:  a.CreatedAt,
+				LastSeen:   a.LastSeen,
+				ExternalID: a.ExternalIDValue(),
+				Asset:      f,
 			})
 		}
 	}
@@ -312,9 +1134,172 @@ func (sql *sqlRepository) FindAssetByType(atype oam.AssetType, since time.Time)
 	return results, nil
 }
 
+// FindAssetByTypes finds all assets in the database of any of the provided asset types and last seen at or after the since parameter.
+// The assets are retrieved with a single query and ordered by their ID.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns a slice of matching assets as []*types.Asset or an error if the search fails.
+func (sql *sqlRepository) FindAssetByTypes(atypes []oam.AssetType, since time.Time) ([]*types.Asset, error) {
+	if len(atypes) == 0 {
+		return []*types.Asset{}, errors.New("no asset types provided")
+	}
+
+	tx := sql.db.Where("type IN ?", atypes)
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var assets []Asset
+	if err := findAll(sql, tx.Order("id"), &assets); err != nil {
+		return []*types.Asset{}, err
+	}
+
+	var results []*types.Asset
+	for _, a := range assets {
+		if f, err := a.Parse(); err == nil {
+			results = append(results, &types.Asset{
+				ID:         strconv.FormatUint(a.ID, 10),
+				CreatedAt:  a.CreatedAt,
+				LastSeen:   a.LastSeen,
+				ExternalID: a.ExternalIDValue(),
+				Asset:      f,
+			})
+		}
+	}
+
+	if len(results) == 0 {
+		return []*types.Asset{}, errors.New("no assets of the specified types")
+	}
+	return results, nil
+}
+
+// RecentlyChangedAssets returns up to limit assets of any type, ordered by their last seen timestamp with the most recent first.
+// Assets seen at the same time are ordered by their ID, so newer rows come first.
+// Returns a slice of the assets as []*types.Asset, which is empty when the database holds no assets, or an error if the search fails.
+func (sql *sqlRepository) RecentlyChangedAssets(limit int) ([]*types.Asset, error) {
+	if limit <= 0 {
+		return []*types.Asset{}, errors.New("the limit must be greater than zero")
+	}
+
+	var assets []Asset
+	if err := sql.db.Order("last_seen DESC").Order("id DESC").Limit(limit).Find(&assets).Error; err != nil {
+		return []*types.Asset{}, err
+	}
+
+	results := []*types.Asset{}
+	for _, a := range assets {
+		if f, err := a.Parse(); err == nil {
+			results = append(results, &types.Asset{
+				ID:         strconv.FormatUint(a.ID, 10),
+				CreatedAt:  a.CreatedAt,
+				LastSeen:   a.LastSeen,
+				ExternalID: a.ExternalIDValue(),
+				Asset:      f,
+			})
+		}
+	}
+	return results, nil
+}
+
+// StalestAssetsByType returns up to n assets of the provided asset type, ordered by their last seen timestamp with the least recent first,
+// such as to refresh the assets that have gone the longest without being observed. Assets seen at the same time are ordered by their ID.
+// Returns a slice of the assets as []*types.Asset, which is empty when no asset of the type is stored, or an error if the search fails.
+func (sql *sqlRepository) StalestAssetsByType(atype oam.AssetType, n int) ([]*types.Asset, error) {
+	if n <= 0 {
+		return []*types.Asset{}, errors.New("the limit must be greater than zero")
+	}
+
+	var assets []Asset
+	if err := sql.db.Where("type = ?", atype).Order("last_seen ASC").Order("id ASC").Limit(n).Find(&assets).Error; err != nil {
+		return []*types.Asset{}, err
+	}
+
+	results := []*types.Asset{}
+	for _, a := range assets {
+		if f, err := a.Parse(); err == nil {
+			results = append(results, &types.Asset{
+				ID:         strconv.FormatUint(a.ID, 10),
+				CreatedAt:  a.CreatedAt,
+				LastSeen:   a.LastSeen,
+				ExternalID: a.ExternalIDValue(),
+				Asset:      f,
+			})
+		}
+	}
+	return results, nil
+}
+
+// FindAssetsWithOutgoingRelation finds the assets of the provided asset type that have at least one outgoing relation of the
+// relation type and were last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns a slice of matching assets as []*types.Asset or an error if the search fails.
+func (sql *sqlRepository) FindAssetsWithOutgoingRelation(atype oam.AssetType, relationType string, since time.Time) ([]*types.Asset, error) {
+	return sql.findAssetsWithRelation(atype, "from_asset_id", relationType, nil, since)
+}
+
+// FindAssetsWithIncomingRelation finds the assets of the provided asset type that have at least one incoming relation of the
+// relation type and were last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns a slice of matching assets as []*types.Asset or an error if the search fails.
+func (sql *sqlRepository) FindAssetsWithIncomingRelation(atype oam.AssetType, relationType string, since time.Time) ([]*types.Asset, error) {
+	return sql.findAssetsWithRelation(atype, "to_asset_id", relationType, nil, since)
+}
+
+// FindAssetByTypeFromSource finds the assets of the provided asset type linked to the Source with the provided name
+// and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns a slice of matching assets as []*types.Asset or an error if the search fails.
+func (sql *sqlRepository) FindAssetByTypeFromSource(atype oam.AssetType, sourceName string, since time.Time) ([]*types.Asset, error) {
+	query, err := contentQuery(&source.Source{Name: sourceName})
+	if err != nil {
+		return nil, err
+	}
+
+	sources := sql.db.Model(&Asset{}).Select("id").Where("type = ?", oam.Source).Where(query)
+	return sql.findAssetsWithRelation(atype, "from_asset_id", sourceRelation, sources, since)
+}
+
+// findAssetsWithRelation finds the assets of the provided type referenced by the column of at least one relation of the relation type,
+// using an EXISTS subquery on the relations table. When related is not nil, the asset at the other end of the relation
+// must also be selected by the related subquery.
+func (sql *sqlRepository) findAssetsWithRelation(atype oam.AssetType, column, relationType string, related *gorm.DB, since time.Time) ([]*types.Asset, error) {
+	exists := sql.db.Table("relations").Select("1").Where("relations."+column+" = assets.id AND relations.type = ?", relationType)
+	if related != nil {
+		other := "to_asset_id"
+		if column == "to_asset_id" {
+			other = "from_asset_id"
+		}
+		exists = exists.Where("relations."+other+" IN (?)", related)
+	}
+
+	tx := sql.db.Where("assets.type = ? AND EXISTS (?)", atype, exists)
+	if !since.IsZero() {
+		tx = tx.Where("assets.last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var assets []Asset
+	if err := findAll(sql, tx, &assets); err != nil {
+		return nil, err
+	}
+
+	results := make([]*types.Asset, 0, len(assets))
+	for _, a := range assets {
+		asset, err := sql.gormAssetToAsset(&a)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, asset)
+	}
+	return results, nil
+}
+
 // Link creates a relation between two assets in the database.
 // It takes the source asset, relation type, and destination asset as inputs.
 // The relation is established by creating a new Relation struct in the database, linking the two assets.
+// Relations of the types set by WithSymmetricRelations are also stored from the destination to the source.
 // Returns the created relation as a types.Relation or an error if the link creation fails.
 func (sql *sqlRepository) Link(source *types.Asset, relation string, destination *types.Asset) (*types.Relation, error) {
 	// check that this link will create a valid relationship within the taxonomy
@@ -323,29 +1308,138 @@ func (sql *sqlRepository) Link(source *types.Asset, relation string, destination
 	if !oam.ValidRelationship(srctype, relation, destype) {
 		return &types.Relation{}, fmt.Errorf("%s -%s-> %s is not valid in the taxonomy", srctype, relation, destype)
 	}
-
-	// ensure that duplicate relationships are not entered into the database
-	if rel, found := sql.isDuplicateRelation(source, relation, destination); found {
-		return rel, nil
+
+	if _, found := sql.symmetric[relation]; found {
+		return sql.linkSymmetric(source, relation, destination)
+	}
+	return sql.link(source, relation, destination)
+}
+
+// linkSymmetric stores the relation in both directions within a single transaction, so the reverse relation is
+// returned by the queries of either asset. Each direction is deduplicated as link deduplicates the relations,
+// so a symmetric relation is held by two rows, no matter the direction it is linked in or how many times.
+func (sql *sqlRepository) linkSymmetric(source *types.Asset, relation string, destination *types.Asset) (*types.Relation, error) {
+	srctype := source.Asset.AssetType()
+	destype := destination.Asset.AssetType()
+	if !oam.ValidRelationship(destype, relation, srctype) {
+		return &types.Relation{}, fmt.Errorf("the symmetric relation %s -%s-> %s is not valid in the taxonomy", destype, relation, srctype)
+	}
+
+	var rel *types.Relation
+	err := sql.db.Transaction(func(tx *gorm.DB) error {
+		scoped := sql.scoped(tx)
+
+		var err error
+		if rel, err = scoped.link(source, relation, destination); err != nil {
+			return err
+		}
+		_, err = scoped.link(destination, relation, source)
+		return err
+	})
+	if err != nil {
+		return &types.Relation{}, err
+	}
+	return rel, nil
+}
+
+// link stores the relation, or updates the last seen timestamp of the relation already stored.
+func (sql *sqlRepository) link(source *types.Asset, relation string, destination *types.Asset) (*types.Relation, error) {
+	// ensure that duplicate relationships are not entered into the database
+	if rel, found := sql.isDuplicateRelation(source, relation, destination); found {
+		return rel, nil
+	}
+
+	fromAssetId, err := strconv.ParseUint(source.ID, 10, 64)
+	if err != nil {
+		return &types.Relation{}, err
+	}
+
+	toAssetId, err := strconv.ParseUint(destination.ID, 10, 64)
+	if err != nil {
+		return &types.Relation{}, err
+	}
+
+	r := Relation{
+		Type:        relation,
+		FromAssetID: fromAssetId,
+		ToAssetID:   toAssetId,
+	}
+	if sql.clock != nil {
+		r.CreatedAt = sql.now()
+		r.LastSeen = r.CreatedAt
+	}
+
+	result := sql.db.Clauses(relationConflict).Create(&r)
+	if result.Error != nil {
+		return &types.Relation{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// a concurrent writer stored the relation after the lookup above
+		if rel, found := sql.isDuplicateRelation(source, relation, destination); found {
+			return rel, nil
+		}
+		return &types.Relation{}, fmt.Errorf("failed to link %s -%s-> %s", source.ID, relation, destination.ID)
 	}
 
-	fromAssetId, err := strconv.ParseUint(source.ID, 10, 64)
+	return toRelation(r), nil
+}
+
+// relationConflict leaves an insert without effect when the relation is already stored, as the unique index on
+// the assets and type of each relation guarantees, so callers racing to store the same relation do not fail.
+var relationConflict = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "from_asset_id"}, {Name: "to_asset_id"}, {Name: "type"}},
+	DoNothing: true,
+}
+
+// ImportRelation creates the provided relation in the database while preserving its CreatedAt and LastSeen timestamps.
+// The FromAsset and ToAsset IDs must reference assets already stored in this database.
+// If the relation already exists, the earliest CreatedAt and the latest LastSeen of the two are kept,
+// along with the Confidence of the latest observation.
+// Returns the stored relation as a types.Relation or an error if the import fails.
+func (sql *sqlRepository) ImportRelation(rel *types.Relation) (*types.Relation, error) {
+	fromAssetId, err := strconv.ParseUint(rel.FromAsset.ID, 10, 64)
 	if err != nil {
 		return &types.Relation{}, err
 	}
 
-	toAssetId, err := strconv.ParseUint(destination.ID, 10, 64)
+	toAssetId, err := strconv.ParseUint(rel.ToAsset.ID, 10, 64)
 	if err != nil {
 		return &types.Relation{}, err
 	}
 
 	r := Relation{
-		Type:        relation,
+		CreatedAt:   rel.CreatedAt,
+		LastSeen:    rel.LastSeen,
+		Type:        rel.Type,
+		Confidence:  rel.Confidence,
+		Weight:      rel.Weight,
 		FromAssetID: fromAssetId,
 		ToAssetID:   toAssetId,
 	}
 
-	result := sql.db.Create(&r)
+	// ensure that duplicate relationships are not entered into the database
+	var dups []Relation
+	result := sql.db.Where("from_asset_id = ? AND to_asset_id = ? AND type = ?", fromAssetId, toAssetId, rel.Type).Limit(1).Find(&dups)
+	if result.Error != nil {
+		return &types.Relation{}, result.Error
+	}
+	if len(dups) > 0 {
+		dup := dups[0]
+
+		r.ID = dup.ID
+		if r.CreatedAt.IsZero() || dup.CreatedAt.Before(r.CreatedAt) {
+			r.CreatedAt = dup.CreatedAt
+		}
+		if dup.LastSeen.After(r.LastSeen) {
+			r.LastSeen = dup.LastSeen
+			r.Confidence = dup.Confidence
+		}
+		if r.Weight == nil {
+			r.Weight = dup.Weight
+		}
+	}
+
+	result = sql.db.Save(&r)
 	if result.Error != nil {
 		return &types.Relation{}, result.Error
 	}
@@ -353,26 +1447,138 @@ func (sql *sqlRepository) Link(source *types.Asset, relation string, destination
 	return toRelation(r), nil
 }
 
+// ReplaceOutgoingRelations replaces the outgoing relations of the relation type from the source asset with relations to the destinations.
+// Within a single transaction, relations to assets missing from the destinations are removed, the last seen timestamp is updated
+// for the relations that remain, and relations to the new destinations are created.
+// A relation type set by WithSymmetricRelations has its reverse rows replaced in the same way, so both directions remain stored.
+// Returns an error if a relation is not valid in the taxonomy or the replacement fails, in which case no relations are changed.
+func (sql *sqlRepository) ReplaceOutgoingRelations(source *types.Asset, relationType string, destinations []*types.Asset) error {
+	fromAssetId, err := strconv.ParseUint(source.ID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	var toAssetIds []uint64
+	srctype := source.Asset.AssetType()
+	_, symmetric := sql.symmetric[relationType]
+	for _, dest := range destinations {
+		// check that each link will create a valid relationship within the taxonomy
+		destype := dest.Asset.AssetType()
+		if !oam.ValidRelationship(srctype, relationType, destype) {
+			return fmt.Errorf("%s -%s-> %s is not valid in the taxonomy", srctype, relationType, destype)
+		}
+		if symmetric && !oam.ValidRelationship(destype, relationType, srctype) {
+			return fmt.Errorf("the symmetric relation %s -%s-> %s is not valid in the taxonomy", destype, relationType, srctype)
+		}
+
+		id, err := strconv.ParseUint(dest.ID, 10, 64)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(toAssetIds, id) {
+			toAssetIds = append(toAssetIds, id)
+		}
+	}
+
+	return sql.db.Transaction(func(tx *gorm.DB) error {
+		if err := sql.replaceRelations(tx, fromAssetId, relationType, toAssetIds, false); err != nil || !symmetric {
+			return err
+		}
+		return sql.replaceRelations(tx, fromAssetId, relationType, toAssetIds, true)
+	})
+}
+
+// replaceRelations replaces the relations of the relation type from the asset with relations to the other assets within the transaction,
+// or the relations of the type from the other assets to the asset when reverse is true.
+func (sql *sqlRepository) replaceRelations(tx *gorm.DB, assetId uint64, relationType string, others []uint64, reverse bool) error {
+	own, other := "from_asset_id", "to_asset_id"
+	if reverse {
+		own, other = other, own
+	}
+
+	stale := tx.Where(own+" = ? AND type = ?", assetId, relationType)
+	if len(others) > 0 {
+		stale = stale.Where(other+" NOT IN ?", others)
+	}
+	// the query is reused by both removals, so it is made safe to chain
+	stale = stale.Session(&gorm.Session{})
+	if err := deleteRelationSources(tx, stale); err != nil {
+		return err
+	}
+	if err := stale.Delete(&Relation{}).Error; err != nil {
+		return err
+	}
+	if len(others) == 0 {
+		return nil
+	}
+
+	var existing []uint64
+	if err := tx.Model(&Relation{}).Where(own+" = ? AND type = ?", assetId, relationType).Pluck(other, &existing).Error; err != nil {
+		return err
+	}
+
+	if len(existing) > 0 {
+		var result *gorm.DB
+		if sql.clock != nil {
+			result = tx.Exec("UPDATE relations SET last_seen = ? WHERE "+own+" = ? AND type = ?", sql.now(), assetId, relationType)
+		} else {
+			result = tx.Exec("UPDATE relations SET last_seen = current_timestamp WHERE "+own+" = ? AND type = ?", assetId, relationType)
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+
+	for _, otherId := range others {
+		if slices.Contains(existing, otherId) {
+			continue
+		}
+
+		r := Relation{
+			Type:        relationType,
+			FromAssetID: assetId,
+			ToAssetID:   otherId,
+		}
+		if reverse {
+			r.FromAssetID, r.ToAssetID = otherId, assetId
+		}
+		if sql.clock != nil {
+			r.CreatedAt = sql.now()
+			r.LastSeen = r.CreatedAt
+		}
+		if err := tx.Clauses(relationConflict).Create(&r).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // isDuplicateRelation checks if the relationship between source and dest already exists.
+// The stored row is looked up by its assets and type, so the other relations of the source are not loaded.
 func (sql *sqlRepository) isDuplicateRelation(source *types.Asset, relation string, dest *types.Asset) (*types.Relation, bool) {
-	var dup bool
-	var rel *types.Relation
+	fromAssetId, err := strconv.ParseUint(source.ID, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	toAssetId, err := strconv.ParseUint(dest.ID, 10, 64)
+	if err != nil {
+		return nil, false
+	}
 
-	if outs, err := sql.OutgoingRelations(source, time.Time{}, relation); err == nil {
-		for _, out := range outs {
-			if dest.ID == out.ToAsset.ID {
-				_ = sql.relationSeen(out)
-				rel, err = sql.relationById(out.ID)
-				if err != nil {
-					log.Println("[ERROR] failed when re-retrieving relation", err)
-					return nil, false
-				}
-				dup = true
-				break
-			}
-		}
+	var stored []Relation
+	if err := sql.db.Where("from_asset_id = ? AND to_asset_id = ? AND type = ?",
+		fromAssetId, toAssetId, relation).Limit(1).Find(&stored).Error; err != nil || len(stored) == 0 {
+		return nil, false
 	}
-	return rel, dup
+
+	id := strconv.FormatUint(stored[0].ID, 10)
+	_ = sql.relationSeen(&types.Relation{ID: id})
+	rel, err := sql.relationById(id)
+	if err != nil {
+		log.Println("[ERROR] failed when re-retrieving relation", err)
+		return nil, false
+	}
+	return rel, true
 }
 
 // updateRelationLastSeen updates the last seen timestamp for the specified relation.
@@ -382,7 +1588,12 @@ func (sql *sqlRepository) relationSeen(rel *types.Relation) error {
 		return fmt.Errorf("failed to update last seen for ID %s could not parse id; err: %w", rel.ID, err)
 	}
 
-	result := sql.db.Exec("UPDATE relations SET last_seen = current_timestamp WHERE id = ?", id)
+	var result *gorm.DB
+	if sql.clock != nil {
+		result = sql.db.Exec("UPDATE relations SET last_seen = ? WHERE id = ?", sql.now(), id)
+	} else {
+		result = sql.db.Exec("UPDATE relations SET last_seen = current_timestamp WHERE id = ?", id)
+	}
 	if result.Error != nil {
 		return result.Error
 	}
@@ -390,56 +1601,182 @@ func (sql *sqlRepository) relationSeen(rel *types.Relation) error {
 	return nil
 }
 
-// IncomingRelations finds all relations pointing to the asset of the specified relation types and last seen after the since parameter.
+// IncomingRelations finds all relations pointing to the asset of the specified relation types and last seen at or after the since parameter.
 // If since.IsZero(), the parameter will be ignored.
 // If no relationTypes are specified, all outgoing relations are returned.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
 func (sql *sqlRepository) IncomingRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, error) {
+	return sql.IncomingRelationsFrom(asset, since, "", relationTypes...)
+}
+
+// IncomingRelationsFrom finds all relations pointing to the asset of the specified relation types,
+// originating from assets of the fromType, and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// If fromType is empty, relations originating from assets of any type are returned.
+// If no relationTypes are specified, all incoming relations are returned.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
+func (sql *sqlRepository) IncomingRelationsFrom(asset *types.Asset, since time.Time, fromType oam.AssetType, relationTypes ...string) ([]*types.Relation, error) {
 	assetId, err := strconv.ParseInt(asset.ID, 10, 64)
 	if err != nil {
 		return nil, err
 	}
 
-	relations := []Relation{}
+	return sql.orderedRelations(incomingRelationsQuery(sql.db, assetId, fromType, relationTypes), since, Order{})
+}
+
+// incomingRelationsQuery builds the query for relations pointing to the asset identified by assetId.
+// The relation types are matched with a single IN predicate, and the source asset type is
+// matched by joining the assets table on the from_asset_id column.
+func incomingRelationsQuery(tx *gorm.DB, assetId int64, fromType oam.AssetType, relationTypes []string) *gorm.DB {
+	tx = tx.Where("relations.to_asset_id = ?", assetId)
 	if len(relationTypes) > 0 {
-		res := sql.db.Where("to_asset_id = ? AND type IN ?", assetId, relationTypes).Find(&relations)
-		if res.Error != nil {
-			return nil, res.Error
-		}
-	} else {
-		res := sql.db.Where("to_asset_id = ?", assetId).Find(&relations)
-		if res.Error != nil {
-			return nil, res.Error
-		}
+		tx = tx.Where("relations.type IN ?", relationTypes)
 	}
-
-	return toRelations(relations), nil
+	if fromType != "" {
+		tx = tx.Joins("JOIN assets ON assets.id = relations.from_asset_id").Where("assets.type = ?", fromType)
+	}
+	return tx
 }
 
-// OutgoingRelations finds all relations from the asset of the specified relation types and last seen after the since parameter.
+// OutgoingRelations finds all relations from the asset of the specified relation types and last seen at or after the since parameter.
 // If since.IsZero(), the parameter will be ignored.
 // If no relationTypes are specified, all outgoing relations are returned.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
 func (sql *sqlRepository) OutgoingRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, error) {
+	return sql.OutgoingRelationsOrdered(asset, since, Order{}, relationTypes...)
+}
+
+// IncomingRelationsOrdered finds all relations pointing to the asset of the specified relation types and last seen at or after the since parameter,
+// ordered as described by the order parameter. Relations cannot be ordered by their key field.
+// If since.IsZero(), the parameter will be ignored.
+// If no relationTypes are specified, all incoming relations are returned.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
+func (sql *sqlRepository) IncomingRelationsOrdered(asset *types.Asset, since time.Time, order Order, relationTypes ...string) ([]*types.Relation, error) {
 	assetId, err := strconv.ParseInt(asset.ID, 10, 64)
 	if err != nil {
 		return nil, err
 	}
 
-	relations := []Relation{}
+	return sql.orderedRelations(incomingRelationsQuery(sql.db, assetId, "", relationTypes), since, order)
+}
+
+// OutgoingRelationsOrdered finds all relations from the asset of the specified relation types and last seen at or after the since parameter,
+// ordered as described by the order parameter. Relations cannot be ordered by their key field.
+// If since.IsZero(), the parameter will be ignored.
+// If no relationTypes are specified, all outgoing relations are returned.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
+func (sql *sqlRepository) OutgoingRelationsOrdered(asset *types.Asset, since time.Time, order Order, relationTypes ...string) ([]*types.Relation, error) {
+	assetId, err := strconv.ParseInt(asset.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := sql.db.Where("relations.from_asset_id = ?", assetId)
 	if len(relationTypes) > 0 {
-		res := sql.db.Where("from_asset_id = ? AND type IN ?", assetId, relationTypes).Find(&relations)
-		if res.Error != nil {
-			return nil, res.Error
-		}
-	} else {
-		res := sql.db.Where("from_asset_id = ?", assetId).Find(&relations)
-		if res.Error != nil {
-			return nil, res.Error
+		tx = tx.Where("relations.type IN ?", relationTypes)
+	}
+	return sql.orderedRelations(tx, since, order)
+}
+
+// AllRelations finds all relations from or pointing to the asset of the specified relation types and last seen at or after the since parameter,
+// using a single query ordered by the relation ID. The direction of each relation relative to the asset is returned at the same index,
+// and a relation linking the asset to itself is returned once as outgoing.
+// If since.IsZero(), the parameter will be ignored.
+// If no relationTypes are specified, all relations are returned.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
+func (sql *sqlRepository) AllRelations(asset *types.Asset, since time.Time, relationTypes ...string) ([]*types.Relation, []types.Direction, error) {
+	assetId, err := strconv.ParseInt(asset.ID, 10, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx := sql.db.Where("(relations.from_asset_id = ? OR relations.to_asset_id = ?)", assetId, assetId)
+	if len(relationTypes) > 0 {
+		tx = tx.Where("relations.type IN ?", relationTypes)
+	}
+
+	relations, err := sql.orderedRelations(tx, since, Order{Field: OrderByID})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	directions := make([]types.Direction, 0, len(relations))
+	for _, rel := range relations {
+		if rel.FromAsset.ID == asset.ID {
+			directions = append(directions, types.Outgoing)
+		} else {
+			directions = append(directions, types.Incoming)
 		}
 	}
+	return relations, directions, nil
+}
+
+// orderedRelations finds the relations matching the query and last seen at or after the since parameter, ordered as described by the order parameter.
+func (sql *sqlRepository) orderedRelations(tx *gorm.DB, since time.Time, order Order) ([]*types.Relation, error) {
+	if !since.IsZero() {
+		tx = tx.Where("relations.last_seen >= ?", sql.sinceArg(since))
+	}
+
+	tx, err := order.apply(tx, "relations", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	relations := []Relation{}
+	if err := findAll(sql, tx, &relations); err != nil {
+		return nil, err
+	}
+	return toRelations(relations), nil
+}
+
+// IncomingRelationsCreated finds all relations pointing to the asset of the specified relation types
+// that were created within the window starting at start and ending before end.
+// If start.IsZero() or end.IsZero(), the respective bound will be ignored.
+// If no relationTypes are specified, all incoming relations created within the window are returned.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
+func (sql *sqlRepository) IncomingRelationsCreated(asset *types.Asset, start, end time.Time, relationTypes ...string) ([]*types.Relation, error) {
+	return sql.relationsCreated("to_asset_id", asset, start, end, relationTypes)
+}
+
+// OutgoingRelationsCreated finds all relations from the asset of the specified relation types
+// that were created within the window starting at start and ending before end.
+// If start.IsZero() or end.IsZero(), the respective bound will be ignored.
+// If no relationTypes are specified, all outgoing relations created within the window are returned.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
+func (sql *sqlRepository) OutgoingRelationsCreated(asset *types.Asset, start, end time.Time, relationTypes ...string) ([]*types.Relation, error) {
+	return sql.relationsCreated("from_asset_id", asset, start, end, relationTypes)
+}
+
+func (sql *sqlRepository) relationsCreated(column string, asset *types.Asset, start, end time.Time, relationTypes []string) ([]*types.Relation, error) {
+	assetId, err := strconv.ParseInt(asset.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	relations := []Relation{}
+	if err := findAll(sql, sql.relationsCreatedQuery(sql.db, column, assetId, start, end, relationTypes), &relations); err != nil {
+		return nil, err
+	}
 
 	return toRelations(relations), nil
 }
 
+// relationsCreatedQuery builds the query for relations with the asset identified by assetId in the provided
+// column, filtered on the relations.created_at column.
+func (sql *sqlRepository) relationsCreatedQuery(tx *gorm.DB, column string, assetId int64, start, end time.Time, relationTypes []string) *gorm.DB {
+	tx = tx.Where("relations."+column+" = ?", assetId)
+	if len(relationTypes) > 0 {
+		tx = tx.Where("relations.type IN ?", relationTypes)
+	}
+	if !start.IsZero() {
+		tx = tx.Where("relations.created_at >= ?", sql.sinceArg(start))
+	}
+	if !end.IsZero() {
+		tx = tx.Where("relations.created_at < ?", sql.sinceArg(end))
+	}
+	return tx
+}
+
 func (sql *sqlRepository) relationById(id string) (*types.Relation, error) {
 	rel := Relation{}
 
@@ -454,9 +1791,12 @@ func (sql *sqlRepository) relationById(id string) (*types.Relation, error) {
 // toRelation converts a database Relation to a types.Relation.
 func toRelation(r Relation) *types.Relation {
 	rel := &types.Relation{
-		ID:       strconv.FormatUint(r.ID, 10),
-		Type:     r.Type,
-		LastSeen: r.LastSeen,
+		ID:         strconv.FormatUint(r.ID, 10),
+		Type:       r.Type,
+		CreatedAt:  r.CreatedAt,
+		LastSeen:   r.LastSeen,
+		Confidence: r.Confidence,
+		Weight:     r.Weight,
 		FromAsset: &types.Asset{
 			ID: strconv.FormatUint(r.FromAssetID, 10),
 			// Not joining to Asset to get Content
@@ -491,16 +1831,19 @@ func (sql *sqlRepository) RawQuery(sqlstr string, results interface{}) error {
 // AssetQuery creates a query and returns the slice of Assets found.
 // The query will start with "SELECT assets.id, assets.create_at, assets.last_seen, assets.type, assets.content FROM "
 // and then add the provided constraints. The query much include the assets table and remain named assets for parsing.
-func (sql *sqlRepository) AssetQuery(constraints string) ([]*types.Asset, error) {
+// The args are passed to the driver as bind parameters for the placeholders in the constraints.
+// Interpolating untrusted input into the constraints string is unsafe; use placeholders and args instead.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+func (sql *sqlRepository) AssetQuery(constraints string, args ...interface{}) ([]*types.Asset, error) {
 	var ga []Asset
 
 	if constraints == "" {
 		constraints = "assets"
 	}
 
-	result := sql.db.Raw("SELECT assets.id, assets.created_at, assets.last_seen, assets.type, assets.content FROM " + constraints).Scan(&ga)
-	if result.Error != nil {
-		return nil, result.Error
+	tx := sql.db.Raw("SELECT assets.id, assets.created_at, assets.last_seen, assets.type, assets.content FROM "+constraints, args...)
+	if err := findAll(sql, tx, &ga); err != nil {
+		return nil, err
 	}
 
 	var assets []*types.Asset
@@ -512,6 +1855,188 @@ func (sql *sqlRepository) AssetQuery(constraints string) ([]*types.Asset, error)
 	return assets, nil
 }
 
+// RawAssetQuery executes the provided SQL statement with args passed as bind parameters,
+// and returns the selected rows of the assets table parsed into Assets.
+// The statement must select the id, created_at, last_seen, type, and content columns of the assets table.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns an error if the query fails or a row cannot be parsed.
+func (sql *sqlRepository) RawAssetQuery(sqlstr string, args ...interface{}) ([]*types.Asset, error) {
+	var ga []Asset
+
+	if err := findAll(sql, sql.db.Raw(sqlstr, args...), &ga); err != nil {
+		return nil, err
+	}
+
+	var assets []*types.Asset
+	for _, a := range ga {
+		asset, err := sql.gormAssetToAsset(&a)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	return assets, nil
+}
+
+// AssetRowsAfter returns up to limit asset rows with an ID greater than the provided id, ordered by ID.
+// The rows are returned as stored, including those with content that fails to parse,
+// so callers paging through the table can advance past every row.
+func (sql *sqlRepository) AssetRowsAfter(id uint64, limit int) ([]Asset, error) {
+	var assets []Asset
+
+	if err := sql.db.Where("id > ?", id).Order("id").Limit(limit).Find(&assets).Error; err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+// RelationRowsAfter returns up to limit relation rows with an ID greater than the provided id, ordered by ID.
+// The rows are returned as stored, without loading the assets they reference.
+func (sql *sqlRepository) RelationRowsAfter(id uint64, limit int) ([]Relation, error) {
+	var relations []Relation
+
+	if err := sql.db.Where("id > ?", id).Order("id").Limit(limit).Find(&relations).Error; err != nil {
+		return nil, err
+	}
+	return relations, nil
+}
+
+// ForEachRelation calls fn with each relation of the provided type last seen at or after the since parameter, ordered by ID.
+// The relations are loaded in batches along with the assets at both ends, so the whole table is never held in memory.
+// If relationType is empty, relations of every type are visited. If since.IsZero(), the parameter will be ignored.
+// The iteration stops at the first error returned by fn, and that error is returned.
+func (sql *sqlRepository) ForEachRelation(relationType string, since time.Time, fn func(*types.Relation) error) error {
+	tx := sql.db.Preload("FromAsset").Preload("ToAsset")
+	if relationType != "" {
+		tx = tx.Where("type = ?", relationType)
+	}
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var relations []Relation
+	result := tx.FindInBatches(&relations, sql.batch(), func(_ *gorm.DB, _ int) error {
+		for _, r := range relations {
+			rel, err := sql.preloadedRelation(r)
+			if err != nil {
+				return err
+			}
+			if err := fn(rel); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return result.Error
+}
+
+// RelationsBetween finds the relations linking the two assets in either direction and last seen at or after the since parameter,
+// ordered by ID and with the assets at both ends loaded.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
+// Returns the relations, which are empty when the assets are not linked, or an error if the search fails.
+func (sql *sqlRepository) RelationsBetween(idA, idB string, since time.Time) ([]*types.Relation, error) {
+	a, err := strconv.ParseUint(idA, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	b, err := strconv.ParseUint(idB, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := sql.db.Preload("FromAsset").Preload("ToAsset").
+		Where("(from_asset_id = ? AND to_asset_id = ?) OR (from_asset_id = ? AND to_asset_id = ?)", a, b, b, a)
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var relations []Relation
+	if err := findAll(sql, tx.Order("id"), &relations); err != nil {
+		return nil, err
+	}
+
+	results := []*types.Relation{}
+	for _, r := range relations {
+		rel, err := sql.preloadedRelation(r)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rel)
+	}
+	return results, nil
+}
+
+// RelationsAmong finds the relations with either end among the assets with the provided IDs and last seen at or after
+// the since parameter, ordered by ID and with the assets at both ends loaded, such as to export the subgraph around a set of assets.
+// The IDs are matched in batches, and each relation is returned once, even when both ends are among the assets.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
+// Returns the relations, which are empty when no IDs are provided, or an error if an ID is not valid or the search fails.
+func (sql *sqlRepository) RelationsAmong(ids []string, since time.Time) ([]*types.Relation, error) {
+	assetIds := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		assetId, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		assetIds = append(assetIds, assetId)
+	}
+
+	// each batch binds the IDs twice
+	seen := make(map[uint64]struct{})
+	var relations []Relation
+	for batch := range slices.Chunk(assetIds, max(1, sql.batch()/2)) {
+		tx := sql.db.Preload("FromAsset").Preload("ToAsset").Where("from_asset_id IN ? OR to_asset_id IN ?", batch, batch)
+		if !since.IsZero() {
+			tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+		}
+
+		var found []Relation
+		if err := findAll(sql, tx, &found); err != nil {
+			return nil, err
+		}
+		for _, r := range found {
+			if _, dup := seen[r.ID]; !dup {
+				seen[r.ID] = struct{}{}
+				relations = append(relations, r)
+			}
+		}
+		// each batch is limited on its own, so the relations gathered across the batches are checked as well
+		if sql.maxResults > 0 && len(relations) > sql.maxResults {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrResultSetTooLarge, sql.maxResults)
+		}
+	}
+	slices.SortFunc(relations, func(a, b Relation) int { return cmp.Compare(a.ID, b.ID) })
+
+	results := []*types.Relation{}
+	for _, r := range relations {
+		rel, err := sql.preloadedRelation(r)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rel)
+	}
+	return results, nil
+}
+
+// preloadedRelation converts a database Relation loaded with the assets at both ends to a types.Relation holding the parsed assets.
+func (sql *sqlRepository) preloadedRelation(r Relation) (*types.Relation, error) {
+	from, err := sql.gormAssetToAsset(&r.FromAsset)
+	if err != nil {
+		return nil, err
+	}
+	to, err := sql.gormAssetToAsset(&r.ToAsset)
+	if err != nil {
+		return nil, err
+	}
+
+	rel := toRelation(r)
+	rel.FromAsset = from
+	rel.ToAsset = to
+	return rel, nil
+}
+
 func (sql *sqlRepository) gormAssetToAsset(ga *Asset) (*types.Asset, error) {
 	asset, err := ga.Parse()
 	if err != nil {
@@ -519,31 +2044,61 @@ func (sql *sqlRepository) gormAssetToAsset(ga *Asset) (*types.Asset, error) {
 	}
 
 	return &types.Asset{
-		ID:        strconv.FormatUint(ga.ID, 10),
-		CreatedAt: ga.CreatedAt,
-		LastSeen:  ga.LastSeen,
-		Asset:     asset,
+		ID:         strconv.FormatUint(ga.ID, 10),
+		CreatedAt:  ga.CreatedAt,
+		LastSeen:   ga.LastSeen,
+		ExternalID: ga.ExternalIDValue(),
+		Asset:      asset,
 	}, nil
 }
 
 // RelationQuery creates a query and returns the slice of Relations found. The query will start with:
-// "SELECT relations.id, relations.create_at, relations.last_seen, relations.type, relations.from_asset_id, relations.to_asset_id FROM "
+// "SELECT relations.id, relations.create_at, relations.last_seen, relations.type, relations.confidence, relations.weight, relations.from_asset_id, relations.to_asset_id FROM "
 // and then add the provided constraints. The query much include the relations table and remain named relations for parsing.
-func (sql *sqlRepository) RelationQuery(constraints string) ([]*types.Relation, error) {
-	var rs []*Relation
+// The args are passed to the driver as bind parameters for the placeholders in the constraints.
+// Interpolating untrusted input into the constraints string is unsafe; use placeholders and args instead.
+// The FromAsset and ToAsset of each relation hold the parsed assets, and relations referencing an asset
+// with content that fails to parse are left out of the results.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
+func (sql *sqlRepository) RelationQuery(constraints string, args ...interface{}) ([]*types.Relation, error) {
+	if constraints == "" {
+		constraints = "relations"
+	}
+
+	return sql.relationQuery(sql.db.Raw(relationQuerySelect+constraints, args...))
+}
 
+// RelationQueryWithLimit runs the query built by RelationQuery and returns at most limit relations,
+// so constraints missing a join condition cannot return every combination of the joined rows.
+// The query is wrapped in a subquery with the LIMIT clause, which keeps any ordering or limit within the constraints.
+// The database stops reading once the limit is reached, unless the constraints order or group the rows.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
+// Returns an error if the limit is not positive or the query fails.
+func (sql *sqlRepository) RelationQueryWithLimit(constraints string, limit int, args ...interface{}) ([]*types.Relation, error) {
+	if limit <= 0 {
+		return nil, errors.New("the limit must be positive")
+	}
 	if constraints == "" {
 		constraints = "relations"
 	}
 
-	result := sql.db.Raw("SELECT relations.id, relations.created_at, relations.last_seen, relations.type, relations.from_asset_id, relations.to_asset_id FROM " + constraints).Scan(&rs)
-	if result.Error != nil {
-		return nil, result.Error
+	args = append(slices.Clone(args), limit)
+	return sql.relationQuery(sql.db.Raw("SELECT * FROM ("+relationQuerySelect+constraints+") AS limited LIMIT ?", args...))
+}
+
+// relationQuerySelect is the start of the queries built by RelationQuery from the provided constraints.
+const relationQuerySelect = "SELECT relations.id, relations.created_at, relations.last_seen, relations.type, relations.confidence, relations.weight, relations.from_asset_id, relations.to_asset_id FROM "
+
+// relationQuery runs the query selecting relation rows and returns the relations whose assets parse.
+func (sql *sqlRepository) relationQuery(tx *gorm.DB) ([]*types.Relation, error) {
+	var rs []Relation
+	if err := findAll(sql, tx, &rs); err != nil {
+		return nil, err
 	}
 
 	var relations []*types.Relation
-	for _, r := range rs {
-		if relation, err := sql.gormRelationToRelation(r); err == nil {
+	for i := range rs {
+		if relation, err := sql.gormRelationToRelation(&rs[i]); err == nil {
 			relations = append(relations, relation)
 		}
 	}
@@ -561,11 +2116,13 @@ func (sql *sqlRepository) gormRelationToRelation(gr *Relation) (*types.Relation,
 	}
 
 	return &types.Relation{
-		ID:        strconv.FormatUint(gr.ID, 10),
-		CreatedAt: gr.CreatedAt,
-		LastSeen:  gr.LastSeen,
-		Type:      gr.Type,
-		FromAsset: fromasset,
-		ToAsset:   toasset,
+		ID:         strconv.FormatUint(gr.ID, 10),
+		CreatedAt:  gr.CreatedAt,
+		LastSeen:   gr.LastSeen,
+		Type:       gr.Type,
+		Confidence: gr.Confidence,
+		Weight:     gr.Weight,
+		FromAsset:  fromasset,
+		ToAsset:    toasset,
 	}, nil
 }
@@ -0,0 +1,63 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	"github.com/owasp-amass/open-asset-model/network"
+)
+
+// FindAssetsInAS finds the IP addresses attributed to the autonomous system with the provided number and last seen
+// at or after the since parameter, by following the announces relations from the autonomous system to its netblocks
+// and the contains relations from the netblocks to the IP addresses.
+// The hops are joined by nested subqueries, so the search is performed by a single query.
+// Each IP address is returned once, however many announced netblocks contain it.
+// If since.IsZero(), the parameter will be ignored, and otherwise the relations followed must also be last seen since then.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns the IP addresses ordered by ID, or an error if the search fails.
+func (sql *sqlRepository) FindAssetsInAS(asn int, since time.Time) ([]*types.Asset, error) {
+	query, err := contentQuery(sql.normalize(&network.AutonomousSystem{Number: asn}))
+	if err != nil {
+		return nil, err
+	}
+	systems := sql.db.Model(&Asset{}).Select("assets.id").Where("assets.type = ?", oam.AutonomousSystem).Where(query)
+
+	announced := sql.db.Model(&Relation{}).Select("relations.to_asset_id").
+		Where("relations.type = ? AND relations.from_asset_id IN (?)", "announces", systems)
+	if !since.IsZero() {
+		announced = announced.Where("relations.last_seen >= ?", sql.sinceArg(since))
+	}
+	netblocks := sql.db.Model(&Asset{}).Select("assets.id").
+		Where("assets.type = ? AND assets.id IN (?)", oam.Netblock, announced)
+
+	contained := sql.db.Model(&Relation{}).Select("relations.to_asset_id").
+		Where("relations.type = ? AND relations.from_asset_id IN (?)", "contains", netblocks)
+	if !since.IsZero() {
+		contained = contained.Where("relations.last_seen >= ?", sql.sinceArg(since))
+	}
+
+	tx := sql.db.Model(&Asset{}).Where("assets.type = ? AND assets.id IN (?)", oam.IPAddress, contained)
+	if !since.IsZero() {
+		tx = tx.Where("assets.last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var assets []Asset
+	if err := findAll(sql, tx.Order("assets.id"), &assets); err != nil {
+		return nil, err
+	}
+
+	results := make([]*types.Asset, 0, len(assets))
+	for i := range assets {
+		a, err := sql.gormAssetToAsset(&assets[i])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, a)
+	}
+	return results, nil
+}
@@ -0,0 +1,94 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/owasp-amass/asset-db/types"
+)
+
+// ChangeChannel is the Postgres notification channel on which each inserted asset and relation is announced.
+const ChangeChannel = "asset_db_changes"
+
+// ChangeBuffer is the number of changes buffered for each listener.
+// Changes received while the buffer of a listener is full are dropped for that listener.
+const ChangeBuffer = 256
+
+// changePayload is the JSON payload of the notifications sent on the ChangeChannel.
+type changePayload struct {
+	Table string `json:"table"`
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+}
+
+// ListenChanges returns a channel that receives the assets and relations inserted into a Postgres database by any process.
+// The rows are announced on the ChangeChannel by triggers once their transaction commits, so the changes of the
+// transactions rolled back are never delivered. A connection is held for the listener until the context is done,
+// and the channel is closed once the context is done or the connection fails.
+// Up to ChangeBuffer changes are buffered; changes received while the buffer is full are dropped.
+// Returns an error if the database is not Postgres or the listener cannot be started.
+func (sql *sqlRepository) ListenChanges(ctx context.Context) (<-chan *types.Change, error) {
+	if sql.dbType != Postgres {
+		return nil, fmt.Errorf("change notifications are not supported by %s", sql.dbType)
+	}
+
+	sqlDB, err := sql.db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Raw(func(driverConn any) error {
+		if _, ok := driverConn.(*stdlib.Conn); !ok {
+			return errors.New("the Postgres driver does not support notifications")
+		}
+		return nil
+	}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "LISTEN "+ChangeChannel); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	ch := make(chan *types.Change, ChangeBuffer)
+	go func() {
+		defer close(ch)
+		defer func() { _ = conn.Close() }()
+
+		_ = conn.Raw(func(driverConn any) error {
+			pgConn := driverConn.(*stdlib.Conn).Conn()
+
+			for {
+				n, err := pgConn.WaitForNotification(ctx)
+				if err != nil {
+					// the connection is still listening, so it is discarded rather than returned to the pool
+					return driver.ErrBadConn
+				}
+
+				var p changePayload
+				if err := json.Unmarshal([]byte(n.Payload), &p); err != nil {
+					continue
+				}
+
+				select {
+				case ch <- &types.Change{Table: p.Table, ID: p.ID, Type: p.Type}:
+				default:
+				}
+			}
+		})
+	}()
+	return ch, nil
+}
@@ -0,0 +1,120 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+)
+
+// MaxClosureDepth is the largest number of hops FindTransitiveClosure follows.
+const MaxClosureDepth = 32
+
+// ErrTraversalTruncated is returned along with the partial result of a traversal, such as FindTransitiveClosure,
+// when it reaches more assets than the maximum set by WithMaxTraversalNodes.
+var ErrTraversalTruncated = errors.New("the traversal reached the maximum number of assets")
+
+// FindTransitiveClosure finds the assets reached from the start asset by following the outgoing relations of the relation type,
+// repeatedly, for up to maxDepth hops, such as every FQDN found under an apex domain by following the node relations.
+// The closure is computed by the database with a single recursive query, and the relations must be last seen at or after
+// the since parameter. Each asset is returned once, however many paths reach it, and the start asset is not returned.
+// If since.IsZero(), the parameter will be ignored.
+// When the repository was created with WithMinTraversalWeight, only the relations with a weight at or above the minimum are followed.
+// When the repository was created with WithMaxTraversalNodes and more assets are reachable, the assets nearest to the start
+// asset are returned, up to the maximum, along with an error wrapping ErrTraversalTruncated. The recursive query then stops
+// once it has generated enough rows to reach one asset beyond the maximum, so the database does not compute the whole closure.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns the reachable assets ordered by ID, or an error if the depth is outside 1 to MaxClosureDepth or the query fails.
+func (sql *sqlRepository) FindTransitiveClosure(start *types.Asset, relationType string, maxDepth int, since time.Time) ([]*types.Asset, error) {
+	if maxDepth < 1 || maxDepth > MaxClosureDepth {
+		return nil, fmt.Errorf("the depth must be between 1 and %d", MaxClosureDepth)
+	}
+
+	id, err := strconv.ParseUint(start.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter string
+	var filterArgs []interface{}
+	if !since.IsZero() {
+		filter = " AND relations.last_seen >= ?"
+		filterArgs = []interface{}{sql.sinceArg(since)}
+	}
+	if sql.minWeight != nil {
+		filter += " AND relations.weight >= ?"
+		filterArgs = append(filterArgs, *sql.minWeight)
+	}
+
+	// the reached pairs of asset and depth are distinct, so a cycle ends once the depth is exhausted
+	query := "WITH RECURSIVE reached(id, depth) AS (" +
+		"SELECT relations.to_asset_id, 1 FROM relations WHERE relations.from_asset_id = ? AND relations.type = ?" + filter +
+		" UNION SELECT relations.to_asset_id, reached.depth + 1 FROM relations JOIN reached ON relations.from_asset_id = reached.id" +
+		" WHERE reached.depth < ? AND relations.type = ?" + filter
+	// the rows are generated one depth after the other, and an asset is reached at most once per depth, so the first
+	// rows reach at least one asset beyond the maximum, other than the start asset, whenever the closure holds more
+	rows := (sql.maxTraversal + 2) * maxDepth
+	if sql.maxTraversal > 0 && sql.dbType != Postgres {
+		// SQLite stops the recursion once the limit of the recursive query is reached
+		query += " LIMIT ?"
+	}
+	query += ") "
+	if sql.maxTraversal > 0 {
+		// Postgres computes only the rows of the recursive query read by the limited subquery, and one asset beyond
+		// the maximum is loaded, so the truncation can be told apart from a closure of exactly the maximum
+		query += "SELECT assets.* FROM assets JOIN (SELECT id, MIN(depth) AS depth FROM (SELECT id, depth FROM reached LIMIT ?) AS bounded" +
+			" WHERE id <> ? GROUP BY id) AS nearest ON assets.id = nearest.id ORDER BY nearest.depth, assets.id LIMIT ?"
+	} else {
+		query += "SELECT * FROM assets WHERE id IN (SELECT id FROM reached) AND id <> ? ORDER BY id"
+	}
+
+	args := []interface{}{id, relationType}
+	args = append(args, filterArgs...)
+	args = append(args, maxDepth, relationType)
+	args = append(args, filterArgs...)
+	if sql.maxTraversal > 0 {
+		if sql.dbType != Postgres {
+			args = append(args, rows)
+		}
+		args = append(args, rows, id, sql.maxTraversal+1)
+	} else {
+		args = append(args, id)
+	}
+
+	var assets []Asset
+	if err := findAll(sql, sql.db.Raw(query, args...), &assets); err != nil {
+		return nil, err
+	}
+
+	var truncated bool
+	if sql.maxTraversal > 0 {
+		if len(assets) > sql.maxTraversal {
+			assets = assets[:sql.maxTraversal]
+			truncated = true
+		}
+		slices.SortFunc(assets, func(a, b Asset) int {
+			return cmp.Compare(a.ID, b.ID)
+		})
+	}
+
+	results := make([]*types.Asset, 0, len(assets))
+	for i := range assets {
+		a, err := sql.gormAssetToAsset(&assets[i])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, a)
+	}
+	if truncated {
+		return results, fmt.Errorf("%w: more than %d assets reached", ErrTraversalTruncated, sql.maxTraversal)
+	}
+	return results, nil
+}
@@ -0,0 +1,86 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	"gorm.io/datatypes"
+)
+
+// FindDuplicateAssets finds the assets of the provided type sharing their key field with other assets of the type,
+// such as rows stored without a hash before the upsert was introduced.
+// The key fields held by more than one asset are found with a GROUP BY on the key field extracted from the content,
+// and the assets holding them are read by the same query. Types identified by more than their key field, such as
+// TLS certificates and socket addresses, are grouped by the key field alone, so a group may hold distinct assets.
+// The organizations and persons are grouped regardless of case, as their names are matched.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns the groups of duplicates, each ordered by ID and the groups ordered by their lowest ID, or an error if the search fails.
+func (sql *sqlRepository) FindDuplicateAssets(atype oam.AssetType) ([][]*types.Asset, error) {
+	empty := &Asset{Type: string(atype), Content: datatypes.JSON("{}")}
+	a, err := empty.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	field, _, err := keyField(a)
+	if err != nil {
+		return nil, err
+	}
+
+	key, arg := "json_extract(content, ?)", interface{}("$."+field)
+	if sql.dbType == Postgres {
+		key, arg = "content -> ?::text", field
+	}
+	fold := caseInsensitive(atype)
+	if fold {
+		key, arg = "LOWER(content->>?)", field
+		if sql.dbType == Postgres {
+			key = "LOWER(content->>?::text)"
+		}
+	}
+
+	var assets []Asset
+	query := "SELECT * FROM assets WHERE type = ? AND " + key + " IN (SELECT " + key +
+		" FROM assets WHERE type = ? GROUP BY 1 HAVING COUNT(*) > 1) ORDER BY id"
+	if err := findAll(sql, sql.db.Raw(query, atype, arg, arg, atype), &assets); err != nil {
+		return nil, err
+	}
+
+	var order []string
+	groups := make(map[string][]*types.Asset)
+	for i := range assets {
+		parsed, err := sql.gormAssetToAsset(&assets[i])
+		if err != nil {
+			continue
+		}
+
+		_, value, err := keyField(parsed.Asset)
+		if err != nil {
+			continue
+		}
+
+		k := fmt.Sprint(value)
+		if fold {
+			k = strings.ToLower(k)
+		}
+		if _, found := groups[k]; !found {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], parsed)
+	}
+
+	results := [][]*types.Asset{}
+	for _, k := range order {
+		// the rows failing to parse may leave a single asset holding the key field
+		if len(groups[k]) > 1 {
+			results = append(results, groups[k])
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,125 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+)
+
+// MaxExpandDepth is the largest number of hops ExpandRelations follows, so an expansion cannot load the whole graph by accident.
+const MaxExpandDepth = 4
+
+// ExpandRelations follows the relations of the specified relation types in the direction provided, starting from the asset,
+// for up to depth hops, and returns the relations found at each hop, such as the outgoing relations of the asset followed by
+// the outgoing relations of its destinations. Each hop is read with a single query matching the assets reached by the previous hop
+// with an IN clause, split into batches of the size set by WithBatchSize, and with the assets of the relations preloaded.
+// Assets already reached are not followed again, so cycles end the expansion, and relations referencing an asset
+// with content that fails to parse are left out. The expansion ends early at a hop finding no relations.
+// If since.IsZero(), the parameter will be ignored. If no relationTypes are specified, relations of every type are followed.
+// When the repository was created with WithMinTraversalWeight, only the relations with a weight at or above the minimum are followed.
+// When the repository was created with WithMaxTraversalNodes, the relations leading to assets beyond the maximum are left out,
+// and the hops found so far are returned along with an error wrapping ErrTraversalTruncated.
+// Fails with ErrResultSetTooLarge when a hop finds more relations than the maximum set by WithMaxResults.
+// Returns the relations of each hop, ordered by ID, or an error if the depth is outside 1 to MaxExpandDepth or a query fails.
+func (sql *sqlRepository) ExpandRelations(asset *types.Asset, dir types.Direction, depth int, since time.Time, relationTypes ...string) ([][]*types.Relation, error) {
+	if depth < 1 || depth > MaxExpandDepth {
+		return nil, fmt.Errorf("the depth must be between 1 and %d", MaxExpandDepth)
+	}
+
+	column, next := "from_asset_id", func(r *types.Relation) string { return r.ToAsset.ID }
+	switch dir {
+	case types.Outgoing:
+	case types.Incoming:
+		column, next = "to_asset_id", func(r *types.Relation) string { return r.FromAsset.ID }
+	default:
+		return nil, fmt.Errorf("unknown direction: %q", dir)
+	}
+
+	start, err := strconv.ParseUint(asset.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	levels := [][]*types.Relation{}
+	frontier := []uint64{start}
+	visited := map[uint64]struct{}{start: {}}
+	for len(levels) < depth && len(frontier) > 0 {
+		var level []*types.Relation
+
+		for ids := range slices.Chunk(frontier, sql.batch()) {
+			found, err := sql.relationsFrom(column, ids, since, relationTypes)
+			if err != nil {
+				return nil, err
+			}
+			level = append(level, found...)
+		}
+		if len(level) == 0 {
+			break
+		}
+		slices.SortFunc(level, func(a, b *types.Relation) int {
+			return compareIDs(a.ID, b.ID)
+		})
+
+		frontier = nil
+		truncated := false
+		kept := level[:0]
+		for _, r := range level {
+			id, err := strconv.ParseUint(next(r), 10, 64)
+			if err != nil {
+				kept = append(kept, r)
+				continue
+			}
+			if _, found := visited[id]; !found {
+				// the visited set holds the start asset, which does not count toward the maximum
+				if sql.maxTraversal > 0 && len(visited) > sql.maxTraversal {
+					truncated = true
+					continue
+				}
+				visited[id] = struct{}{}
+				frontier = append(frontier, id)
+			}
+			kept = append(kept, r)
+		}
+		if len(kept) > 0 {
+			levels = append(levels, kept)
+		}
+		if truncated {
+			return levels, fmt.Errorf("%w: more than %d assets reached", ErrTraversalTruncated, sql.maxTraversal)
+		}
+	}
+	return levels, nil
+}
+
+// relationsFrom finds the relations referencing any of the assets in the column, with their assets preloaded.
+func (sql *sqlRepository) relationsFrom(column string, ids []uint64, since time.Time, relationTypes []string) ([]*types.Relation, error) {
+	tx := sql.db.Preload("FromAsset").Preload("ToAsset").Where(column+" IN ?", ids)
+	if len(relationTypes) > 0 {
+		tx = tx.Where("type IN ?", relationTypes)
+	}
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+	if sql.minWeight != nil {
+		tx = tx.Where("weight >= ?", *sql.minWeight)
+	}
+
+	var relations []Relation
+	if err := findAll(sql, tx, &relations); err != nil {
+		return nil, err
+	}
+
+	var results []*types.Relation
+	for _, r := range relations {
+		if rel, err := sql.preloadedRelation(r); err == nil {
+			results = append(results, rel)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,64 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// errExplainRollback rolls back the transaction used to analyze a statement on Postgres.
+var errExplainRollback = errors.New("rollback the analyzed statement")
+
+type planStep struct {
+	ID     int
+	Parent int
+	Detail string
+}
+
+// Explain returns the query plan of the provided sqlstr, with the args passed as bind parameters.
+// On Postgres, the statement is run with EXPLAIN ANALYZE within a transaction that is rolled back,
+// so the plan includes the actual timings without persisting the changes made by the statement.
+// On SQLite, the plan is returned by EXPLAIN QUERY PLAN, with each step indented below its parent.
+// Returns the plan text or an error if the statement cannot be explained.
+func (sql *sqlRepository) Explain(sqlstr string, args ...interface{}) (string, error) {
+	switch sql.dbType {
+	case Postgres:
+		var lines []string
+
+		err := sql.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Raw("EXPLAIN ANALYZE "+sqlstr, args...).Scan(&lines).Error; err != nil {
+				return err
+			}
+			return errExplainRollback
+		})
+		if err != nil && !errors.Is(err, errExplainRollback) {
+			return "", err
+		}
+		return strings.Join(lines, "\n"), nil
+	case SQLite:
+		var steps []planStep
+
+		if err := sql.db.Raw("EXPLAIN QUERY PLAN "+sqlstr, args...).Scan(&steps).Error; err != nil {
+			return "", err
+		}
+
+		depth := make(map[int]int)
+		lines := make([]string, 0, len(steps))
+		for _, step := range steps {
+			d := 0
+			if pd, found := depth[step.Parent]; found {
+				d = pd + 1
+			}
+			depth[step.ID] = d
+
+			lines = append(lines, strings.Repeat("  ", d)+step.Detail)
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	return "", errors.New("the database type does not support explaining queries")
+}
@@ -0,0 +1,74 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	"gorm.io/gorm"
+)
+
+// CreateAssetWithExternalID creates the asset in the database, as CreateAsset does, and assigns it the provided external ID,
+// the stable identifier given to the asset by an external system. External IDs are unique per asset type.
+// The asset and its external ID are stored within a single transaction, so neither is kept when storing the other fails.
+// Returns the created asset as a types.Asset, or an error if the creation fails, another asset of the type holds the external ID,
+// or the asset already holds a different external ID.
+func (sql *sqlRepository) CreateAssetWithExternalID(assetData oam.Asset, externalID string) (*types.Asset, error) {
+	if externalID == "" {
+		return nil, errors.New("no external ID provided")
+	}
+
+	var a *types.Asset
+	var created bool
+
+	err := sql.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+
+		a, created, err = sql.scoped(tx).createAsset(assetData)
+		if err != nil {
+			return err
+		}
+		if a.ExternalID == externalID {
+			return nil
+		}
+		if a.ExternalID != "" {
+			return fmt.Errorf("asset %s already holds the external ID %q", a.ID, a.ExternalID)
+		}
+
+		if err := tx.Model(&Asset{}).Where("id = ?", a.ID).Update("external_id", externalID).Error; err != nil {
+			return err
+		}
+		a.ExternalID = externalID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if created {
+		sql.notifyCreated(a)
+	}
+	return a, nil
+}
+
+// FindAssetByExternalID finds the asset of the provided type holding the external ID and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// Returns the found asset as a types.Asset or an error if the asset is not found.
+func (sql *sqlRepository) FindAssetByExternalID(atype oam.AssetType, externalID string, since time.Time) (*types.Asset, error) {
+	tx := sql.db.Where("type = ? AND external_id = ?", atype, externalID)
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var asset Asset
+	if err := tx.First(&asset).Error; err != nil {
+		return nil, err
+	}
+	return sql.gormAssetToAsset(&asset)
+}
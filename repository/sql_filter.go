@@ -0,0 +1,74 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+)
+
+// FilterOp represents the comparison made by a ContentFilter.
+type FilterOp string
+
+const (
+	// FilterEquals matches the assets holding the value in the field.
+	FilterEquals FilterOp = "="
+	// FilterLike matches the assets whose field matches the value as a LIKE pattern, such as "%.example.com".
+	FilterLike FilterOp = "LIKE"
+)
+
+// ContentFilter describes a condition on a single field of the content of the assets, named by its JSON key.
+type ContentFilter struct {
+	Field string   // The JSON key of the field, such as "name".
+	Op    FilterOp // The comparison made with the value.
+	Value string   // The value compared with the text of the field.
+}
+
+// FindAssetByTypeFiltered finds the assets of the provided type last seen at or after the since parameter whose content
+// matches the filter, such as the FQDNs with a name ending in ".example.com". The type and the filter are compiled into a single
+// WHERE clause, so only the matching assets are read. The text of the field is compared with the value as stored, and LIKE patterns
+// are matched case-sensitively on Postgres and case-insensitively for ASCII letters on SQLite.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns the matching assets ordered by ID, or an error if the type does not hold the field, the operator is not supported,
+// or the search fails.
+func (sql *sqlRepository) FindAssetByTypeFiltered(atype oam.AssetType, filter ContentFilter, since time.Time) ([]*types.Asset, error) {
+	if filter.Op != FilterEquals && filter.Op != FilterLike {
+		return nil, fmt.Errorf("the %q operator is not supported", filter.Op)
+	}
+
+	fields, err := contentFields(atype)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(fields, filter.Field) {
+		return nil, fmt.Errorf("the %s field is not held by a %s", filter.Field, atype)
+	}
+
+	// the field is one of the JSON names of the type and the operator is one of the constants, so both are safe to place within the statement
+	tx := sql.db.Where("type = ?", atype).Where(fmt.Sprintf("content->>'%s' %s ?", filter.Field, filter.Op), filter.Value)
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var assets []Asset
+	if err := findAll(sql, tx.Order("id"), &assets); err != nil {
+		return nil, err
+	}
+
+	results := make([]*types.Asset, 0, len(assets))
+	for i := range assets {
+		a, err := sql.gormAssetToAsset(&assets[i])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, a)
+	}
+	return results, nil
+}
@@ -0,0 +1,120 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/owasp-amass/asset-db/types"
+	"gorm.io/gorm"
+)
+
+// saveAsset saves the row of an asset already stored. When the repository was created with WithContentHistory and the
+// content of the asset changed, the previous content is added to its history within the same transaction,
+// and the versions beyond the history depth are removed.
+func (sql *sqlRepository) saveAsset(asset *Asset, previous *types.Asset) error {
+	if sql.historyDepth <= 0 || previous == nil {
+		return sql.db.Save(asset).Error
+	}
+
+	content, err := previous.Asset.JSON()
+	if err != nil {
+		return err
+	}
+	// the parsed contents are compared, since Postgres does not keep the formatting of the stored content
+	current, err := (&Asset{Type: asset.Type, Content: asset.Content}).Parse()
+	if err != nil {
+		return err
+	}
+	updated, err := current.JSON()
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(content, updated) {
+		return sql.db.Save(asset).Error
+	}
+
+	return sql.db.Transaction(func(tx *gorm.DB) error {
+		version := AssetHistory{
+			AssetID:  asset.ID,
+			Type:     string(previous.Asset.AssetType()),
+			Content:  content,
+			LastSeen: previous.LastSeen,
+		}
+		if sql.clock != nil {
+			version.ReplacedAt = sql.now()
+		}
+
+		if err := tx.Create(&version).Error; err != nil {
+			return err
+		}
+		if err := tx.Save(asset).Error; err != nil {
+			return err
+		}
+
+		kept := tx.Model(&AssetHistory{}).Select("id").Where("asset_id = ?", asset.ID).Order("id DESC").Limit(sql.historyDepth)
+		return tx.Where("asset_id = ? AND id NOT IN (?)", asset.ID, kept).Delete(&AssetHistory{}).Error
+	})
+}
+
+// FindAssetHistory returns the previous contents of the asset with the provided ID, kept by a repository
+// created with WithContentHistory, ordered from the most recently replaced to the oldest.
+// Fails with ErrResultSetTooLarge when the asset holds more versions than the maximum set by WithMaxResults.
+// Returns the versions as a slice of types.AssetVersion, which is empty when the content of the asset never changed,
+// or an error if the search fails.
+func (sql *sqlRepository) FindAssetHistory(id string) ([]*types.AssetVersion, error) {
+	assetId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []AssetHistory
+	if err := findAll(sql, sql.db.Where("asset_id = ?", assetId).Order("id DESC"), &rows); err != nil {
+		return nil, err
+	}
+
+	versions := make([]*types.AssetVersion, 0, len(rows))
+	for _, row := range rows {
+		a, err := (&Asset{Type: row.Type, Content: row.Content}).Parse()
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, &types.AssetVersion{
+			ID:         strconv.FormatUint(row.ID, 10),
+			AssetID:    id,
+			LastSeen:   row.LastSeen,
+			ReplacedAt: row.ReplacedAt,
+			Asset:      a,
+		})
+	}
+	return versions, nil
+}
+
+// ImportAssetHistory stores a previous content of the asset with the provided ID, which must reference an asset already stored
+// in this database, keeping the time the content was last seen and the time it was replaced. The version is stored as the most
+// recently replaced, regardless of the depth set by WithContentHistory.
+// Returns an error if the version cannot be stored.
+func (sql *sqlRepository) ImportAssetHistory(assetID string, version AssetHistory) error {
+	id, err := strconv.ParseUint(assetID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	version.ID = 0
+	version.AssetID = id
+	return sql.db.Create(&version).Error
+}
+
+// AssetHistoryRowsAfter returns up to limit history rows with an ID greater than the provided id, ordered by ID.
+func (sql *sqlRepository) AssetHistoryRowsAfter(id uint64, limit int) ([]AssetHistory, error) {
+	var rows []AssetHistory
+
+	if err := sql.db.Where("id > ?", id).Order("id").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
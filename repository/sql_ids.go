@@ -0,0 +1,65 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"strconv"
+	"time"
+
+	oam "github.com/owasp-amass/open-asset-model"
+	"gorm.io/gorm"
+)
+
+// FindAssetIDsByContent finds the IDs of the assets matching the content of the provided asset and last seen at or after the since parameter.
+// The assets are matched on their key field as FindAssetByContent matches them, while only the id column is selected,
+// so the content of the assets is neither transferred nor parsed.
+// If since.IsZero(), the parameter will be ignored.
+// Returns the IDs in ascending order, or an error if the search fails.
+func (sql *sqlRepository) FindAssetIDsByContent(assetData oam.Asset, since time.Time) ([]string, error) {
+	ids, err := sql.findAssetIDsByContent(assetData, since)
+	return formatIDs(ids), err
+}
+
+// findAssetIDsByContent returns the IDs found by FindAssetIDsByContent as numbers, so they can be bound to further queries.
+func (sql *sqlRepository) findAssetIDsByContent(assetData oam.Asset, since time.Time) ([]uint64, error) {
+	assetData = sql.normalize(assetData)
+	query, err := contentQuery(assetData)
+	if err != nil {
+		return []uint64{}, err
+	}
+
+	return sql.assetIDs(sql.db.Where("type = ?", string(assetData.AssetType())).Where(query), since)
+}
+
+// FindAssetIDsByType finds the IDs of the assets of the provided asset type and last seen at or after the since parameter,
+// selecting only the id column as FindAssetIDsByContent does.
+// If since.IsZero(), the parameter will be ignored.
+// Returns the IDs in ascending order, or an error if the search fails.
+func (sql *sqlRepository) FindAssetIDsByType(atype oam.AssetType, since time.Time) ([]string, error) {
+	ids, err := sql.assetIDs(sql.db.Where("type = ?", atype), since)
+	return formatIDs(ids), err
+}
+
+// assetIDs returns the IDs of the assets matched by the query and last seen at or after the since parameter.
+func (sql *sqlRepository) assetIDs(tx *gorm.DB, since time.Time) ([]uint64, error) {
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+
+	ids := []uint64{}
+	if err := tx.Model(&Asset{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		return []uint64{}, err
+	}
+	return ids, nil
+}
+
+// formatIDs returns the IDs formatted as the string IDs held by the assets and relations.
+func formatIDs(ids []uint64) []string {
+	formatted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		formatted = append(formatted, strconv.FormatUint(id, 10))
+	}
+	return formatted
+}
@@ -0,0 +1,28 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"math/rand/v2"
+)
+
+// stampCreated sets the timestamps of an asset about to be inserted as a new row from the Clock set by WithClock,
+// with the last seen time moved back by the jitter set by WithLastSeenJitter. The creation time is the insertion time.
+// When neither is set, the timestamps are left to the CURRENT_TIMESTAMP default of the database server.
+func (sql *sqlRepository) stampCreated(asset *Asset) {
+	if sql.clock == nil && sql.lastSeenJitter <= 0 {
+		return
+	}
+
+	now := SystemClock{}.Now()
+	if sql.clock != nil {
+		now = sql.now()
+	}
+	asset.CreatedAt = now
+	asset.LastSeen = now
+	if sql.lastSeenJitter > 0 {
+		asset.LastSeen = now.Add(-rand.N(sql.lastSeenJitter))
+	}
+}
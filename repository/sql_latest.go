@@ -0,0 +1,42 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/owasp-amass/asset-db/types"
+)
+
+// ErrRelationNotFound is returned when no relation matches the assets and the relation type provided.
+var ErrRelationNotFound = errors.New("relation not found")
+
+// FindLatestRelation finds the relation of the provided type from the asset with the ID fromID to the asset with the ID toID
+// that was last seen most recently, with the assets at both ends loaded. Relations are stored once for each pair of assets
+// and relation type since the relations_unique migration, so the single stored relation is normally returned, while the relation
+// with the highest ID is picked among the duplicates sharing the latest last seen time.
+// Returns ErrRelationNotFound if the assets are not linked by the relation type, or an error if the search fails.
+func (sql *sqlRepository) FindLatestRelation(fromID, toID, relationType string) (*types.Relation, error) {
+	from, err := strconv.ParseUint(fromID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	to, err := strconv.ParseUint(toID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var relations []Relation
+	if err := sql.db.Preload("FromAsset").Preload("ToAsset").
+		Where("from_asset_id = ? AND to_asset_id = ? AND type = ?", from, to, relationType).
+		Order("last_seen DESC").Order("id DESC").Limit(1).Find(&relations).Error; err != nil {
+		return nil, err
+	}
+	if len(relations) == 0 {
+		return nil, ErrRelationNotFound
+	}
+	return sql.preloadedRelation(relations[0])
+}
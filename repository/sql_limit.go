@@ -0,0 +1,55 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrResultSetTooLarge is returned by the queries loading every matching row, such as AssetQuery and FindAssetByType,
+// when more rows match than the maximum set by WithMaxResults.
+var ErrResultSetTooLarge = errors.New("the result set exceeds the maximum number of results")
+
+// findAll reads every row selected by the query into dest. When the repository was created with WithMaxResults,
+// the rows are read one at a time and the read stops with ErrResultSetTooLarge once more rows than the maximum are found,
+// so an unbounded result set is never loaded in full. A query preloading associations is limited to one row beyond the maximum instead.
+func findAll[T any](sql *sqlRepository, tx *gorm.DB, dest *[]T) error {
+	if sql.maxResults <= 0 {
+		return tx.Find(dest).Error
+	}
+	if len(tx.Statement.Preloads) > 0 {
+		// the associations are not preloaded for scanned rows, so the rows are loaded at once, up to one beyond the maximum
+		if err := tx.Limit(sql.maxResults + 1).Find(dest).Error; err != nil {
+			return err
+		}
+		if len(*dest) > sql.maxResults {
+			*dest = nil
+			return fmt.Errorf("%w: more than %d rows", ErrResultSetTooLarge, sql.maxResults)
+		}
+		return nil
+	}
+
+	rows, err := tx.Model(new(T)).Rows()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		if len(*dest) >= sql.maxResults {
+			return fmt.Errorf("%w: more than %d rows", ErrResultSetTooLarge, sql.maxResults)
+		}
+
+		var row T
+		if err := sql.db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		*dest = append(*dest, row)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,103 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	"gorm.io/gorm"
+)
+
+// LinkAt creates a relation between the assets as Link does, timestamped with the time the relation was observed
+// instead of the current time, such as when importing historical data. A new relation is created and last seen at observedAt.
+// A relation already stored keeps the earliest creation and the latest last seen timestamp, so importing older observations
+// never moves the last seen timestamp back. Symmetric relations are stored in both directions within a single transaction.
+// Returns the relation, or an error if observedAt is zero, the relation is not valid in the taxonomy, or the link fails.
+func (sql *sqlRepository) LinkAt(source *types.Asset, relation string, destination *types.Asset, observedAt time.Time) (*types.Relation, error) {
+	if observedAt.IsZero() {
+		return &types.Relation{}, errors.New("no observation time provided")
+	}
+	// SQLite compares the timestamps as text, so they are stored in UTC like the since parameters they are compared with
+	observedAt = observedAt.UTC()
+
+	srctype := source.Asset.AssetType()
+	destype := destination.Asset.AssetType()
+	if !oam.ValidRelationship(srctype, relation, destype) {
+		return &types.Relation{}, fmt.Errorf("%s -%s-> %s is not valid in the taxonomy", srctype, relation, destype)
+	}
+	_, symmetric := sql.symmetric[relation]
+	if symmetric && !oam.ValidRelationship(destype, relation, srctype) {
+		return &types.Relation{}, fmt.Errorf("the symmetric relation %s -%s-> %s is not valid in the taxonomy", destype, relation, srctype)
+	}
+
+	var rel *types.Relation
+	err := sql.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if rel, err = linkAt(tx, source, relation, destination, observedAt); err != nil || !symmetric {
+			return err
+		}
+		_, err = linkAt(tx, destination, relation, source, observedAt)
+		return err
+	})
+	if err != nil {
+		return &types.Relation{}, err
+	}
+	return rel, nil
+}
+
+// linkAt stores the relation observed at the provided time, or widens the timestamps of the relation already stored to include it.
+func linkAt(tx *gorm.DB, source *types.Asset, relation string, destination *types.Asset, observedAt time.Time) (*types.Relation, error) {
+	fromAssetId, err := strconv.ParseUint(source.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	toAssetId, err := strconv.ParseUint(destination.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	r := Relation{
+		CreatedAt:   observedAt,
+		LastSeen:    observedAt,
+		Type:        relation,
+		FromAssetID: fromAssetId,
+		ToAssetID:   toAssetId,
+	}
+
+	result := tx.Clauses(relationConflict).Create(&r)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return toRelation(r), nil
+	}
+
+	var stored Relation
+	if err := tx.Where("from_asset_id = ? AND to_asset_id = ? AND type = ?", fromAssetId, toAssetId, relation).First(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if observedAt.Before(stored.CreatedAt) {
+		updates["created_at"] = observedAt
+		stored.CreatedAt = observedAt
+	}
+	if observedAt.After(stored.LastSeen) {
+		updates["last_seen"] = observedAt
+		stored.LastSeen = observedAt
+	}
+	if len(updates) > 0 {
+		if err := tx.Model(&Relation{}).Where("id = ?", stored.ID).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return toRelation(stored), nil
+}
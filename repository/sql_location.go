@@ -0,0 +1,47 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+)
+
+// FindLocationsByCountry finds the Location assets in the provided country and last seen at or after the since parameter.
+// The country is matched against the country field of the content, ignoring case, so a country code only finds the locations
+// stored with the code rather than the name of the country. The match is served by an index on the extracted country.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns the matching locations ordered by ID, or an error if the search fails.
+func (sql *sqlRepository) FindLocationsByCountry(cc string, since time.Time) ([]*types.Asset, error) {
+	cc = strings.TrimSpace(cc)
+	if cc == "" {
+		return nil, errors.New("no country provided")
+	}
+
+	tx := sql.db.Where("type = ? AND UPPER(content->>'country') = ?", oam.Location, strings.ToUpper(cc))
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var assets []Asset
+	if err := findAll(sql, tx.Order("id"), &assets); err != nil {
+		return nil, err
+	}
+
+	locations := make([]*types.Asset, 0, len(assets))
+	for i := range assets {
+		a, err := sql.gormAssetToAsset(&assets[i])
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, a)
+	}
+	return locations, nil
+}
@@ -0,0 +1,78 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+)
+
+// FindNeighborsByType finds the assets of the neighbor type linked from the asset by its outgoing relations
+// of the specified relation types and last seen at or after the since parameter, such as the IP addresses of an FQDN.
+// The relations are joined to the assets they point to by a single query, so the relations are not loaded.
+// Each neighbor is returned once, however many relations point to it.
+// When the repository was created with WithMinTraversalWeight, only the relations with a weight at or above the minimum are followed.
+// When more neighbors are found than the maximum set by WithMaxTraversalNodes, the neighbors with the lowest IDs are returned,
+// up to the maximum, along with an error wrapping ErrTraversalTruncated.
+// If since.IsZero(), the parameter will be ignored.
+// If neighborType is empty, neighbors of any type are returned, and if no relationTypes are specified, all outgoing relations are followed.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns the neighbors ordered by ID, or an error if the search fails.
+func (sql *sqlRepository) FindNeighborsByType(asset *types.Asset, neighborType oam.AssetType, since time.Time, relationTypes ...string) ([]*types.Asset, error) {
+	assetId, err := strconv.ParseUint(asset.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	edges := sql.db.Model(&Relation{}).Select("relations.to_asset_id").Where("relations.from_asset_id = ?", assetId)
+	if len(relationTypes) > 0 {
+		edges = edges.Where("relations.type IN ?", relationTypes)
+	}
+	if !since.IsZero() {
+		edges = edges.Where("relations.last_seen >= ?", sql.sinceArg(since))
+	}
+	if sql.minWeight != nil {
+		edges = edges.Where("relations.weight >= ?", *sql.minWeight)
+	}
+
+	tx := sql.db.Model(&Asset{}).Where("assets.id IN (?)", edges)
+	if neighborType != "" {
+		tx = tx.Where("assets.type = ?", neighborType)
+	}
+
+	tx = tx.Order("assets.id")
+	if sql.maxTraversal > 0 {
+		// one neighbor beyond the maximum shows that the traversal was truncated
+		tx = tx.Limit(sql.maxTraversal + 1)
+	}
+
+	var assets []Asset
+	if err := findAll(sql, tx, &assets); err != nil {
+		return nil, err
+	}
+
+	truncated := sql.maxTraversal > 0 && len(assets) > sql.maxTraversal
+	if truncated {
+		assets = assets[:sql.maxTraversal]
+	}
+
+	results := make([]*types.Asset, 0, len(assets))
+	for i := range assets {
+		a, err := sql.gormAssetToAsset(&assets[i])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, a)
+	}
+
+	if truncated {
+		return results, fmt.Errorf("%w: more than %d assets reached", ErrTraversalTruncated, sql.maxTraversal)
+	}
+	return results, nil
+}
@@ -0,0 +1,149 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	"gorm.io/gorm"
+)
+
+// sourceRelation is the relation type linking an asset to the source that discovered it.
+const sourceRelation = "source"
+
+// LinkObservation links the asset to the source that observed it, storing the confidence of the observation on the relation.
+// If the relation already exists, its last seen timestamp and confidence are updated.
+// The lookup and the write are performed within a single transaction, so the relation is never visible without its confidence.
+// When the source relation type was set by WithSymmetricRelations, the observation is also stored from the source to the asset.
+// Returns the relation as a types.Relation or an error if the link fails.
+func (sql *sqlRepository) LinkObservation(asset *types.Asset, src *types.Asset, confidence int) (*types.Relation, error) {
+	// check that this link will create a valid relationship within the taxonomy
+	atype := asset.Asset.AssetType()
+	srctype := src.Asset.AssetType()
+	if !oam.ValidRelationship(atype, sourceRelation, srctype) {
+		return &types.Relation{}, fmt.Errorf("%s -%s-> %s is not valid in the taxonomy", atype, sourceRelation, srctype)
+	}
+	_, symmetric := sql.symmetric[sourceRelation]
+	if symmetric && !oam.ValidRelationship(srctype, sourceRelation, atype) {
+		return &types.Relation{}, fmt.Errorf("the symmetric relation %s -%s-> %s is not valid in the taxonomy", srctype, sourceRelation, atype)
+	}
+
+	fromAssetId, err := strconv.ParseUint(asset.ID, 10, 64)
+	if err != nil {
+		return &types.Relation{}, err
+	}
+
+	toAssetId, err := strconv.ParseUint(src.ID, 10, 64)
+	if err != nil {
+		return &types.Relation{}, err
+	}
+
+	var r Relation
+	err = sql.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if r, err = sql.observe(tx, fromAssetId, toAssetId, confidence); err != nil || !symmetric {
+			return err
+		}
+		_, err = sql.observe(tx, toAssetId, fromAssetId, confidence)
+		return err
+	})
+	if err != nil {
+		return &types.Relation{}, err
+	}
+	return toRelation(r), nil
+}
+
+// observe stores the source relation with the confidence within the transaction, or updates the last seen timestamp
+// and the confidence of the relation already stored.
+func (sql *sqlRepository) observe(tx *gorm.DB, fromAssetId, toAssetId uint64, confidence int) (Relation, error) {
+	var dups []Relation
+	find := func() error {
+		return tx.Where("from_asset_id = ? AND to_asset_id = ? AND type = ?",
+			fromAssetId, toAssetId, sourceRelation).Limit(1).Find(&dups).Error
+	}
+	if err := find(); err != nil {
+		return Relation{}, err
+	}
+
+	if len(dups) == 0 {
+		r := Relation{
+			Type:        sourceRelation,
+			Confidence:  confidence,
+			FromAssetID: fromAssetId,
+			ToAssetID:   toAssetId,
+		}
+		if sql.clock != nil {
+			r.CreatedAt = sql.now()
+			r.LastSeen = r.CreatedAt
+		}
+
+		result := tx.Clauses(relationConflict).Create(&r)
+		if result.Error != nil {
+			return Relation{}, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return r, nil
+		}
+		// a concurrent writer stored the relation after the lookup above
+		if err := find(); err != nil {
+			return Relation{}, err
+		}
+		if len(dups) == 0 {
+			return Relation{}, errors.New("the observation was neither stored nor found")
+		}
+	}
+
+	var result *gorm.DB
+	if sql.clock != nil {
+		result = tx.Exec("UPDATE relations SET last_seen = ?, confidence = ? WHERE id = ?", sql.now(), confidence, dups[0].ID)
+	} else {
+		result = tx.Exec("UPDATE relations SET last_seen = current_timestamp, confidence = ? WHERE id = ?", confidence, dups[0].ID)
+	}
+	if result.Error != nil {
+		return Relation{}, result.Error
+	}
+
+	var r Relation
+	if err := tx.First(&r, dups[0].ID).Error; err != nil {
+		return Relation{}, err
+	}
+	return r, nil
+}
+
+// Observations finds the relations linking the asset to the sources that observed it and last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more relations match than the maximum set by WithMaxResults.
+// Returns the relations ordered by confidence, highest first, with the source assets populated, or an error if the search fails.
+func (sql *sqlRepository) Observations(asset *types.Asset, since time.Time) ([]*types.Relation, error) {
+	assetId, err := strconv.ParseInt(asset.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := sql.db.Where("from_asset_id = ? AND type = ?", assetId, sourceRelation)
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var relations []Relation
+	if err := findAll(sql, tx.Order("confidence DESC").Order("last_seen DESC"), &relations); err != nil {
+		return nil, err
+	}
+
+	var observations []*types.Relation
+	for _, r := range relations {
+		rel, err := sql.gormRelationToRelation(&r)
+		if err != nil {
+			return nil, err
+		}
+		observations = append(observations, rel)
+	}
+	return observations, nil
+}
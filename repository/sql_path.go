@@ -0,0 +1,60 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+)
+
+// FindAssetByJSONPath finds the assets of the provided type holding the value at the path of their JSON content
+// and last seen at or after the since parameter.
+// The path is a dotted list of keys, such as "headers.server", reaching into the objects nested within the content.
+// On Postgres, the value is matched with a jsonb containment, and on SQLite, it is compared with the value extracted by json_extract.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns a slice of matching assets as []*types.Asset or an error if the search fails.
+func (sql *sqlRepository) FindAssetByJSONPath(atype oam.AssetType, path string, value interface{}, since time.Time) ([]*types.Asset, error) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys {
+		if key == "" {
+			return []*types.Asset{}, fmt.Errorf("invalid JSON path: %q", path)
+		}
+	}
+
+	tx := sql.db.Where("type = ?", atype).Where(jsonPathEquals(value, keys...))
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var assets []Asset
+	if err := findAll(sql, tx.Order("id"), &assets); err != nil {
+		return []*types.Asset{}, err
+	}
+
+	var results []*types.Asset
+	for _, a := range assets {
+		if f, err := a.Parse(); err == nil {
+			results = append(results, &types.Asset{
+				ID:         strconv.FormatUint(a.ID, 10),
+				CreatedAt:  a.CreatedAt,
+				LastSeen:   a.LastSeen,
+				ExternalID: a.ExternalIDValue(),
+				Asset:      f,
+			})
+		}
+	}
+
+	if len(results) == 0 {
+		return []*types.Asset{}, errors.New("no assets matching the JSON path")
+	}
+	return results, nil
+}
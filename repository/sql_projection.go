@@ -0,0 +1,49 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	oam "github.com/owasp-amass/open-asset-model"
+)
+
+// SelectAssetField returns the value of a single field of the content of each asset of the provided type
+// last seen at or after the since parameter, such as the name of every FQDN. The field is named by its JSON key
+// and extracted by the database, so the content of the assets is neither read in full nor parsed.
+// The values are returned as text, ordered by the ID of the assets, and the assets without the field are skipped.
+// Fields holding objects are returned as their JSON encoding, and the text of numbers and booleans is rendered by the database.
+// If since.IsZero(), the parameter will be ignored.
+// Returns the values, or an error if the type does not hold the field or the search fails.
+func (sql *sqlRepository) SelectAssetField(atype oam.AssetType, field string, since time.Time) ([]string, error) {
+	fields, err := contentFields(atype)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(fields, field) {
+		return nil, fmt.Errorf("the %s field is not held by a %s", field, atype)
+	}
+
+	// the field is one of the JSON names of the type, so it is safe to place within the statement
+	value := fmt.Sprintf("content->>'%s'", field)
+	tx := sql.db.Model(&Asset{}).Where("type = ?", atype).Where(value + " IS NOT NULL")
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+	if sql.maxResults > 0 {
+		tx = tx.Limit(sql.maxResults + 1)
+	}
+
+	var values []string
+	if err := tx.Order("id").Pluck(value, &values).Error; err != nil {
+		return nil, err
+	}
+	if sql.maxResults > 0 && len(values) > sql.maxResults {
+		return nil, fmt.Errorf("%w: more than %d rows", ErrResultSetTooLarge, sql.maxResults)
+	}
+	return values, nil
+}
@@ -0,0 +1,91 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"strconv"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateAssetWithRaw creates the asset in the database, as CreateAsset does, and stores the raw data that produced it.
+// The asset and its raw data are stored within a single transaction, so neither is kept when storing the other fails.
+// If raw data is already stored for the asset, it is replaced.
+// Returns the created asset as a types.Asset or an error if the creation fails.
+func (sql *sqlRepository) CreateAssetWithRaw(assetData oam.Asset, raw []byte) (*types.Asset, error) {
+	var a *types.Asset
+	var created bool
+
+	err := sql.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+
+		a, created, err = sql.scoped(tx).createAsset(assetData)
+		if err != nil {
+			return err
+		}
+
+		assetId, err := strconv.ParseUint(a.ID, 10, 64)
+		if err != nil {
+			return err
+		}
+		return upsertAssetRaw(tx, assetId, raw)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if created {
+		sql.notifyCreated(a)
+	}
+	return a, nil
+}
+
+// ImportAssetRaw stores the raw data for the asset with the provided ID, which must reference an asset already stored in this database.
+// If raw data is already stored for the asset, it is replaced.
+// Returns an error if the raw data cannot be stored.
+func (sql *sqlRepository) ImportAssetRaw(id string, raw []byte) error {
+	assetId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return err
+	}
+	return upsertAssetRaw(sql.db, assetId, raw)
+}
+
+// AssetRawRowsAfter returns up to limit raw data rows with an asset ID greater than the provided id, ordered by asset ID.
+func (sql *sqlRepository) AssetRawRowsAfter(id uint64, limit int) ([]AssetRaw, error) {
+	var raws []AssetRaw
+
+	if err := sql.db.Where("asset_id > ?", id).Order("asset_id").Limit(limit).Find(&raws).Error; err != nil {
+		return nil, err
+	}
+	return raws, nil
+}
+
+// upsertAssetRaw stores the raw data of the asset, replacing the raw data already stored for it.
+func upsertAssetRaw(db *gorm.DB, assetId uint64, raw []byte) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "asset_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"raw"}),
+	}).Create(&AssetRaw{AssetID: assetId, Raw: raw}).Error
+}
+
+// FindAssetRawById finds the raw data stored for the asset with the provided ID.
+// Returns the raw data or an error if no raw data is stored for the asset.
+func (sql *sqlRepository) FindAssetRawById(id string) ([]byte, error) {
+	assetId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw AssetRaw
+	result := sql.db.First(&raw, assetId)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return raw.Raw, nil
+}
@@ -0,0 +1,65 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrReadOnly is returned by the methods writing to the database of a repository created with WithReadOnly.
+var ErrReadOnly = errors.New("the asset database is read-only")
+
+// configureReadOnly registers the callbacks that reject the creates, updates, deletes and Exec statements of a read-only repository.
+// The error is added before the statement is built, so the callbacks issuing the statement skip it.
+func (sql *sqlRepository) configureReadOnly() error {
+	if !sql.readOnly {
+		return nil
+	}
+
+	cb := sql.db.Callback()
+	if err := cb.Create().Before("gorm:begin_transaction").Register("asset-db:read_only", rejectWrite); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:begin_transaction").Register("asset-db:read_only", rejectWrite); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:begin_transaction").Register("asset-db:read_only", rejectWrite); err != nil {
+		return err
+	}
+	return cb.Raw().Before("gorm:raw").Register("asset-db:read_only", rejectWrite)
+}
+
+// rejectWrite fails the statement with ErrReadOnly.
+func rejectWrite(db *gorm.DB) {
+	_ = db.AddError(ErrReadOnly)
+}
+
+// readOnlyPostgresDatabase creates a new PostgreSQL database connection as postgresDatabase does,
+// with every transaction of its connections started in read-only mode.
+func readOnlyPostgresDatabase(dsn string) (*gorm.DB, error) {
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	config.RuntimeParams["default_transaction_read_only"] = "on"
+
+	return gorm.Open(postgres.New(postgres.Config{Conn: stdlib.OpenDB(*config)}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+}
+
+// readOnlySQLiteDSN returns the SQLite data source name with the query_only pragma set on its connections,
+// so SQLite rejects the writes issued through RawQuery.
+func readOnlySQLiteDSN(dsn string) string {
+	if strings.Contains(dsn, "?") {
+		return dsn + "&_pragma=query_only(1)"
+	}
+	return dsn + "?_pragma=query_only(1)"
+}
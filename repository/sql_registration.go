@@ -0,0 +1,130 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	"github.com/owasp-amass/open-asset-model/org"
+	"gorm.io/gorm"
+)
+
+// registrationTypes are the asset types of the registration records, which can be queried on the fields of their content.
+var registrationTypes = []oam.AssetType{oam.DomainRecord, oam.AutnumRecord, oam.IPNetRecord}
+
+// FindRegistrationRecords finds the registration records of the provided type, which is a DomainRecord, AutnumRecord or IPNetRecord,
+// holding every value of the fields and last seen at or after the since parameter. The fields are keyed by their JSON names,
+// such as whois_server or name, and each value must equal the value stored in the field. The raw field cannot be queried.
+// On Postgres, the fields are matched with a jsonb containment served by the GIN index on the content column.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns the matching records ordered by ID, or an error if a field is not held by the type or the search fails.
+func (sql *sqlRepository) FindRegistrationRecords(atype oam.AssetType, fields map[string]interface{}, since time.Time) ([]*types.Asset, error) {
+	known, err := registrationFields(atype)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("no fields provided")
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		if !slices.Contains(known, key) {
+			return nil, fmt.Errorf("the %s field cannot be queried on a %s", key, atype)
+		}
+		keys = append(keys, key)
+	}
+	// the fields are matched in a stable order, so the statement is the same for the same fields
+	slices.Sort(keys)
+
+	var query jsonFields
+	for _, key := range keys {
+		query = query.And(fields[key], key)
+	}
+	return sql.findRegistrationRecords(sql.db.Where("type = ?", atype).Where(query), since)
+}
+
+// FindRegistrationRecordsCreated finds the registration records of the provided type with a created date
+// within [start, end) and last seen at or after the since parameter.
+// The created dates are compared as stored, so the match is exact for the dates stored in RFC 3339 format in UTC,
+// as reported by RDAP, and the comparison is served by an index on the created date of the records.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns the matching records ordered by ID, or an error if the type is not a registration record or the search fails.
+func (sql *sqlRepository) FindRegistrationRecordsCreated(atype oam.AssetType, start, end time.Time, since time.Time) ([]*types.Asset, error) {
+	if _, err := registrationFields(atype); err != nil {
+		return nil, err
+	}
+
+	tx := sql.db.Where("type = ? AND content->>'created_date' >= ? AND content->>'created_date' < ?",
+		atype, start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+	return sql.findRegistrationRecords(tx, since)
+}
+
+// FindRegistrationRecordsByOrganization finds the registration records of the provided type linked by the contact relation,
+// such as registrar_contact or registrant, to a ContactRecord linked to the Organization with the provided name,
+// and last seen at or after the since parameter. The registrar of a domain is found with the registrar_contact relation.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns the matching records or an error if the relation does not link the type to a ContactRecord or the search fails.
+func (sql *sqlRepository) FindRegistrationRecordsByOrganization(atype oam.AssetType, relation, name string, since time.Time) ([]*types.Asset, error) {
+	if _, err := registrationFields(atype); err != nil {
+		return nil, err
+	}
+	if !oam.ValidRelationship(atype, relation, oam.ContactRecord) {
+		return nil, fmt.Errorf("%s -%s-> %s is not valid in the taxonomy", atype, relation, oam.ContactRecord)
+	}
+
+	query, err := contentQuery(sql.normalize(&org.Organization{Name: name}))
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := sql.db.Model(&Asset{}).Select("id").Where("type = ?", oam.Organization).Where(query)
+	contacts := sql.db.Table("relations").Select("relations.from_asset_id").
+		Where("relations.type = ? AND relations.to_asset_id IN (?)", "organization", orgs)
+	return sql.findAssetsWithRelation(atype, "from_asset_id", relation, contacts, since)
+}
+
+// findRegistrationRecords reads the records matched by the query and last seen at or after the since parameter, ordered by ID.
+func (sql *sqlRepository) findRegistrationRecords(tx *gorm.DB, since time.Time) ([]*types.Asset, error) {
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var assets []Asset
+	if err := findAll(sql, tx.Order("id"), &assets); err != nil {
+		return nil, err
+	}
+
+	records := make([]*types.Asset, 0, len(assets))
+	for i := range assets {
+		a, err := sql.gormAssetToAsset(&assets[i])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, a)
+	}
+	return records, nil
+}
+
+// registrationFields returns the JSON names of the fields of the registration record type that can be queried.
+func registrationFields(atype oam.AssetType) ([]string, error) {
+	if !slices.Contains(registrationTypes, atype) {
+		return nil, fmt.Errorf("%s is not a registration record", atype)
+	}
+
+	fields, err := contentFields(atype)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(fields, func(name string) bool { return name == "raw" }), nil
+}
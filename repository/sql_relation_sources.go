@@ -0,0 +1,132 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LinkRelationSource records that the source asserted the relation, so the relation keeps the attribution of every source
+// asserting it. If the source already asserted the relation, the last time it did so is updated.
+// The source is also recorded on the reverse direction of a relation of a type set by WithSymmetricRelations, within a single transaction.
+// Returns an error if the source is not a Source asset or the record fails.
+func (sql *sqlRepository) LinkRelationSource(relation *types.Relation, src *types.Asset) error {
+	if srctype := src.Asset.AssetType(); srctype != oam.Source {
+		return fmt.Errorf("a %s asset cannot assert a relation", srctype)
+	}
+
+	relId, err := strconv.ParseUint(relation.ID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	srcId, err := strconv.ParseUint(src.ID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	return sql.db.Transaction(func(tx *gorm.DB) error {
+		reverse, err := sql.reverseRelations(tx, []uint64{relId})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range append([]uint64{relId}, reverse...) {
+			rs := RelationSource{RelationID: id, SourceID: srcId}
+			lastSeen := clause.Expr{SQL: "CURRENT_TIMESTAMP"}
+			if sql.clock != nil {
+				rs.CreatedAt = sql.now()
+				rs.LastSeen = rs.CreatedAt
+				lastSeen = clause.Expr{SQL: "?", Vars: []interface{}{rs.LastSeen}}
+			}
+
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "relation_id"}, {Name: "source_id"}},
+				DoUpdates: clause.Set{{Column: clause.Column{Name: "last_seen"}, Value: lastSeen}},
+			}).Create(&rs).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RelationSources finds the sources that asserted the relation with the provided ID.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns the source assets ordered by the last time they asserted the relation, most recent first,
+// or an error if the search fails.
+func (sql *sqlRepository) RelationSources(relationID string) ([]*types.Asset, error) {
+	relId, err := strconv.ParseUint(relationID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := sql.db.Model(&Asset{}).Select("assets.*").Joins("JOIN relation_sources ON relation_sources.source_id = assets.id").
+		Where("relation_sources.relation_id = ?", relId).
+		Order("relation_sources.last_seen DESC").Order("assets.id")
+
+	var assets []Asset
+	if err := findAll(sql, tx, &assets); err != nil {
+		return nil, err
+	}
+
+	sources := make([]*types.Asset, 0, len(assets))
+	for i := range assets {
+		a, err := sql.gormAssetToAsset(&assets[i])
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, a)
+	}
+	return sources, nil
+}
+
+// ImportRelationSource records that the source with the ID sourceID asserted the relation with the ID relationID, both of which
+// must reference rows already stored in this database, keeping the first and last times of the provided row.
+// If the source already asserted the relation, the later of the two last times is kept.
+// Returns an error if the attribution cannot be stored.
+func (sql *sqlRepository) ImportRelationSource(relationID, sourceID string, rs RelationSource) error {
+	relId, err := strconv.ParseUint(relationID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	srcId, err := strconv.ParseUint(sourceID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	rs.RelationID, rs.SourceID = relId, srcId
+	return sql.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "relation_id"}, {Name: "source_id"}},
+		DoUpdates: clause.Set{{Column: clause.Column{Name: "last_seen"}, Value: clause.Expr{
+			SQL: "CASE WHEN relation_sources.last_seen < excluded.last_seen THEN excluded.last_seen ELSE relation_sources.last_seen END",
+		}}},
+	}).Create(&rs).Error
+}
+
+// RelationSourceRowsAfter returns up to limit attribution rows following the row with the provided relation and source IDs,
+// ordered by relation ID and source ID.
+func (sql *sqlRepository) RelationSourceRowsAfter(relationID, sourceID uint64, limit int) ([]RelationSource, error) {
+	var rows []RelationSource
+
+	if err := sql.db.Where("relation_id > ? OR (relation_id = ? AND source_id > ?)", relationID, relationID, sourceID).
+		Order("relation_id").Order("source_id").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// deleteRelationSources removes the sources asserting the relations matched by the query,
+// which are not removed along with the relations when SQLite foreign keys are off.
+func deleteRelationSources(tx *gorm.DB, relations *gorm.DB) error {
+	return tx.Where("relation_id IN (?)", relations.Model(&Relation{}).Select("id")).Delete(&RelationSource{}).Error
+}
@@ -0,0 +1,59 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUpsertRetries = 5
+	// retryBackoff is the longest wait before the first retry, which doubles for each later retry.
+	retryBackoff = 10 * time.Millisecond
+)
+
+// scoped returns a copy of the repository issuing its statements through the provided transaction.
+func (sql *sqlRepository) scoped(tx *gorm.DB) *sqlRepository {
+	s := *sql
+	s.db = tx
+	return &s
+}
+
+// retry calls fn until it succeeds, returns an error that is not retryable, or the retries set by WithUpsertRetries are used up.
+// Each retry waits for a random duration up to a backoff that doubles with every attempt, so the writers that collided spread out.
+func (sql *sqlRepository) retry(fn func() error) error {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= sql.upsertRetries || !retryable(err) {
+			return err
+		}
+
+		time.Sleep(rand.N(backoff) + time.Millisecond)
+		backoff *= 2
+	}
+}
+
+// retryable returns true if the error reports a transaction that failed only because of concurrent transactions:
+// a serialization failure (40001) or a deadlock (40P01) on Postgres, or a busy or locked SQLite database.
+func retryable(err error) bool {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		code := state.SQLState()
+		return code == "40001" || code == "40P01"
+	}
+
+	var sqlite interface{ Code() int }
+	if errors.As(err, &sqlite) {
+		// the primary result code is held by the low byte of an extended result code
+		code := sqlite.Code() & 0xff
+		return code == 5 || code == 6 // SQLITE_BUSY and SQLITE_LOCKED
+	}
+	return false
+}
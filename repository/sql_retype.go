@@ -0,0 +1,78 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	oam "github.com/owasp-amass/open-asset-model"
+	"gorm.io/gorm"
+)
+
+// RetypeAsset changes the type of the asset with the provided ID in place, so the ID, content and relations of the asset are kept,
+// which corrects an asset stored with the wrong type, such as a NetworkEndpoint holding a socket address.
+// The content must parse as the new type and hold its key field, and the hash of the asset is computed again for the new type.
+// The relations are kept as stored, even when their types are not valid for the new type of the asset.
+// Returns an error if the asset is not found, the content is not compatible with the new type,
+// or an asset of the new type with the same key is already stored.
+func (sql *sqlRepository) RetypeAsset(id string, atype oam.AssetType) error {
+	assetId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	return sql.db.Transaction(func(tx *gorm.DB) error {
+		var stored Asset
+		if err := tx.First(&stored, assetId).Error; err != nil {
+			return err
+		}
+		if stored.Type == string(atype) {
+			return nil
+		}
+
+		retyped := Asset{Type: string(atype), Content: stored.Content}
+		asset, err := retyped.Parse()
+		if err != nil {
+			return fmt.Errorf("the content of asset %s is not a valid %s: %w", id, atype, err)
+		}
+		if err := requireKeyField(asset, stored.Content); err != nil {
+			return fmt.Errorf("the content of asset %s is not a valid %s: %w", id, atype, err)
+		}
+
+		hash := assetHash(asset)
+		var count int64
+		if err := tx.Model(&Asset{}).Where("hash = ? AND id <> ?", hash, assetId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("an asset of type %s with the key %s is already stored", atype, asset.Key())
+		}
+
+		return tx.Model(&Asset{}).Where("id = ?", assetId).Updates(map[string]interface{}{
+			"type": string(atype),
+			"hash": hash,
+		}).Error
+	})
+}
+
+// requireKeyField returns an error if the JSON content does not hold a value for the key field of the asset,
+// since content of another type parses as an asset with an empty key field.
+func requireKeyField(asset oam.Asset, content []byte) error {
+	field, _, err := keyField(asset)
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return err
+	}
+	if v, found := fields[field]; !found || v == nil || v == "" {
+		return fmt.Errorf("the content does not hold the %s field", field)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The schema versions expected by the repository, which are the numbers of the last migration of each database.
+const (
+	PostgresSchemaVersion = 29
+	SQLiteSchemaVersion   = 25
+)
+
+// ErrSchemaVersion is returned when the schema of the database is older or newer than the schema expected by the repository.
+var ErrSchemaVersion = errors.New("incompatible database schema version")
+
+// checkSchemaVersion returns an error wrapping ErrSchemaVersion if the database schema is not the version expected by the repository.
+// A database without the assets table has not been migrated yet, so it is left for the migrations to create the current schema,
+// while a database holding assets without the schema_version table was migrated before the version was recorded.
+func (sql *sqlRepository) checkSchemaVersion() error {
+	expected := SQLiteSchemaVersion
+	if sql.dbType == Postgres {
+		expected = PostgresSchemaVersion
+	}
+
+	migrator := sql.db.Migrator()
+	if !migrator.HasTable("schema_version") {
+		if migrator.HasTable("assets") {
+			return fmt.Errorf("%w: the database predates version %d expected by asset-db; apply the migrations", ErrSchemaVersion, expected)
+		}
+		return nil
+	}
+
+	version, err := sql.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version < expected:
+		return fmt.Errorf("%w: the database is at version %d, older than version %d expected by asset-db; apply the migrations",
+			ErrSchemaVersion, version, expected)
+	case version > expected:
+		return fmt.Errorf("%w: the database is at version %d, newer than version %d expected by asset-db; upgrade asset-db",
+			ErrSchemaVersion, version, expected)
+	}
+	return nil
+}
+
+// SchemaVersion returns the version of the database schema recorded by the migrations.
+func (sql *sqlRepository) SchemaVersion() (int, error) {
+	var versions []int
+
+	if err := sql.db.Raw("SELECT version FROM schema_version").Scan(&versions).Error; err != nil {
+		return 0, err
+	}
+	if len(versions) != 1 {
+		return 0, fmt.Errorf("%w: the schema_version table holds %d rows", ErrSchemaVersion, len(versions))
+	}
+	return versions[0], nil
+}
@@ -7,38 +7,166 @@ package repository
 import (
 	"errors"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/caffix/stringset"
 	"github.com/owasp-amass/asset-db/types"
 	oam "github.com/owasp-amass/open-asset-model"
+	"github.com/owasp-amass/open-asset-model/contact"
 	"github.com/owasp-amass/open-asset-model/domain"
-	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// FindAssetByScope finds assets in the database by applying all the scope constraints provided and last seen after the since parameter.
+// FindAssetByScope finds assets in the database by applying all the scope constraints provided and last seen at or after the since parameter.
 // It takes a slice representing the set of constraints to serve as the scope and retrieves the corresponding assets from the database.
+// Each constraint is applied independently and the results are combined, so an asset is returned when it is related
+// to any of the constraints, or is an EmailAddress within the domain of an FQDN constraint.
+// The assets matching the constraints are not returned themselves; use FindAssetByContentAny to find those.
+// The assets are ordered by their ID in ascending order, so the results are the same across calls.
 // If since.IsZero(), the parameter will be ignored.
+// When a constraint holds more relations than the maximum set by WithMaxResults, the search fails with ErrResultSetTooLarge.
 // Returns a slice of matching assets as []*types.Asset or an error if the search fails.
 func (sql *sqlRepository) FindAssetByScope(constraints []oam.Asset, since time.Time) ([]*types.Asset, error) {
+	return sql.FindAssetByScopeOrdered(constraints, since, Order{})
+}
+
+// FindAssetByScopeOrdered finds assets in the database by applying all the scope constraints provided, as FindAssetByScope does,
+// ordered as described by the order parameter. The assets are found by several queries, so they are ordered after
+// they are retrieved, and assets ordered by their key field are ordered by the key of the asset.
+// The zero order orders the assets by their ID in ascending order, as FindAssetByScope does.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge, as FindAssetByScope does, when a constraint holds more relations than the maximum set by WithMaxResults.
+// Returns a slice of matching assets as []*types.Asset or an error if the search fails.
+func (sql *sqlRepository) FindAssetByScopeOrdered(constraints []oam.Asset, since time.Time, order Order) ([]*types.Asset, error) {
 	var findings []*types.Asset
 
 	for _, constraint := range constraints {
-		if assets, err := sql.constraintEdgeCases(constraint, since); err == nil {
+		assets, err := sql.constraintEdgeCases(constraint, since)
+		if errors.Is(err, ErrResultSetTooLarge) {
+			return []*types.Asset{}, err
+		}
+		if err == nil {
 			for _, a := range assets {
 				if f, err := a.Parse(); err == nil {
 					findings = append(findings, &types.Asset{
-						ID:        strconv.FormatUint(a.ID, 10),
-						CreatedAt: a.CreatedAt,
-						LastSeen:  a.LastSeen,
-						Asset:     f,
+						ID:         strconv.FormatUint(a.ID, 10),
+						CreatedAt:  a.CreatedAt,
+						LastSeen:   a.LastSeen,
+						ExternalID: a.ExternalIDValue(),
+						Asset:      f,
 					})
 				}
 			}
 		}
 
-		if assets, err := sql.inAndOut(constraint, since); err == nil {
-			findings = append(findings, assets...)
+		related, err := sql.inAndOut(constraint, since)
+		if errors.Is(err, ErrResultSetTooLarge) {
+			return []*types.Asset{}, err
+		}
+		if err == nil {
+			findings = append(findings, related...)
+		}
+	}
+
+	if len(findings) == 0 {
+		return []*types.Asset{}, errors.New("no assets in scope")
+	}
+	// the results of the queries are merged, so the order is never left to the database
+	if order.Field == "" {
+		order = Order{Field: OrderByID}
+	}
+	if err := order.sortAssets(findings); err != nil {
+		return []*types.Asset{}, err
+	}
+	return findings, nil
+}
+
+// AssetInScope reports whether the asset would be returned by FindAssetByScope for the constraints, without finding the other assets in scope.
+// The constraints are evaluated one at a time against the stored asset, and the evaluation stops at the first constraint matching it:
+// an EmailAddress is in scope of an FQDN constraint when its address ends with the name of the FQDN, as a plain suffix,
+// and any asset is in scope of a stored constraint when a relation links them in either direction.
+// The content of the constraints is only matched on their key field, so a Netblock constraint does not evaluate its CIDR,
+// and an IP address is only in scope of the netblock when a relation, such as contains, links them.
+// The asset and the relations must be last seen at or after the since parameter. If since.IsZero(), the parameter will be ignored.
+// Returns true if the asset is in scope, or false when it is not stored or no constraint matches it, and an error if a query fails.
+func (sql *sqlRepository) AssetInScope(assetData oam.Asset, constraints []oam.Asset, since time.Time) (bool, error) {
+	assetData = sql.normalize(assetData)
+	ids, err := sql.findAssetIDsByContent(assetData, since)
+	if err != nil || len(ids) == 0 {
+		return false, err
+	}
+
+	for _, constraint := range sql.normalizeAll(constraints) {
+		if email, ok := assetData.(*contact.EmailAddress); ok {
+			if fqdn, ok := constraint.(*domain.FQDN); ok && strings.HasSuffix(email.Address, fqdn.Name) {
+				return true, nil
+			}
+		}
+
+		cids, err := sql.findAssetIDsByContent(constraint, time.Time{})
+		if err != nil {
+			return false, err
+		}
+		if len(cids) == 0 {
+			continue
+		}
+
+		tx := sql.db.Model(&Relation{}).Where(
+			"(from_asset_id IN ? AND to_asset_id IN ?) OR (from_asset_id IN ? AND to_asset_id IN ?)", ids, cids, cids, ids)
+		if !since.IsZero() {
+			tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+		}
+
+		var found []uint64
+		if err := tx.Limit(1).Pluck("id", &found).Error; err != nil {
+			return false, err
+		}
+		if len(found) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FindAssetByContentAny finds the assets in the database matching the content of any of the assets provided and last seen at or after the since parameter.
+// Unlike FindAssetByScope, which returns the assets related to the constraints, the matching assets are returned themselves.
+// The constraints are compiled into a single query of OR'd content query expressions grouped by asset type,
+// so the union of the matching assets is returned without duplicates.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns a slice of matching assets as []*types.Asset or an error if the search fails.
+func (sql *sqlRepository) FindAssetByContentAny(constraints []oam.Asset, since time.Time) ([]*types.Asset, error) {
+	byType, err := contentQueriesByType(sql.normalizeAll(constraints))
+	if err != nil {
+		return []*types.Asset{}, err
+	}
+	if len(byType) == 0 {
+		return []*types.Asset{}, errors.New("no assets in scope")
+	}
+
+	var conds []clause.Expression
+	for atype, queries := range byType {
+		var exprs []clause.Expression
+		for _, q := range queries {
+			exprs = append(exprs, q)
+		}
+		conds = append(conds, clause.And(clause.Eq{Column: clause.Column{Name: "type"}, Value: atype}, anyOf(exprs)))
+	}
+
+	var assets []Asset
+	tx := sql.db.Where(anyOf(conds))
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
+	}
+	if err := findAll(sql, tx, &assets); err != nil {
+		return []*types.Asset{}, err
+	}
+
+	var findings []*types.Asset
+	for _, a := range assets {
+		if f, err := sql.gormAssetToAsset(&a); err == nil {
+			findings = append(findings, f)
 		}
 	}
 
@@ -56,16 +184,20 @@ func (sql *sqlRepository) inAndOut(constraint oam.Asset, since time.Time) ([]*ty
 
 	ids := stringset.New()
 	for _, constraint := range constraints {
-		if rels, err := sql.IncomingRelations(constraint, since); err == nil {
-			for _, rel := range rels {
-				ids.Insert(rel.FromAsset.ID)
-			}
+		rels, err := sql.IncomingRelations(constraint, since)
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range rels {
+			ids.Insert(rel.FromAsset.ID)
 		}
 
-		if rels, err := sql.OutgoingRelations(constraint, since); err == nil {
-			for _, rel := range rels {
-				ids.Insert(rel.ToAsset.ID)
-			}
+		rels, err = sql.OutgoingRelations(constraint, since)
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range rels {
+			ids.Insert(rel.ToAsset.ID)
 		}
 	}
 
@@ -91,14 +223,12 @@ func (sql *sqlRepository) constraintEdgeCases(constraint oam.Asset, since time.T
 }
 
 func (sql *sqlRepository) fqdnToEmails(fqdn *domain.FQDN, since time.Time) ([]Asset, error) {
-	var assets []Asset
-	var result *gorm.DB
-
-	if since.IsZero() {
-		result = sql.db.Where("type = ? AND content->>'address' LIKE ?", oam.EmailAddress, "%"+fqdn.Name).Find(&assets)
-	} else {
-		result = sql.db.Where("type = ? AND content->>'address' LIKE ? AND last_seen > ?", oam.EmailAddress, "%"+fqdn.Name, since).Find(&assets)
+	tx := sql.db.Where("type = ? AND content->>'address' LIKE ?", oam.EmailAddress, "%"+fqdn.Name)
+	if !since.IsZero() {
+		tx = tx.Where("last_seen >= ?", sql.sinceArg(since))
 	}
 
-	return assets, result.Error
+	var assets []Asset
+	err := findAll(sql, tx, &assets)
+	return assets, err
 }
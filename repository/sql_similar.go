@@ -0,0 +1,171 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	"github.com/owasp-amass/open-asset-model/org"
+	"github.com/owasp-amass/open-asset-model/people"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FindSimilarOrganizations finds the organizations with a name similar to the provided name, ordered from the most similar.
+// The names are compared after case folding and replacing punctuation with spaces, so "Acme, Inc." matches "ACME Inc" exactly,
+// and the similarity is the share of trigrams the names have in common, as computed by the pg_trgm extension of Postgres.
+// Organizations with a similarity at or above the threshold, between 0 and 1, are returned.
+// On Postgres, the names are matched by the pg_trgm similarity operator, served by the trigram index on the name of organizations,
+// while on SQLite, every organization is read and compared in Go, so the cost of the search grows with the number of organizations.
+// On Postgres, fails with ErrResultSetTooLarge when more organizations match than the maximum set by WithMaxResults.
+// Returns a slice of matching assets as []*types.Asset or an error if the search fails.
+func (sql *sqlRepository) FindSimilarOrganizations(name string, threshold float64) ([]*types.Asset, error) {
+	return sql.findSimilar(oam.Organization, "name", name, threshold, func(a oam.Asset) string {
+		if o, ok := a.(*org.Organization); ok {
+			return o.Name
+		}
+		return ""
+	})
+}
+
+// FindSimilarPeople finds the people with a full name similar to the provided name, ordered from the most similar.
+// The names are compared as FindSimilarOrganizations compares the names of organizations.
+// On Postgres, fails with ErrResultSetTooLarge when more people match than the maximum set by WithMaxResults.
+// Returns a slice of matching assets as []*types.Asset or an error if the search fails.
+func (sql *sqlRepository) FindSimilarPeople(fullName string, threshold float64) ([]*types.Asset, error) {
+	return sql.findSimilar(oam.Person, "full_name", fullName, threshold, func(a oam.Asset) string {
+		if p, ok := a.(*people.Person); ok {
+			return p.FullName
+		}
+		return ""
+	})
+}
+
+// findSimilar compares the name with the name of each asset of the type, held by the field of the content on Postgres
+// and returned by nameOf on SQLite, where the assets are read in batches and the similarity is computed in Go.
+func (sql *sqlRepository) findSimilar(atype oam.AssetType, field, name string, threshold float64, nameOf func(oam.Asset) string) ([]*types.Asset, error) {
+	if threshold < 0 || threshold > 1 {
+		return []*types.Asset{}, errors.New("the threshold must be between 0 and 1")
+	}
+
+	wanted := trigrams(foldName(name))
+	if len(wanted) == 0 {
+		return []*types.Asset{}, errors.New("the name has no letters or digits to compare")
+	}
+	if sql.dbType == Postgres {
+		return sql.findSimilarPostgres(atype, field, name, threshold)
+	}
+
+	type match struct {
+		asset *types.Asset
+		score float64
+	}
+
+	var matches []match
+	var assets []Asset
+	result := sql.db.Where("type = ?", atype).FindInBatches(&assets, sql.batch(), func(_ *gorm.DB, _ int) error {
+		for _, a := range assets {
+			parsed, err := sql.gormAssetToAsset(&a)
+			if err != nil {
+				continue
+			}
+
+			if score := similarity(wanted, trigrams(foldName(nameOf(parsed.Asset)))); score >= threshold && score > 0 {
+				matches = append(matches, match{asset: parsed, score: score})
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return []*types.Asset{}, result.Error
+	}
+
+	// the assets are read in ID order, so equally similar assets remain ordered by their ID
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	results := []*types.Asset{}
+	for _, m := range matches {
+		results = append(results, m.asset)
+	}
+	return results, nil
+}
+
+// findSimilarPostgres matches the names with the pg_trgm similarity operator, which uses the trigram index on the field
+// created by the migrations, after setting the similarity threshold of the operator for the transaction.
+func (sql *sqlRepository) findSimilarPostgres(atype oam.AssetType, field, name string, threshold float64) ([]*types.Asset, error) {
+	expr := "content->>'" + field + "'"
+
+	var assets []Asset
+	err := sql.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT set_config('pg_trgm.similarity_threshold', ?, true)",
+			strconv.FormatFloat(threshold, 'f', -1, 64)).Error; err != nil {
+			return err
+		}
+
+		// equally similar assets are ordered by their ID, as they are on SQLite
+		return findAll(sql, tx.Where("type = ?", atype).
+			Where(expr+" % ? AND similarity("+expr+", ?) > 0", name, name).
+			Order(clause.OrderBy{Expression: clause.Expr{
+				SQL:                "similarity(" + expr + ", ?) DESC, id",
+				Vars:               []interface{}{name},
+				WithoutParentheses: true,
+			}}), &assets)
+	})
+	if err != nil {
+		return []*types.Asset{}, err
+	}
+
+	results := []*types.Asset{}
+	for _, a := range assets {
+		if parsed, err := sql.gormAssetToAsset(&a); err == nil {
+			results = append(results, parsed)
+		}
+	}
+	return results, nil
+}
+
+// foldName lowercases the name and replaces every run of characters other than letters and digits with a single space.
+func foldName(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// trigrams returns the set of trigrams of the words in the folded name, with each word padded
+// by two spaces in front and one space behind, as the pg_trgm extension does.
+func trigrams(folded string) map[string]struct{} {
+	set := make(map[string]struct{})
+
+	for _, word := range strings.Fields(folded) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
+
+// similarity returns the number of trigrams shared by the two sets divided by the number of distinct trigrams in both sets.
+func similarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	var shared int
+	for t := range a {
+		if _, found := b[t]; found {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
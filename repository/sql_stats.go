@@ -0,0 +1,165 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+)
+
+type typeCount struct {
+	Type  string
+	Count int64
+}
+
+// Stats returns the row counts of the assets and relations tables, grouped by type, along with the on-disk size of the database.
+// The size is reported using pg_database_size on Postgres and the page count and size on SQLite.
+// Returns the statistics as a types.DBStats or an error if a query fails.
+func (sql *sqlRepository) Stats() (*types.DBStats, error) {
+	stats := &types.DBStats{
+		AssetsByType:    make(map[string]int64),
+		RelationsByType: make(map[string]int64),
+	}
+
+	var assets []typeCount
+	if err := sql.db.Raw("SELECT type, COUNT(*) AS count FROM assets GROUP BY type").Scan(&assets).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range assets {
+		stats.AssetsByType[c.Type] = c.Count
+		stats.Assets += c.Count
+	}
+
+	var relations []typeCount
+	if err := sql.db.Raw("SELECT type, COUNT(*) AS count FROM relations GROUP BY type").Scan(&relations).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range relations {
+		stats.RelationsByType[c.Type] = c.Count
+		stats.Relations += c.Count
+	}
+
+	var sizeQuery string
+	switch sql.dbType {
+	case Postgres:
+		sizeQuery = "SELECT pg_database_size(current_database())"
+	case SQLite:
+		sizeQuery = "SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()"
+	}
+
+	if sizeQuery != "" {
+		if err := sql.db.Raw(sizeQuery).Scan(&stats.Size).Error; err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// RelationCounts returns the number of incoming and outgoing relations of the asset with the provided ID, grouped by relation type.
+// Each direction is counted by a single GROUP BY query.
+// Returns the incoming and outgoing counts keyed by relation type, or an error if a query fails.
+func (sql *sqlRepository) RelationCounts(id string) (map[string]int64, map[string]int64, error) {
+	assetId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	incoming, err := sql.relationCounts("to_asset_id", assetId, time.Time{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outgoing, err := sql.relationCounts("from_asset_id", assetId, time.Time{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return incoming, outgoing, nil
+}
+
+// OutgoingRelationTypeCounts returns the number of relations originating from the asset and last seen at or after the since parameter,
+// grouped by relation type with a single GROUP BY query, so the relation rows are never read.
+// If since.IsZero(), the parameter will be ignored.
+// Returns the counts keyed by relation type or an error if the query fails.
+func (sql *sqlRepository) OutgoingRelationTypeCounts(asset *types.Asset, since time.Time) (map[string]int64, error) {
+	assetId, err := strconv.ParseUint(asset.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return sql.relationCounts("from_asset_id", assetId, since)
+}
+
+// IncomingRelationTypeCounts returns the number of relations pointing to the asset and last seen at or after the since parameter,
+// grouped by relation type as OutgoingRelationTypeCounts groups the outgoing relations.
+// If since.IsZero(), the parameter will be ignored.
+// Returns the counts keyed by relation type or an error if the query fails.
+func (sql *sqlRepository) IncomingRelationTypeCounts(asset *types.Asset, since time.Time) (map[string]int64, error) {
+	assetId, err := strconv.ParseUint(asset.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return sql.relationCounts("to_asset_id", assetId, since)
+}
+
+// relationCounts counts the relations referencing the asset in the column and last seen at or after the since parameter,
+// grouped by relation type.
+func (sql *sqlRepository) relationCounts(column string, assetId uint64, since time.Time) (map[string]int64, error) {
+	query := "SELECT type, COUNT(*) AS count FROM relations WHERE " + column + " = ?"
+	args := []interface{}{assetId}
+	if !since.IsZero() {
+		query += " AND last_seen >= ?"
+		args = append(args, sql.sinceArg(since))
+	}
+
+	var rows []typeCount
+	if err := sql.db.Raw(query+" GROUP BY type", args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, c := range rows {
+		counts[c.Type] = c.Count
+	}
+	return counts, nil
+}
+
+// TopAssetsByDegree returns up to n assets of the provided type with the most relations from or pointing to them, most linked first,
+// counting the relations last seen at or after the since parameter with a single GROUP BY join on the relations table.
+// Assets with the same degree are ordered by their ID, and assets without any relation are not returned.
+// If since.IsZero(), the parameter will be ignored.
+// Returns the assets paired with their degree or an error if the query fails.
+func (sql *sqlRepository) TopAssetsByDegree(atype oam.AssetType, n int, since time.Time) ([]types.AssetDegree, error) {
+	if n <= 0 {
+		return nil, errors.New("the number of assets must be greater than zero")
+	}
+
+	tx := sql.db.Model(&Asset{}).Select("assets.*, COUNT(relations.id) AS degree").
+		Joins("JOIN relations ON relations.from_asset_id = assets.id OR relations.to_asset_id = assets.id").
+		Where("assets.type = ?", atype)
+	if !since.IsZero() {
+		tx = tx.Where("relations.last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var rows []struct {
+		Asset  `gorm:"embedded"`
+		Degree int64
+	}
+	if err := tx.Group("assets.id").Order("degree DESC").Order("assets.id").Limit(n).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	results := []types.AssetDegree{}
+	for _, r := range rows {
+		a, err := sql.gormAssetToAsset(&r.Asset)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, types.AssetDegree{Asset: a, Degree: r.Degree})
+	}
+	return results, nil
+}
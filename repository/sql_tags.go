@@ -0,0 +1,129 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	"gorm.io/gorm/clause"
+)
+
+// AddAssetTag attaches the tag with the provided key and value to the asset with the provided ID, such as a client name,
+// an engagement ID or a triage status. Tags are stored apart from the content of the asset, so they are kept when the asset
+// is seen again or its content changes. An asset holds a single value per key, so tagging it again with the same key
+// replaces the value. Returns an error if the key is empty, the asset is not found, or the record fails.
+func (sql *sqlRepository) AddAssetTag(assetID, key, value string) error {
+	if key == "" {
+		return errors.New("no tag key provided")
+	}
+
+	id, err := strconv.ParseUint(assetID, 10, 64)
+	if err != nil {
+		return err
+	}
+	if err := sql.db.Select("id").First(&Asset{}, id).Error; err != nil {
+		return err
+	}
+
+	tag := AssetTag{AssetID: id, Key: key, Value: value}
+	if sql.clock != nil {
+		tag.CreatedAt = sql.now()
+	}
+
+	return sql.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "asset_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value"}),
+	}).Create(&tag).Error
+}
+
+// RemoveAssetTag removes the tag with the provided key from the asset with the provided ID.
+// Removing a tag the asset does not hold is not an error.
+// Returns an error if the removal fails.
+func (sql *sqlRepository) RemoveAssetTag(assetID, key string) error {
+	id, err := strconv.ParseUint(assetID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	return sql.db.Where("asset_id = ? AND key = ?", id, key).Delete(&AssetTag{}).Error
+}
+
+// AssetTags returns the tags attached to the asset with the provided ID, mapping each key to its value.
+// Returns an empty map when the asset holds no tags, or an error if the search fails.
+func (sql *sqlRepository) AssetTags(assetID string) (map[string]string, error) {
+	id, err := strconv.ParseUint(assetID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []AssetTag
+	if err := sql.db.Where("asset_id = ?", id).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]string, len(tags))
+	for _, t := range tags {
+		results[t.Key] = t.Value
+	}
+	return results, nil
+}
+
+// FindAssetsByTag finds the assets holding the tag with the provided key and value, last seen at or after the since parameter.
+// If since.IsZero(), the parameter will be ignored.
+// Fails with ErrResultSetTooLarge when more assets match than the maximum set by WithMaxResults.
+// Returns the assets ordered by ID, or an error if the search fails.
+func (sql *sqlRepository) FindAssetsByTag(key, value string, since time.Time) ([]*types.Asset, error) {
+	tx := sql.db.Model(&Asset{}).Select("assets.*").
+		Joins("JOIN asset_tags ON asset_tags.asset_id = assets.id").
+		Where("asset_tags.key = ? AND asset_tags.value = ?", key, value)
+	if !since.IsZero() {
+		tx = tx.Where("assets.last_seen >= ?", sql.sinceArg(since))
+	}
+
+	var assets []Asset
+	if err := findAll(sql, tx.Order("assets.id"), &assets); err != nil {
+		return nil, err
+	}
+
+	results := make([]*types.Asset, 0, len(assets))
+	for i := range assets {
+		a, err := sql.gormAssetToAsset(&assets[i])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, a)
+	}
+	return results, nil
+}
+
+// ImportAssetTag stores the tag for the asset with the provided ID, which must reference an asset already stored in this database,
+// keeping the time the tag was attached. If the asset already holds a tag with the same key, its value is replaced.
+// Returns an error if the tag cannot be stored.
+func (sql *sqlRepository) ImportAssetTag(assetID string, tag AssetTag) error {
+	id, err := strconv.ParseUint(assetID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	tag.AssetID = id
+	return sql.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "asset_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value"}),
+	}).Create(&tag).Error
+}
+
+// AssetTagRowsAfter returns up to limit tag rows following the tag with the provided asset ID and key, ordered by asset ID and key.
+func (sql *sqlRepository) AssetTagRowsAfter(assetID uint64, key string, limit int) ([]AssetTag, error) {
+	var tags []AssetTag
+
+	if err := sql.db.Where("asset_id > ? OR (asset_id = ? AND key > ?)", assetID, assetID, key).
+		Order("asset_id").Order("key").Limit(limit).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
@@ -0,0 +1,88 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// timeoutCancelKey is the statement setting holding the function that releases the deadline of the statement.
+const timeoutCancelKey = "asset-db:timeout_cancel"
+
+// configureTimeouts registers the callbacks that bound the statements issued by the repository with the
+// read and write timeouts. Queries are reads, while creates, updates, deletes and Exec statements are writes.
+// The deadline is placed on the context of each statement: pgx asks the Postgres server to cancel the statement once it passes,
+// while the SQLite driver interrupts writes but stops watching the deadline once a query returns its rows.
+func (sql *sqlRepository) configureTimeouts() error {
+	cb := sql.db.Callback()
+
+	if d := sql.readTimeout; d > 0 {
+		if err := cb.Query().Before("gorm:query").Register("asset-db:read_timeout", withDeadline(d)); err != nil {
+			return err
+		}
+		if err := cb.Query().After("gorm:after_query").Register("asset-db:read_timeout_cancel", releaseDeadline); err != nil {
+			return err
+		}
+		// the rows scanned by Raw and Scan are read after the callbacks return, so the deadline is released when it passes
+		if err := cb.Row().Before("gorm:row").Register("asset-db:read_timeout", withDeadline(d)); err != nil {
+			return err
+		}
+	}
+
+	if d := sql.writeTimeout; d > 0 {
+		if err := cb.Create().Before("gorm:begin_transaction").Register("asset-db:write_timeout", withDeadline(d)); err != nil {
+			return err
+		}
+		if err := cb.Create().After("gorm:commit_or_rollback_transaction").Register("asset-db:write_timeout_cancel", releaseDeadline); err != nil {
+			return err
+		}
+		if err := cb.Update().Before("gorm:begin_transaction").Register("asset-db:write_timeout", withDeadline(d)); err != nil {
+			return err
+		}
+		if err := cb.Update().After("gorm:commit_or_rollback_transaction").Register("asset-db:write_timeout_cancel", releaseDeadline); err != nil {
+			return err
+		}
+		if err := cb.Delete().Before("gorm:begin_transaction").Register("asset-db:write_timeout", withDeadline(d)); err != nil {
+			return err
+		}
+		if err := cb.Delete().After("gorm:commit_or_rollback_transaction").Register("asset-db:write_timeout_cancel", releaseDeadline); err != nil {
+			return err
+		}
+		if err := cb.Raw().Before("gorm:raw").Register("asset-db:write_timeout", withDeadline(d)); err != nil {
+			return err
+		}
+		if err := cb.Raw().After("gorm:raw").Register("asset-db:write_timeout_cancel", releaseDeadline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withDeadline returns a callback that bounds the statement with the timeout.
+// A deadline already set by an enclosing transaction or by the caller is kept when it is earlier.
+func withDeadline(d time.Duration) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, d)
+		db.Statement.Context = ctx
+		db.InstanceSet(timeoutCancelKey, cancel)
+	}
+}
+
+// releaseDeadline releases the deadline set on the statement by withDeadline once the statement has completed.
+func releaseDeadline(db *gorm.DB) {
+	if v, ok := db.InstanceGet(timeoutCancelKey); ok {
+		if cancel, ok := v.(context.CancelFunc); ok {
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"github.com/owasp-amass/asset-db/types"
+	"gorm.io/gorm"
+)
+
+// Transaction calls fn with a repository running every method within a single transaction, which is committed when fn
+// returns nil and rolled back when fn returns an error, so a batch of writes is stored together or not at all.
+// The functions registered by WithAssetCreated are called with the assets created once the transaction has been committed.
+// The repository provided to fn must not be used after fn returns, and must not be closed.
+// Returns the error returned by fn, or an error if the transaction fails.
+func (sql *sqlRepository) Transaction(fn func(Repository) error) error {
+	var committed []*types.Asset
+
+	err := sql.db.Transaction(func(tx *gorm.DB) error {
+		s := sql.scoped(tx)
+		s.committed = &committed
+		return fn(s)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, a := range committed {
+		sql.notifyCreated(a)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/owasp-amass/asset-db/types"
+	"gorm.io/gorm"
+)
+
+// LinkWeighted creates a relation between the assets as Link does and assigns the weight to it, such as the confidence
+// of the edge when propagating risk. Linking the assets again with another weight replaces the weight of the relation,
+// and symmetric relations are assigned the weight in both directions. The link and the weight are written within a single transaction.
+// Returns the relation holding the weight, or an error if the weight is not a finite number or the link fails.
+func (sql *sqlRepository) LinkWeighted(source *types.Asset, relation string, destination *types.Asset, weight float64) (*types.Relation, error) {
+	if math.IsNaN(weight) || math.IsInf(weight, 0) {
+		return &types.Relation{}, errors.New("the weight must be a finite number")
+	}
+
+	fromAssetId, err := strconv.ParseUint(source.ID, 10, 64)
+	if err != nil {
+		return &types.Relation{}, err
+	}
+	toAssetId, err := strconv.ParseUint(destination.ID, 10, 64)
+	if err != nil {
+		return &types.Relation{}, err
+	}
+
+	var rel *types.Relation
+	err = sql.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if rel, err = sql.scoped(tx).Link(source, relation, destination); err != nil {
+			return err
+		}
+
+		pair := tx.Model(&Relation{}).Where("type = ? AND from_asset_id = ? AND to_asset_id = ?", relation, fromAssetId, toAssetId)
+		if _, found := sql.symmetric[relation]; found {
+			pair = pair.Or("type = ? AND from_asset_id = ? AND to_asset_id = ?", relation, toAssetId, fromAssetId)
+		}
+		return pair.Update("weight", weight).Error
+	})
+	if err != nil {
+		return &types.Relation{}, err
+	}
+
+	rel.Weight = &weight
+	return rel, nil
+}
@@ -0,0 +1,84 @@
+// Copyright © by Jeff Foley 2017-2024. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package assetdb
+
+import (
+	"errors"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/owasp-amass/asset-db/types"
+	oam "github.com/owasp-amass/open-asset-model"
+	"github.com/owasp-amass/open-asset-model/contact"
+	"github.com/owasp-amass/open-asset-model/domain"
+	"github.com/owasp-amass/open-asset-model/fingerprint"
+	"github.com/owasp-amass/open-asset-model/network"
+	"github.com/owasp-amass/open-asset-model/org"
+	"github.com/owasp-amass/open-asset-model/people"
+	oamreg "github.com/owasp-amass/open-asset-model/registration"
+	"github.com/owasp-amass/open-asset-model/service"
+	"github.com/owasp-amass/open-asset-model/source"
+	"github.com/owasp-amass/open-asset-model/url"
+)
+
+// Search finds the assets of any type holding the term in their key field, such as the name of an FQDN,
+// the address of an IPAddress or EmailAddress, or the value of a Fingerprint, and last seen at or after the since parameter.
+// The term is only tried against the types it can be a key of, so IP addresses, netblocks and autonomous systems
+// are only searched for terms that parse as such, and the candidates are matched by FindByContentAny with a single query.
+// Types identified by more than their key field, such as TLS certificates and socket addresses, are not searched.
+// The candidates are the built-in types of the Open Asset Model, so the types added by repository.RegisterAssetType are not searched.
+// If since.IsZero(), the parameter will be ignored.
+// It returns the matching assets, or an error if none match.
+func (as *AssetDB) Search(term string, since time.Time) ([]*types.Asset, error) {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return nil, opError("Search", "", errors.New("no search term provided"))
+	}
+
+	return as.FindByContentAny(searchCandidates(term), since)
+}
+
+// searchCandidates returns an asset holding the term in its key field for each asset type the term can be a key of.
+func searchCandidates(term string) []oam.Asset {
+	candidates := []oam.Asset{
+		&domain.FQDN{Name: term},
+		&domain.NetworkEndpoint{Address: term},
+		&fingerprint.Fingerprint{Value: term},
+		&url.URL{Raw: term},
+		&org.Organization{Name: term},
+		&people.Person{FullName: term},
+		&contact.Phone{Raw: term},
+		&contact.Location{Address: term},
+		&oamreg.DomainRecord{Domain: term},
+		&oamreg.IPNetRecord{Handle: term},
+		&oamreg.AutnumRecord{Handle: term},
+		&service.Service{Identifier: term},
+		&source.Source{Name: term},
+	}
+
+	if strings.Contains(term, "@") {
+		candidates = append(candidates, &contact.EmailAddress{Address: term})
+	}
+	if addr, err := netip.ParseAddr(term); err == nil {
+		candidates = append(candidates, &network.IPAddress{Address: addr, Type: ipType(addr)})
+	}
+	if prefix, err := netip.ParsePrefix(term); err == nil {
+		candidates = append(candidates, &network.Netblock{CIDR: prefix.Masked(), Type: ipType(prefix.Addr())})
+	}
+	if num, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(term), "AS")); err == nil && num >= 0 {
+		candidates = append(candidates, &network.AutonomousSystem{Number: num})
+	}
+	return candidates
+}
+
+// ipType returns the type of the address as it is held by IPAddress and Netblock assets.
+func ipType(addr netip.Addr) string {
+	if addr.Is4() {
+		return "IPv4"
+	}
+	return "IPv6"
+}
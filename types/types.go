@@ -10,19 +10,62 @@ import (
 // Asset represents an asset in the asset database.
 // It contains an ID and the corresponding oam.Asset.
 type Asset struct {
-	ID        string    // The unique identifier of the asset.
-	CreatedAt time.Time // The creation timestamp of the asset.
-	LastSeen  time.Time
-	Asset     oam.Asset // The actual asset data.
+	ID         string    // The unique identifier of the asset.
+	CreatedAt  time.Time // The creation timestamp of the asset.
+	LastSeen   time.Time
+	ExternalID string    // The stable identifier assigned to the asset by an external system, if any.
+	Asset      oam.Asset // The actual asset data.
+}
+
+// AssetVersion represents a previous content of an asset, replaced when the asset was stored again with a different content.
+type AssetVersion struct {
+	ID         string    // The unique identifier of the version.
+	AssetID    string    // The ID of the asset the content belonged to.
+	LastSeen   time.Time // The last time the content was seen before it was replaced.
+	ReplacedAt time.Time // The time the content was replaced.
+	Asset      oam.Asset // The previous content of the asset.
 }
 
 // Relation represents a relationship between two assets in the asset database.
 // It contains an ID, a type describing the relationship, and references to the source and destination assets.
 type Relation struct {
-	ID        string // The unique identifier of the relation.
-	Type      string // The type of the relationship.
-	CreatedAt time.Time
-	LastSeen  time.Time
-	FromAsset *Asset // The source asset of the relation.
-	ToAsset   *Asset // The destination asset of the relation.
+	ID         string // The unique identifier of the relation.
+	Type       string // The type of the relationship.
+	CreatedAt  time.Time
+	LastSeen   time.Time
+	Confidence int      // The confidence (0-100) of the observation, when the relation links an asset to its source.
+	Weight     *float64 // The weight of the relation, such as the strength of the link, or nil when no weight was assigned.
+	FromAsset  *Asset   // The source asset of the relation.
+	ToAsset    *Asset   // The destination asset of the relation.
+}
+
+// Change describes a row inserted into the asset database, as delivered to the subscribers of the change feed.
+type Change struct {
+	Table string // The table holding the row, either "assets" or "relations".
+	ID    string // The unique identifier of the row.
+	Type  string // The asset type or relation type of the row.
+}
+
+// DBStats represents the statistics of the asset database.
+// Size is zero when the database does not support reporting its on-disk size.
+type DBStats struct {
+	Assets          int64            // The total number of assets.
+	Relations       int64            // The total number of relations.
+	AssetsByType    map[string]int64 // The number of assets of each asset type.
+	RelationsByType map[string]int64 // The number of relations of each relation type.
+	Size            int64            // The on-disk size of the database in bytes.
+}
+
+// Direction describes the direction of a relation relative to one of the assets it links.
+type Direction string
+
+const (
+	Incoming Direction = "incoming" // The relation points to the asset.
+	Outgoing Direction = "outgoing" // The relation originates from the asset.
+)
+
+// AssetDegree pairs an asset with the number of relations from or pointing to it.
+type AssetDegree struct {
+	Asset  *Asset // The asset.
+	Degree int64  // The number of relations linking the asset.
 }